@@ -0,0 +1,237 @@
+package gorqlite
+
+/*
+	this file contains the administrative calls: the status, readiness
+	and nodes of the cluster, and the backup and load of the database
+*/
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+type backupFormat int
+
+const (
+	// BackupFormatSQLite is a binary SQLite database file.
+	BackupFormatSQLite backupFormat = iota
+	// BackupFormatSQL is a text SQL dump.
+	BackupFormatSQL
+)
+
+var backupFormatToString = map[backupFormat]string{
+	BackupFormatSQLite: "sqlite",
+	BackupFormatSQL:    "sql",
+}
+
+// String returns the name of the backup format.
+func (bf backupFormat) String() string {
+	if s, ok := backupFormatToString[bf]; ok {
+		return s
+	}
+	return fmt.Sprintf("backupFormat(%d)", int(bf))
+}
+
+// ParseBackupFormat returns the backup format named s, either
+// "sqlite" or "sql".
+func ParseBackupFormat(s string) (backupFormat, error) {
+	for bf, name := range backupFormatToString {
+		if name == s {
+			return bf, nil
+		}
+	}
+	return BackupFormatSQLite, fmt.Errorf("unknown backup format: %s", s)
+}
+
+// sqliteHeader starts every SQLite database file
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// Node is a node of the cluster, as reported by rqlite.
+type Node struct {
+	ID        string  `json:"id"`
+	APIAddr   string  `json:"api_addr"`
+	Addr      string  `json:"addr"`
+	Voter     bool    `json:"voter"`
+	Reachable bool    `json:"reachable"`
+	Leader    bool    `json:"leader"`
+	Time      float64 `json:"time"`
+	Error     string  `json:"error"`
+}
+
+// Status returns the status of the node answering, as reported by
+// rqlite: a JSON object with sections such as "store", "http" and "node".
+func (conn *Connection) Status() (map[string]interface{}, error) {
+	return conn.StatusContext(context.Background())
+}
+
+// StatusContext returns the status of the node answering, see Status.
+func (conn *Connection) StatusContext(ctx context.Context) (map[string]interface{}, error) {
+	if conn.hasBeenClosed {
+		return nil, ErrClosed
+	}
+	trace("%s: Status() called", conn.ID)
+
+	responseBody, err := conn.rqliteApiGet(ctx, api_STATUS)
+	if err != nil {
+		return nil, err
+	}
+	status := make(map[string]interface{})
+	if err := json.Unmarshal(responseBody, &status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// Ready checks that a node of the cluster is ready to serve requests,
+// as told by its /readyz endpoint: its store is open and it knows the
+// leader. The nodes are asked in turn until one is ready.
+func (conn *Connection) Ready() error {
+	return conn.ReadyContext(context.Background())
+}
+
+// ReadyContext checks that a node of the cluster is ready, see Ready.
+func (conn *Connection) ReadyContext(ctx context.Context) error {
+	if conn.hasBeenClosed {
+		return ErrClosed
+	}
+	trace("%s: Ready() called", conn.ID)
+
+	_, err := conn.rqliteApiGet(ctx, api_READYZ)
+	return err
+}
+
+// Nodes returns the nodes of the cluster, ordered by ID, as seen by the
+// node answering. Whether each node is reachable is checked by that node.
+func (conn *Connection) Nodes() ([]Node, error) {
+	return conn.NodesContext(context.Background())
+}
+
+// NodesContext returns the nodes of the cluster, see Nodes.
+func (conn *Connection) NodesContext(ctx context.Context) ([]Node, error) {
+	if conn.hasBeenClosed {
+		return nil, ErrClosed
+	}
+	trace("%s: Nodes() called", conn.ID)
+
+	responseBody, err := conn.rqliteApiGet(ctx, api_NODES)
+	if err != nil {
+		return nil, err
+	}
+	return parseNodes(responseBody)
+}
+
+// parseNodes reads the nodes as returned by rqlite, either an object
+// keyed by node ID, or a "nodes" array in newer versions
+func parseNodes(responseBody []byte) ([]Node, error) {
+	var listed struct {
+		Nodes []Node `json:"nodes"`
+	}
+	if err := json.Unmarshal(responseBody, &listed); err == nil && listed.Nodes != nil {
+		return listed.Nodes, nil
+	}
+
+	byID := make(map[string]Node)
+	if err := json.Unmarshal(responseBody, &byID); err != nil {
+		return nil, fmt.Errorf("could not unmarshal nodes/ response: %w", err)
+	}
+	nodes := make([]Node, 0, len(byID))
+	for id, node := range byID {
+		node.ID = id
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].ID < nodes[j].ID
+	})
+	return nodes, nil
+}
+
+// Backup writes a backup of the database to w, in the given format.
+//
+// The whole backup is held in memory before being written.
+func (conn *Connection) Backup(w io.Writer, format backupFormat) error {
+	return conn.BackupContext(context.Background(), w, format)
+}
+
+// BackupContext writes a backup of the database to w, see Backup.
+func (conn *Connection) BackupContext(ctx context.Context, w io.Writer, format backupFormat) error {
+	if conn.hasBeenClosed {
+		return ErrClosed
+	}
+	if format < BackupFormatSQLite || format > BackupFormatSQL {
+		return fmt.Errorf("unknown backup format: %d", format)
+	}
+	trace("%s: Backup() called for format %s", conn.ID, format)
+
+	ctx = WithRequestOptions(ctx, requestBackupFormat(format))
+	responseBody, err := conn.rqliteApiGet(ctx, api_BACKUP)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(responseBody)
+	return err
+}
+
+// Load replaces the content of the database with the content read
+// from r, either a binary SQLite database file or a text SQL dump.
+//
+// The whole content is held in memory before being sent.
+func (conn *Connection) Load(r io.Reader) error {
+	return conn.LoadContext(context.Background(), r)
+}
+
+// LoadContext replaces the content of the database, see Load.
+func (conn *Connection) LoadContext(ctx context.Context, r io.Reader) error {
+	if conn.hasBeenClosed {
+		return ErrClosed
+	}
+
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	contentType := "text/plain"
+	if bytes.HasPrefix(body, sqliteHeader) {
+		contentType = "application/octet-stream"
+	}
+	trace("%s: Load() called for %d bytes of %s", conn.ID, len(body), contentType)
+
+	if conn.queryCache != nil {
+		// even failed loads may have written
+		defer conn.queryCache.clear()
+	}
+
+	responseBody, err := conn.rqliteApiCall(ctx, api_LOAD, "POST", contentType, body, nil)
+	if err != nil {
+		return err
+	}
+
+	// SQL dumps are executed as statements, and may fail as such
+	var response struct {
+		Error   string `json:"error"`
+		Results []struct {
+			Error string `json:"error"`
+		} `json:"results"`
+	}
+	if len(bytes.TrimSpace(responseBody)) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(responseBody, &response); err != nil {
+		return err
+	}
+	if response.Error != "" {
+		return errors.New(response.Error)
+	}
+	var errs []error
+	for _, result := range response.Results {
+		if result.Error != "" {
+			errs = append(errs, errors.New(result.Error))
+		}
+	}
+	return joinErrors(errs...)
+}
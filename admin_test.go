@@ -0,0 +1,190 @@
+package gorqlite
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseNodes(t *testing.T) {
+	byID := `{
+		"2": {"api_addr": "http://localhost:4003", "addr": "localhost:4004", "reachable": true, "leader": false, "time": 0.001},
+		"1": {"api_addr": "http://localhost:4001", "addr": "localhost:4002", "reachable": true, "leader": true, "voter": true}
+	}`
+	listed := `{"nodes": [
+		{"id": "1", "api_addr": "http://localhost:4001", "addr": "localhost:4002", "reachable": true, "leader": true},
+		{"id": "2", "api_addr": "http://localhost:4003", "addr": "localhost:4004", "reachable": false, "error": "timeout"}
+	]}`
+
+	for name, body := range map[string]string{"by ID": byID, "listed": listed} {
+		t.Run(name, func(t *testing.T) {
+			nodes, err := parseNodes([]byte(body))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(nodes) != 2 {
+				t.Fatalf("got %d nodes, want 2", len(nodes))
+			}
+			if nodes[0].ID != "1" || !nodes[0].Leader || nodes[0].APIAddr != "http://localhost:4001" {
+				t.Errorf("unexpected first node: %+v", nodes[0])
+			}
+			if nodes[1].ID != "2" || nodes[1].Leader {
+				t.Errorf("unexpected second node: %+v", nodes[1])
+			}
+		})
+	}
+
+	if _, err := parseNodes([]byte("[]")); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
+
+func TestParseBackupFormat(t *testing.T) {
+	for _, format := range []backupFormat{BackupFormatSQLite, BackupFormatSQL} {
+		got, err := ParseBackupFormat(format.String())
+		if err != nil || got != format {
+			t.Errorf("%s: got %s, %v", format, got, err)
+		}
+	}
+	if _, err := ParseBackupFormat("zip"); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
+
+func TestAdminCalls(t *testing.T) {
+	var loaded []byte
+	var loadedType string
+	ready := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/readyz":
+			if !ready {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte("[+]node ok\n[-]leader not contactable"))
+				return
+			}
+			w.Write([]byte("[+]node ok\n[+]leader ok\n[+]store ok"))
+		case "/status":
+			w.Write([]byte(`{"store":{"leader":{"node_id":"1","addr":"localhost:4002"}},"node":{"uptime":"1h"}}`))
+		case "/nodes":
+			w.Write([]byte(`{"1":{"api_addr":"http://localhost:4001","reachable":true,"leader":true}}`))
+		case "/db/backup":
+			if r.URL.RawQuery == "fmt=sql" {
+				w.Write([]byte("CREATE TABLE foo (id INTEGER);\n"))
+			} else {
+				w.Write(append(sqliteHeader, "rest of the file"...))
+			}
+		case "/db/load":
+			loaded, _ = io.ReadAll(r.Body)
+			loadedType = r.Header.Get("Content-Type")
+			if bytes.Contains(loaded, []byte("bad")) {
+				w.Write([]byte(`{"results":[{},{"error":"near \"bad\": syntax error"}]}`))
+				return
+			}
+			w.Write([]byte(`{"results":[]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	conn, err := OpenWithOptions(srv.URL, WithClusterDiscovery(false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	t.Run("status", func(t *testing.T) {
+		status, err := conn.Status()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, ok := status["store"]; !ok {
+			t.Errorf("missing store section: %v", status)
+		}
+	})
+
+	t.Run("ready", func(t *testing.T) {
+		if err := conn.Ready(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		ready = false
+		defer func() { ready = true }()
+		if err := conn.ReadyContext(context.Background()); err == nil || !strings.Contains(err.Error(), "leader not contactable") {
+			t.Errorf("got %v, want the node not ready", err)
+		}
+	})
+
+	t.Run("nodes", func(t *testing.T) {
+		nodes, err := conn.Nodes()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(nodes) != 1 || nodes[0].ID != "1" {
+			t.Errorf("unexpected nodes: %+v", nodes)
+		}
+	})
+
+	t.Run("backup", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := conn.Backup(&buf, BackupFormatSQLite); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !bytes.HasPrefix(buf.Bytes(), sqliteHeader) {
+			t.Errorf("unexpected backup: %q", buf.String())
+		}
+
+		buf.Reset()
+		if err := conn.BackupContext(context.Background(), &buf, BackupFormatSQL); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.HasPrefix(buf.String(), "CREATE TABLE") {
+			t.Errorf("unexpected backup: %q", buf.String())
+		}
+
+		if err := conn.Backup(&buf, backupFormat(7)); err == nil {
+			t.Errorf("expected error for unknown format, got nil")
+		}
+	})
+
+	t.Run("load", func(t *testing.T) {
+		database := append(append([]byte(nil), sqliteHeader...), "rest of the file"...)
+		if err := conn.Load(bytes.NewReader(database)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if loadedType != "application/octet-stream" || !bytes.Equal(loaded, database) {
+			t.Errorf("unexpected load of %s: %q", loadedType, loaded)
+		}
+
+		if err := conn.Load(strings.NewReader("CREATE TABLE foo (id INTEGER);")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if loadedType != "text/plain" {
+			t.Errorf("got content type %s, want text/plain", loadedType)
+		}
+
+		err := conn.LoadContext(context.Background(), strings.NewReader("CREATE TABLE foo (id INTEGER); bad;"))
+		if err == nil || !strings.Contains(err.Error(), "syntax error") {
+			t.Errorf("got %v, want a syntax error", err)
+		}
+	})
+
+	t.Run("closed connection", func(t *testing.T) {
+		conn.Close()
+		if _, err := conn.Status(); err != ErrClosed {
+			t.Errorf("got %v, want ErrClosed", err)
+		}
+		if _, err := conn.Nodes(); err != ErrClosed {
+			t.Errorf("got %v, want ErrClosed", err)
+		}
+		if err := conn.Backup(io.Discard, BackupFormatSQL); err != ErrClosed {
+			t.Errorf("got %v, want ErrClosed", err)
+		}
+		if err := conn.Load(strings.NewReader("")); err != ErrClosed {
+			t.Errorf("got %v, want ErrClosed", err)
+		}
+	})
+}
@@ -20,6 +20,7 @@ import (
 	"net/http"
 	nurl "net/url"
 	"strings"
+	"time"
 )
 
 type ParameterizedStatement struct {
@@ -30,70 +31,158 @@ type ParameterizedStatement struct {
 // method: rqliteApiCall() - internally handles api calls,
 // not supposed to be used by other files
 //
-//   - handles retries
+//   - handles retries, going over the peer list up to
+//     conn.retryAttempts times
 //   - handles timeouts
-func (conn *Connection) rqliteApiCall(ctx context.Context, apiOp apiOperation, method string, requestBody []byte) ([]byte, error) {
+//   - applies the request options carried by ctx
+//   - runs the interceptors around every attempt, statements being
+//     those of requestBody, if any
+//   - tries the peers whose circuit breaker is open last, and records
+//     every attempt in their breakers
+func (conn *Connection) rqliteApiCall(ctx context.Context, apiOp apiOperation, method string, contentType string, requestBody []byte, statements []ParameterizedStatement) ([]byte, error) {
 	// Verify that we have at least a single peer to which we can make the request
-	peers := conn.cluster.PeerList()
+	cluster := conn.getCluster()
+	peers := cluster.PeerList()
 	if len(peers) < 1 {
 		return nil, errors.New("don't have any cluster info")
 	}
 	trace("%s: I have a peer list %d peers long", conn.ID, len(peers))
+	if conn.breakers != nil {
+		// the peers whose breaker is open go last
+		var release func()
+		peers, release = conn.breakers.order(peers)
+		defer release()
+	}
+
+	// Apply the request options carried by the context, if any
+	ro := requestOptionsFromContext(ctx)
+	if err := ro.validate(); err != nil {
+		return nil, err
+	}
+	if ro.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ro.timeout)
+		defer cancel()
+	}
+	rs := conn.requestSettings(ro)
 
 	// Keep list of failed requests to each peer, return in case all peers fail to answer
 	var failureLog []string
 
-	for i, peer := range peers {
-		trace("%s: attemping to contact peer %d", conn.ID, i)
-		url := conn.assembleURL(apiOp, peer)
+	attempts := conn.retryAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := conn.retryBackoff
 
-		// Prepare request
-		var bodyReader io.Reader
-		if requestBody != nil {
-			bodyReader = bytes.NewBuffer(requestBody)
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			trace("%s: all peers failed, retrying in %s (attempt %d of %d)", conn.ID, backoff, attempt+1, attempts)
+			conn.log(ctx, LogLevelInfo, "retrying", "op", apiOp.String(), "attempt", attempt+1, "backoff", backoff)
+			if conn.observer != nil {
+				conn.observer.Retry(ctx, RetryEvent{Op: apiOp.String(), Retry: attempt, Backoff: backoff})
+			}
+			if err := sleepContext(ctx, backoff); err != nil {
+				failureLog = append(failureLog, fmt.Sprintf("gave up retrying: %s", err.Error()))
+				break
+			}
+			backoff *= 2
 		}
-		req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
-		if err != nil {
-			trace("%s: got error '%s' doing http.NewRequest", conn.ID, err.Error())
-			failureLog = append(failureLog, fmt.Sprintf("%s failed due to %s", redactURL(url), err.Error()))
-			continue
-		}
-		trace("%s: http.NewRequest() OK", conn.ID)
-		req.Header.Set("Content-Type", "application/json")
 
-		// Execute request using shared client
-		// We will close the response body as soon as we can to allow
-		// the TCP connection to escape back into client's pool
-		response, err := conn.client.Do(req)
-		if err != nil {
-			trace("%s: got error '%s' doing client.Do", conn.ID, err.Error())
-			failureLog = append(failureLog, fmt.Sprintf("%s failed due to %s", redactURL(url), err.Error()))
-			continue
-		}
+		for i, peer := range peers {
+			trace("%s: attemping to contact peer %d", conn.ID, i)
+			url := conn.assembleURL(apiOp, peer, rs)
 
-		// Read response body even if not a successful answer to return a descriptive error message
-		responseBody, err := io.ReadAll(response.Body)
-		if err != nil {
-			trace("%s: got error '%s' doing ioutil.ReadAll", conn.ID, err.Error())
-			failureLog = append(failureLog, fmt.Sprintf("%s failed due to %s", redactURL(url), err.Error()))
-			response.Body.Close()
-			continue
-		}
-		trace("%s: ioutil.ReadAll() OK", conn.ID)
+			// every attempt is logged and observed once done, failing
+			// over to the next peer if any
+			event := RequestEvent{Op: apiOp.String(), Peer: string(peer), Retry: attempt, BytesSent: len(requestBody)}
+			next := ""
+			if i+1 < len(peers) {
+				next = string(peers[i+1])
+			}
+			started := time.Now()
+			attemptCtx, span := conn.startAttemptSpan(ctx, apiOp, method, peer, attempt)
+			done := func(status int, received int, err error) {
+				event.Status, event.BytesReceived, event.Err = status, received, err
+				event.Duration = time.Since(started)
+				conn.attemptDone(ctx, event, next)
+				// a peer eating the deadline of the caller failed, one
+				// the caller gave up on didn't
+				if conn.breakers != nil && !errors.Is(ctx.Err(), context.Canceled) {
+					conn.breakers.record(ctx, peer, event.Duration, status, err)
+				}
+				if status != 0 {
+					span.SetAttributes(Attribute{"http.response.status_code", status})
+				}
+				span.End(err)
+			}
+
+			// Prepare request
+			var bodyReader io.Reader
+			if requestBody != nil {
+				bodyReader = bytes.NewBuffer(requestBody)
+			}
+			req, err := http.NewRequestWithContext(attemptCtx, method, url, bodyReader)
+			if err != nil {
+				trace("%s: got error '%s' doing http.NewRequest", conn.ID, err.Error())
+				failureLog = append(failureLog, fmt.Sprintf("%s failed due to %s", redactURL(url), err.Error()))
+				done(0, 0, err)
+				continue
+			}
+			trace("%s: http.NewRequest() OK", conn.ID)
+			req.Header.Set("Content-Type", contentType)
+			if traceParent := span.TraceParent(); traceParent != "" {
+				req.Header.Set("traceparent", traceParent)
+			}
+
+			// Execute request using shared client, through the interceptors
+			// We will close the response body as soon as we can to allow
+			// the TCP connection to escape back into client's pool
+			call := &Call{
+				Op:               apiOp.String(),
+				Statements:       statements,
+				ConsistencyLevel: rs.consistencyLevel,
+				Peer:             string(peer),
+				Retry:            attempt,
+				Request:          req,
+			}
+			response, err := conn.invoke(call)
+			if err != nil {
+				trace("%s: got error '%s' doing client.Do", conn.ID, err.Error())
+				failureLog = append(failureLog, fmt.Sprintf("%s failed due to %s", redactURL(url), err.Error()))
+				done(0, 0, err)
+				continue
+			}
 
-		// Check that we've got a successful answer
-		if response.StatusCode != http.StatusOK {
-			trace("%s: got code %s", conn.ID, response.Status)
-			failureLog = append(failureLog, fmt.Sprintf("%s failed, got: %s, message: %s", redactURL(url), response.Status, string(responseBody)))
+			// Read response body even if not a successful answer to return a descriptive error message
+			responseBody, err := io.ReadAll(response.Body)
+			if err != nil {
+				trace("%s: got error '%s' doing ioutil.ReadAll", conn.ID, err.Error())
+				failureLog = append(failureLog, fmt.Sprintf("%s failed due to %s", redactURL(url), err.Error()))
+				done(response.StatusCode, len(responseBody), err)
+				response.Body.Close()
+				continue
+			}
+			trace("%s: ioutil.ReadAll() OK", conn.ID)
+
+			// Check that we've got a successful answer
+			if response.StatusCode != http.StatusOK {
+				trace("%s: got code %s", conn.ID, response.Status)
+				failureLog = append(failureLog, fmt.Sprintf("%s failed, got: %s, message: %s", redactURL(url), response.Status, string(responseBody)))
+				done(response.StatusCode, len(responseBody), errors.New(string(responseBody)))
+				response.Body.Close()
+				continue
+			}
 			response.Body.Close()
-			continue
-		}
-		response.Body.Close()
-		trace("%s: client.Do() OK", conn.ID)
+			trace("%s: client.Do() OK", conn.ID)
+			done(response.StatusCode, len(responseBody), nil)
 
-		return responseBody, nil
+			return responseBody, nil
+		}
 	}
 
+	conn.log(ctx, LogLevelError, "all peers failed", "op", apiOp.String(), "peers", len(peers), "attempts", attempts)
+
 	// All peers have failed to answer us, build a verbose error message
 	var builder strings.Builder
 	builder.WriteString("tried all peers unsuccessfully. here are the results:\n")
@@ -103,6 +192,19 @@ func (conn *Connection) rqliteApiCall(ctx context.Context, apiOp apiOperation, m
 	return nil, errors.New(builder.String())
 }
 
+// sleepContext waits for d to pass, or for ctx to be done,
+// in which case the context error is returned
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
 // redactURL redacts URL from the given parameter to be
 // safely read by the client
 func redactURL(url string) string {
@@ -113,7 +215,7 @@ func redactURL(url string) string {
 	return u.Redacted()
 }
 
-//	   method: rqliteApiGet() - for api_STATUS and api_NODES
+//	   method: rqliteApiGet() - for api_STATUS, api_NODES, api_BACKUP and api_READYZ
 //
 //		- lowest level interface - does not do any JSON unmarshaling
 //		- handles retries
@@ -122,12 +224,12 @@ func (conn *Connection) rqliteApiGet(ctx context.Context, apiOp apiOperation) ([
 	var responseBody []byte
 	trace("%s: rqliteApiGet() called", conn.ID)
 
-	// Allow only api_STATUS and api_NODES now - maybe someday BACKUP
-	if apiOp != api_STATUS && apiOp != api_NODES {
+	// Allow only api_STATUS, api_NODES, api_BACKUP and api_READYZ
+	if apiOp != api_STATUS && apiOp != api_NODES && apiOp != api_BACKUP && apiOp != api_READYZ {
 		return responseBody, errors.New("rqliteApiGet() called for invalid api operation")
 	}
 
-	return conn.rqliteApiCall(ctx, apiOp, "GET", nil)
+	return conn.rqliteApiCall(ctx, apiOp, "GET", "application/json", nil, nil)
 }
 
 //	   method: rqliteApiPost() - for api_QUERY and api_WRITE
@@ -148,10 +250,7 @@ func (conn *Connection) rqliteApiPost(ctx context.Context, apiOp apiOperation, s
 	formattedStatements := make([][]interface{}, 0, len(sqlStatements))
 
 	for _, statement := range sqlStatements {
-		formattedStatement := make([]interface{}, 0, len(statement.Arguments)+1)
-		formattedStatement = append(formattedStatement, statement.Query)
-		formattedStatement = append(formattedStatement, statement.Arguments...)
-		formattedStatements = append(formattedStatements, formattedStatement)
+		formattedStatements = append(formattedStatements, formatStatement(statement))
 	}
 
 	body, err := json.Marshal(formattedStatements)
@@ -159,5 +258,76 @@ func (conn *Connection) rqliteApiPost(ctx context.Context, apiOp apiOperation, s
 		return nil, err
 	}
 
-	return conn.rqliteApiCall(ctx, apiOp, "POST", body)
+	if conn.queryCache != nil && apiOp != api_QUERY {
+		// even failed writes may have written
+		defer conn.queryCache.invalidateStatements(sqlStatements)
+	}
+
+	return conn.rqliteApiCall(ctx, apiOp, "POST", "application/json", body, sqlStatements)
+}
+
+// maxRedirects bounds the redirects followed by do
+const maxRedirects = 10
+
+// do sends the request with the HTTP client, following the redirects to
+// the leader itself, see RequestRedirect: the client would follow them
+// as GET requests, without the body nor the credentials.
+func (conn *Connection) do(req *http.Request) (*http.Response, error) {
+	client := *conn.client
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	for redirects := 0; ; redirects++ {
+		response, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		switch response.StatusCode {
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		default:
+			return response, nil
+		}
+		location := response.Header.Get("Location")
+		if location == "" {
+			return response, nil
+		}
+		io.Copy(io.Discard, response.Body)
+		response.Body.Close()
+		if redirects == maxRedirects {
+			return nil, fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+
+		next, err := req.URL.Parse(location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redirect location: %w", err)
+		}
+		if next.User == nil {
+			next.User = req.URL.User
+		}
+		trace("%s: following redirect to %s", conn.ID, redactURL(next.String()))
+
+		var body io.ReadCloser
+		if req.GetBody != nil {
+			if body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		nextReq, err := http.NewRequestWithContext(req.Context(), req.Method, next.String(), body)
+		if err != nil {
+			return nil, err
+		}
+		nextReq.Header = req.Header.Clone()
+		nextReq.GetBody = req.GetBody
+		nextReq.ContentLength = req.ContentLength
+		req = nextReq
+	}
+}
+
+// formatStatement turns a statement into the JSON array rqlite expects,
+// the query followed by its arguments
+func formatStatement(statement ParameterizedStatement) []interface{} {
+	formattedStatement := make([]interface{}, 0, len(statement.Arguments)+1)
+	formattedStatement = append(formattedStatement, statement.Query)
+	return append(formattedStatement, statement.Arguments...)
 }
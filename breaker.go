@@ -0,0 +1,355 @@
+package gorqlite
+
+/*
+	this file contains the circuit breakers of the peers, opted in with
+	WithCircuitBreaker: the peers failing are tripped and tried last,
+	until probed ready again
+*/
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerFailureThreshold = 5
+	defaultBreakerProbeInterval    = 5 * time.Second
+)
+
+type breakerState int
+
+const (
+	// BreakerClosed lets requests go to the peer, in its place in the
+	// peer list.
+	BreakerClosed breakerState = iota
+	// BreakerHalfOpen lets one request at a time go to the peer again,
+	// after it was probed ready, the others going to it last: the
+	// outcome of the trial closes or opens the breaker.
+	BreakerHalfOpen
+	// BreakerOpen makes requests go to the peer last, after all the
+	// others failed, while it is probed in the background.
+	BreakerOpen
+)
+
+var breakerStateToString = map[breakerState]string{
+	BreakerClosed:   "closed",
+	BreakerHalfOpen: "half-open",
+	BreakerOpen:     "open",
+}
+
+// String returns the name of the breaker state.
+func (s breakerState) String() string {
+	if name, ok := breakerStateToString[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("breakerState(%d)", int(s))
+}
+
+// CircuitBreakerConfig configures the circuit breakers of the peers, see
+// WithCircuitBreaker.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failed attempts
+	// opening the breaker of a peer. Defaults to 5.
+	FailureThreshold int
+	// SlowThreshold makes the attempts taking longer count as failed,
+	// even if answered. Defaults to 0, no bound.
+	SlowThreshold time.Duration
+	// ProbeInterval is how often the /readyz endpoint of a peer whose
+	// breaker is open is probed. Defaults to 5s.
+	ProbeInterval time.Duration
+}
+
+// WithCircuitBreaker gives every peer a circuit breaker. An attempt of a
+// request to a peer fails when there is no response, its status is a
+// 5xx, or it takes longer than SlowThreshold. Attempts cut short by
+// the deadline of their caller's context fail too, but those canceled
+// by their caller count for nothing. After FailureThreshold failed
+// attempts in a row, the breaker of the peer opens: requests go to the
+// other peers first, and to it only once they all failed, saving the
+// wait for a half-dead peer to time out. Meanwhile, its /readyz
+// endpoint is probed every ProbeInterval, through the interceptors, and
+// once ready its breaker is half-open: a single request tries it, in
+// its place in the peer list, and closes the breaker if successful, or
+// opens it again, the other requests meanwhile trying it last.
+//
+// An Observer also implementing BreakerObserver is told about the
+// changes of states, see BreakerStatus for the current ones.
+func WithCircuitBreaker(config CircuitBreakerConfig) Option {
+	return func(conn *Connection) error {
+		if config.FailureThreshold < 0 {
+			return fmt.Errorf("invalid circuit breaker failure threshold: %d", config.FailureThreshold)
+		}
+		if config.SlowThreshold < 0 {
+			return fmt.Errorf("invalid circuit breaker slow threshold: %s", config.SlowThreshold)
+		}
+		if config.ProbeInterval < 0 {
+			return fmt.Errorf("invalid circuit breaker probe interval: %s", config.ProbeInterval)
+		}
+		if config.FailureThreshold == 0 {
+			config.FailureThreshold = defaultBreakerFailureThreshold
+		}
+		if config.ProbeInterval == 0 {
+			config.ProbeInterval = defaultBreakerProbeInterval
+		}
+		conn.breakers = &breakers{
+			conn:    conn,
+			config:  config,
+			peers:   make(map[peer]*breaker),
+			stopped: make(chan struct{}),
+		}
+		return nil
+	}
+}
+
+// BreakerStatus is the circuit breaker of a peer, see BreakerStatus.
+type BreakerStatus struct {
+	// Peer is the host:port of the peer.
+	Peer string
+	// State is the state of its breaker.
+	State breakerState
+	// Failures is the number of its failed attempts in a row.
+	Failures int
+	// Since is when the breaker got in its state, zero if it has always
+	// been closed.
+	Since time.Time
+}
+
+// BreakerStatus returns the circuit breakers of the peers that have
+// been asked, ordered by peer, or nil without WithCircuitBreaker.
+func (conn *Connection) BreakerStatus() ([]BreakerStatus, error) {
+	if conn.hasBeenClosed {
+		return nil, ErrClosed
+	}
+	if conn.breakers == nil {
+		return nil, nil
+	}
+	return conn.breakers.status(), nil
+}
+
+// BreakerEvent is the circuit breaker of a peer changing state.
+type BreakerEvent struct {
+	Peer string
+	From breakerState
+	To   breakerState
+	// Err is the failure opening the breaker, nil otherwise.
+	Err error
+}
+
+// BreakerObserver is an Observer told about the circuit breakers of the
+// peers, see WithCircuitBreaker. Like the other methods, it must be safe
+// for concurrent use; it is called from the goroutine of the request,
+// or of the probe, changing the state.
+type BreakerObserver interface {
+	Observer
+	// Breaker is called when the breaker of a peer changes state.
+	Breaker(ctx context.Context, e BreakerEvent)
+}
+
+// breakers is safe for concurrent use
+type breakers struct {
+	conn   *Connection
+	config CircuitBreakerConfig
+
+	mu    sync.Mutex
+	peers map[peer]*breaker
+	// lastTrial numbers the trials of half-open peers
+	lastTrial uint64
+
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+type breaker struct {
+	state    breakerState
+	failures int
+	since    time.Time
+	probing  bool
+	// trial is the number of the trial in flight, if half-open, 0 if none
+	trial uint64
+}
+
+// order returns the peers, those whose breaker is open, or half-open
+// with a trial in flight, last, each part in its order. The other
+// half-open peers are tried by the request: release ends the trials
+// left unattempted once it is done.
+func (b *breakers) order(peers []peer) (ordered []peer, release func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ordered = make([]peer, 0, len(peers))
+	var tripped []peer
+	trials := make(map[peer]uint64)
+	for _, p := range peers {
+		br, ok := b.peers[p]
+		switch {
+		case !ok:
+		case br.state == BreakerOpen, br.state == BreakerHalfOpen && br.trial != 0:
+			tripped = append(tripped, p)
+			continue
+		case br.state == BreakerHalfOpen:
+			b.lastTrial++
+			br.trial = b.lastTrial
+			trials[p] = br.trial
+		}
+		ordered = append(ordered, p)
+	}
+
+	release = func() {
+		if len(trials) == 0 {
+			return
+		}
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for p, trial := range trials {
+			if br := b.peers[p]; br.trial == trial {
+				br.trial = 0
+			}
+		}
+	}
+	return append(ordered, tripped...), release
+}
+
+// record counts an attempt to the peer, whose response had the status,
+// 0 without one
+func (b *breakers) record(ctx context.Context, p peer, d time.Duration, status int, err error) {
+	failed := err != nil && (status < 400 || status >= 500)
+	if !failed && b.config.SlowThreshold > 0 && d > b.config.SlowThreshold {
+		failed = true
+		err = fmt.Errorf("took %s, over %s", d, b.config.SlowThreshold)
+	}
+
+	b.mu.Lock()
+	br, ok := b.peers[p]
+	if !ok {
+		br = &breaker{}
+		b.peers[p] = br
+	}
+	from := br.state
+	if failed {
+		br.failures++
+		if br.state == BreakerHalfOpen || br.state == BreakerClosed && br.failures >= b.config.FailureThreshold {
+			b.setState(p, br, BreakerOpen)
+		}
+	} else {
+		br.failures = 0
+		b.setState(p, br, BreakerClosed)
+	}
+	to := br.state
+	b.mu.Unlock()
+
+	if from != to {
+		if !failed {
+			err = nil
+		}
+		b.changed(ctx, BreakerEvent{Peer: string(p), From: from, To: to, Err: err})
+	}
+}
+
+// setState changes the state of the breaker, probing the peer once
+// open. The lock is held.
+func (b *breakers) setState(p peer, br *breaker, state breakerState) {
+	if br.state == state {
+		return
+	}
+	br.state = state
+	br.since = time.Now()
+	br.trial = 0
+	if state == BreakerOpen && !br.probing {
+		br.probing = true
+		go b.probe(p)
+	}
+}
+
+// probe asks the /readyz endpoint of the peer every probe interval,
+// until it is ready or the connection closed, and half-opens its breaker
+func (b *breakers) probe(p peer) {
+	ticker := time.NewTicker(b.config.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stopped:
+			return
+		case <-ticker.C:
+		}
+		if err := b.ready(p); err != nil {
+			trace("%s: probe of %s failed: %s", b.conn.ID, p, err.Error())
+			continue
+		}
+
+		b.mu.Lock()
+		br := b.peers[p]
+		br.probing = false
+		from := br.state
+		if from == BreakerOpen {
+			b.setState(p, br, BreakerHalfOpen)
+		}
+		b.mu.Unlock()
+		if from == BreakerOpen {
+			b.changed(context.Background(), BreakerEvent{Peer: string(p), From: from, To: BreakerHalfOpen})
+		}
+		return
+	}
+}
+
+// ready asks the /readyz endpoint of the peer, through the interceptors
+func (b *breakers) ready(p peer) error {
+	conn := b.conn
+	ctx, cancel := context.WithTimeout(context.Background(), b.config.ProbeInterval)
+	defer cancel()
+	rs := conn.requestSettings(requestOptions{})
+	req, err := http.NewRequestWithContext(ctx, "GET", conn.assembleURL(api_READYZ, p, rs), nil)
+	if err != nil {
+		return err
+	}
+	response, err := conn.invoke(&Call{
+		Op:               api_READYZ.String(),
+		ConsistencyLevel: rs.consistencyLevel,
+		Peer:             string(p),
+		Request:          req,
+	})
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("got %s", response.Status)
+	}
+	return nil
+}
+
+// changed logs and observes a change of state
+func (b *breakers) changed(ctx context.Context, e BreakerEvent) {
+	conn := b.conn
+	trace("%s: circuit breaker of %s %s -> %s", conn.ID, e.Peer, e.From, e.To)
+	level := LogLevelInfo
+	if e.To == BreakerOpen {
+		level = LogLevelWarn
+	}
+	keyvals := []interface{}{"peer", e.Peer, "from", e.From.String(), "to", e.To.String()}
+	if e.Err != nil {
+		keyvals = append(keyvals, "err", e.Err)
+	}
+	conn.log(ctx, level, "circuit breaker changed", keyvals...)
+	if observer, ok := conn.observer.(BreakerObserver); ok {
+		observer.Breaker(ctx, e)
+	}
+}
+
+func (b *breakers) status() []BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	statuses := make([]BreakerStatus, 0, len(b.peers))
+	for p, br := range b.peers {
+		statuses = append(statuses, BreakerStatus{Peer: string(p), State: br.state, Failures: br.failures, Since: br.since})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Peer < statuses[j].Peer })
+	return statuses
+}
+
+// stop stops the probes
+func (b *breakers) stop() {
+	b.stopOnce.Do(func() { close(b.stopped) })
+}
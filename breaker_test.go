@@ -0,0 +1,241 @@
+package gorqlite
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type breakerRecordingObserver struct {
+	recordingObserver
+	mu     sync.Mutex
+	events []BreakerEvent
+}
+
+func (o *breakerRecordingObserver) Breaker(ctx context.Context, e BreakerEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events = append(o.events, e)
+}
+
+func TestWithCircuitBreaker(t *testing.T) {
+	var healthy int32
+	var sickWrites int32
+	sick := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/db/execute" {
+			atomic.AddInt32(&sickWrites, 1)
+		}
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"results":[{"rows_affected":1}]}`))
+	}))
+	defer sick.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results":[{"rows_affected":1}]}`))
+	}))
+	defer good.Close()
+
+	observer := &breakerRecordingObserver{}
+	conn, err := OpenWithOptions(good.URL, WithClusterDiscovery(false), WithObserver(observer),
+		WithCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2, ProbeInterval: 10 * time.Millisecond}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+	sickPeer := peer(strings.TrimPrefix(sick.URL, "http://"))
+	goodPeer := peer(strings.TrimPrefix(good.URL, "http://"))
+	conn.cluster.peerList = []peer{sickPeer, goodPeer}
+
+	write := func() {
+		t.Helper()
+		if _, err := conn.WriteOne("INSERT INTO foo VALUES (1)"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	state := func(p peer) breakerState {
+		statuses, err := conn.BreakerStatus()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, status := range statuses {
+			if status.Peer == string(p) {
+				return status.State
+			}
+		}
+		return BreakerClosed
+	}
+
+	// two failures in a row open the breaker of the sick peer
+	write()
+	if state(sickPeer) != BreakerClosed {
+		t.Errorf("breaker opened after one failure")
+	}
+	write()
+	if state(sickPeer) != BreakerOpen {
+		t.Errorf("got state %s, want open", state(sickPeer))
+	}
+
+	// then it is tried last, so not at all while the good peer answers
+	write()
+	if n := atomic.LoadInt32(&sickWrites); n != 2 {
+		t.Errorf("got %d writes to the sick peer, want 2", n)
+	}
+
+	// once probed ready, the next request to it closes the breaker
+	atomic.StoreInt32(&healthy, 1)
+	deadline := time.Now().Add(5 * time.Second)
+	for state(sickPeer) != BreakerHalfOpen {
+		if time.Now().After(deadline) {
+			t.Fatalf("breaker not half-open after probing")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	write()
+	if n := atomic.LoadInt32(&sickWrites); n != 3 {
+		t.Errorf("got %d writes to the sick peer, want 3", n)
+	}
+	if state(sickPeer) != BreakerClosed || state(goodPeer) != BreakerClosed {
+		t.Errorf("got states %s and %s, want closed", state(sickPeer), state(goodPeer))
+	}
+
+	observer.mu.Lock()
+	var moves []string
+	for _, e := range observer.events {
+		if e.Peer != string(sickPeer) {
+			t.Errorf("unexpected event: %+v", e)
+		}
+		moves = append(moves, e.To.String())
+	}
+	observer.mu.Unlock()
+	if want := "open half-open closed"; strings.Join(moves, " ") != want {
+		t.Errorf("got changes %v, want %s", moves, want)
+	}
+
+	// slow answers count as failures
+	slow, err := OpenWithOptions(good.URL, WithClusterDiscovery(false),
+		WithCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, SlowThreshold: time.Nanosecond, ProbeInterval: time.Hour}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer slow.Close()
+	slow.WriteOne("INSERT INTO foo VALUES (1)")
+	if statuses, _ := slow.BreakerStatus(); len(statuses) != 1 || statuses[0].State != BreakerOpen || statuses[0].Failures != 1 {
+		t.Errorf("unexpected statuses: %+v", statuses)
+	}
+
+	if _, err := OpenWithOptions(good.URL, WithCircuitBreaker(CircuitBreakerConfig{FailureThreshold: -1})); err == nil {
+		t.Errorf("expected error for a negative failure threshold, got nil")
+	}
+}
+
+func TestCircuitBreakerDeadline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	conn, err := OpenWithOptions(srv.URL, WithClusterDiscovery(false),
+		WithCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, ProbeInterval: time.Hour}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+	state := func() breakerState {
+		statuses, _ := conn.BreakerStatus()
+		if len(statuses) == 0 {
+			return BreakerClosed
+		}
+		return statuses[0].State
+	}
+
+	// canceled by the caller, the attempt counts for nothing
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := conn.QueryOneContext(ctx, "SELECT 1"); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if state() != BreakerClosed {
+		t.Errorf("breaker opened by a canceled attempt")
+	}
+
+	// eating the deadline of the caller, it failed
+	ctx = WithRequestOptions(context.Background(), RequestTimeout(20*time.Millisecond))
+	if _, err := conn.QueryOneContext(ctx, "SELECT 1"); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if state() != BreakerOpen {
+		t.Errorf("got state %s, want open", state())
+	}
+}
+
+func TestCircuitBreakerHalfOpenTrial(t *testing.T) {
+	var sickWrites int32
+	arrived := make(chan struct{}, 10)
+	release := make(chan struct{})
+	sick := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&sickWrites, 1)
+		arrived <- struct{}{}
+		<-release
+		w.Write([]byte(`{"results":[{"rows_affected":1}]}`))
+	}))
+	defer sick.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results":[{"rows_affected":1}]}`))
+	}))
+	defer good.Close()
+
+	conn, err := OpenWithOptions(good.URL, WithClusterDiscovery(false),
+		WithCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, ProbeInterval: time.Hour}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+	sickPeer := peer(strings.TrimPrefix(sick.URL, "http://"))
+	goodPeer := peer(strings.TrimPrefix(good.URL, "http://"))
+	conn.cluster.peerList = []peer{sickPeer, goodPeer}
+	conn.breakers.peers[sickPeer] = &breaker{state: BreakerHalfOpen}
+
+	// the first request is the trial, the others go to the good peer
+	trial := make(chan error)
+	go func() {
+		_, err := conn.WriteOne("INSERT INTO foo VALUES (1)")
+		trial <- err
+	}()
+	<-arrived
+	for i := 0; i < 3; i++ {
+		if _, err := conn.WriteOne("INSERT INTO foo VALUES (1)"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(&sickWrites); n != 1 {
+		t.Errorf("got %d writes to the half-open peer, want 1", n)
+	}
+	close(release)
+	if err := <-trial; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if state := conn.breakers.peers[sickPeer].state; state != BreakerClosed {
+		t.Errorf("got state %s, want closed", state)
+	}
+
+	// a trial claimed but not attempted is released
+	conn.breakers.peers[sickPeer].state = BreakerHalfOpen
+	_, release2 := conn.breakers.order([]peer{sickPeer, goodPeer})
+	if ordered, _ := conn.breakers.order([]peer{sickPeer, goodPeer}); ordered[0] != goodPeer {
+		t.Errorf("half-open peer with a trial in flight not tried last: %v", ordered)
+	}
+	release2()
+	if ordered, _ := conn.breakers.order([]peer{sickPeer, goodPeer}); ordered[0] != sickPeer {
+		t.Errorf("released trial not given again: %v", ordered)
+	}
+}
@@ -0,0 +1,313 @@
+package gorqlite
+
+/*
+	this file contains BulkInsert, which loads many rows into a table
+	with multi-row INSERT statements sent in chunks
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// maxHostParameters is the default limit of SQLite on the number
+	// of parameters of a statement before 3.32.0
+	maxHostParameters = 999
+
+	defaultBulkRowsPerStatement = 500
+	defaultBulkRowsPerChunk     = 1000
+	defaultBulkConcurrency      = 4
+)
+
+// RowIterator provides the rows of a BulkInsert, one at a time.
+type RowIterator interface {
+	// Next returns the values of the next row, in the order of the
+	// columns, or io.EOF once there are no more rows.
+	Next() ([]interface{}, error)
+}
+
+// sliceRows is a RowIterator over a slice
+type sliceRows struct {
+	rows [][]interface{}
+}
+
+// SliceRows returns a RowIterator over rows.
+func SliceRows(rows [][]interface{}) RowIterator {
+	return &sliceRows{rows: rows}
+}
+
+func (sr *sliceRows) Next() ([]interface{}, error) {
+	if len(sr.rows) == 0 {
+		return nil, io.EOF
+	}
+	row := sr.rows[0]
+	sr.rows = sr.rows[1:]
+	return row, nil
+}
+
+// BulkInsertConfig configures a BulkInsert. Zero values get the defaults.
+type BulkInsertConfig struct {
+	// RowsPerStatement is the number of rows of each INSERT statement.
+	// Defaults to 500, or fewer so that a statement has no more than
+	// 999 parameters.
+	RowsPerStatement int
+	// RowsPerChunk is the number of rows of each chunk. A chunk is sent
+	// as a single request, executed within a transaction, so that it is
+	// either inserted or not at all. Defaults to 1000.
+	RowsPerChunk int
+	// Concurrency is the number of chunks sent at the same time.
+	// Defaults to 4.
+	Concurrency int
+}
+
+// BulkInsertResult is the outcome of a BulkInsert.
+type BulkInsertResult struct {
+	// RowsInserted is the number of rows inserted by the chunks that succeeded.
+	RowsInserted int64
+	// Chunks is the number of chunks sent.
+	Chunks int
+	// Errors holds the chunks that failed, ordered by chunk.
+	Errors []*ChunkError
+}
+
+// ChunkError is the error of a BulkInsert chunk. None of its rows
+// were inserted.
+type ChunkError struct {
+	// Chunk is the index of the chunk, starting at 0.
+	Chunk int
+	// FirstRow is the index of the first row of the chunk, starting at 0.
+	FirstRow int
+	// Rows is the number of rows of the chunk.
+	Rows int
+	Err  error
+}
+
+// Error returns a string representation of the chunk error.
+func (e *ChunkError) Error() string {
+	return fmt.Sprintf("chunk %d (rows %d to %d): %s", e.Chunk, e.FirstRow, e.FirstRow+e.Rows-1, e.Err)
+}
+
+// Unwrap returns the error of the chunk.
+func (e *ChunkError) Unwrap() error {
+	return e.Err
+}
+
+// bulkChunk is a chunk ready to be sent
+type bulkChunk struct {
+	index      int
+	firstRow   int
+	rows       int
+	statements []ParameterizedStatement
+}
+
+// BulkInsert inserts the rows into the given columns of table, with
+// the default BulkInsertConfig. See BulkInsertWithConfig.
+func (conn *Connection) BulkInsert(ctx context.Context, table string, columns []string, rows RowIterator) (BulkInsertResult, error) {
+	return conn.BulkInsertWithConfig(ctx, table, columns, rows, BulkInsertConfig{})
+}
+
+// BulkInsertWithConfig inserts the rows into the given columns of table,
+// with multi-row parameterized INSERT statements. The rows are split in
+// chunks, each sent as a single request executed within a transaction,
+// several chunks being sent at the same time.
+//
+// The table and column names are quoted, so they are used as given.
+//
+// BulkInsertWithConfig stops reading rows when the iterator returns an
+// error, a row doesn't have one value per column, or ctx is done. The
+// chunks already sent are waited for, and reported in the result.
+//
+// The error is non-nil if the rows could not all be read, or if a chunk
+// failed: the rows of the chunks that succeeded have been inserted
+// regardless, and the result tells which chunks failed.
+func (conn *Connection) BulkInsertWithConfig(ctx context.Context, table string, columns []string, rows RowIterator, config BulkInsertConfig) (BulkInsertResult, error) {
+	var result BulkInsertResult
+
+	if conn.hasBeenClosed {
+		return result, ErrClosed
+	}
+	if table == "" {
+		return result, errors.New("table name is empty")
+	}
+	if len(columns) == 0 {
+		return result, errors.New("no columns given")
+	}
+	if len(columns) > maxHostParameters {
+		return result, fmt.Errorf("too many columns: %d", len(columns))
+	}
+
+	maxRowsPerStatement := maxHostParameters / len(columns)
+	if config.RowsPerStatement <= 0 {
+		config.RowsPerStatement = defaultBulkRowsPerStatement
+		if config.RowsPerStatement > maxRowsPerStatement {
+			config.RowsPerStatement = maxRowsPerStatement
+		}
+	}
+	if config.RowsPerStatement > maxRowsPerStatement {
+		return result, fmt.Errorf("%d rows per statement would exceed %d parameters", config.RowsPerStatement, maxHostParameters)
+	}
+	if config.RowsPerChunk <= 0 {
+		config.RowsPerChunk = defaultBulkRowsPerChunk
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = defaultBulkConcurrency
+	}
+
+	trace("%s: BulkInsert() into %s, %d rows per statement, %d rows per chunk, %d concurrent chunks",
+		conn.ID, table, config.RowsPerStatement, config.RowsPerChunk, config.Concurrency)
+
+	prefix := "INSERT INTO " + quoteIdentifier(table) + " (" + quoteIdentifiers(columns) + ") VALUES "
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		semaphore = make(chan struct{}, config.Concurrency)
+	)
+
+	send := func(chunk bulkChunk) {
+		defer wg.Done()
+		defer func() { <-semaphore }()
+
+		trace("%s: BulkInsert() sending chunk %d of %d rows", conn.ID, chunk.index, chunk.rows)
+		chunkCtx := WithRequestOptions(ctx, RequestTransaction(true))
+		wrs, err := conn.WriteParameterizedContext(chunkCtx, chunk.statements)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			result.Errors = append(result.Errors, &ChunkError{
+				Chunk:    chunk.index,
+				FirstRow: chunk.firstRow,
+				Rows:     chunk.rows,
+				Err:      err,
+			})
+			return
+		}
+		for _, wr := range wrs {
+			result.RowsInserted += wr.RowsAffected
+		}
+	}
+
+	// dispatch waits for room, and sends the chunk in the background
+	dispatch := func(chunk bulkChunk) error {
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		result.Chunks++
+		wg.Add(1)
+		go send(chunk)
+		return nil
+	}
+
+	var (
+		readErr    error
+		rowIndex   int
+		chunk      = bulkChunk{}
+		query      strings.Builder
+		arguments  []interface{}
+		stmtRows   int
+		chunkIndex int
+	)
+
+	flushStatement := func() {
+		if stmtRows == 0 {
+			return
+		}
+		chunk.statements = append(chunk.statements, ParameterizedStatement{
+			Query:     query.String(),
+			Arguments: arguments,
+		})
+		query.Reset()
+		arguments = nil
+		stmtRows = 0
+	}
+
+	flushChunk := func() error {
+		flushStatement()
+		if chunk.rows == 0 {
+			return nil
+		}
+		err := dispatch(chunk)
+		chunkIndex++
+		chunk = bulkChunk{index: chunkIndex, firstRow: rowIndex}
+		return err
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			readErr = err
+			break
+		}
+		row, err := rows.Next()
+		if err == io.EOF {
+			readErr = flushChunk()
+			break
+		}
+		if err != nil {
+			readErr = fmt.Errorf("reading row %d: %w", rowIndex, err)
+			break
+		}
+		if len(row) != len(columns) {
+			readErr = fmt.Errorf("row %d has %d values, want %d", rowIndex, len(row), len(columns))
+			break
+		}
+
+		if stmtRows == 0 {
+			query.WriteString(prefix)
+		} else {
+			query.WriteString(", ")
+		}
+		query.WriteString(placeholders)
+		arguments = append(arguments, row...)
+		stmtRows++
+		chunk.rows++
+		rowIndex++
+
+		if stmtRows == config.RowsPerStatement {
+			flushStatement()
+		}
+		if chunk.rows == config.RowsPerChunk {
+			if readErr = flushChunk(); readErr != nil {
+				break
+			}
+		}
+	}
+
+	wg.Wait()
+
+	sort.Slice(result.Errors, func(i, j int) bool {
+		return result.Errors[i].Chunk < result.Errors[j].Chunk
+	})
+
+	if readErr != nil {
+		trace("%s: BulkInsert() stopped reading rows: %s", conn.ID, readErr)
+		return result, readErr
+	}
+	if len(result.Errors) > 0 {
+		return result, fmt.Errorf("%d of %d chunks failed, first: %w", len(result.Errors), result.Chunks, result.Errors[0])
+	}
+	return result, nil
+}
+
+// quoteIdentifier quotes an SQL identifier, such as a table or column name
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// quoteIdentifiers quotes and joins SQL identifiers
+func quoteIdentifiers(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdentifier(name)
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,248 @@
+package gorqlite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// insertServer answers writes like rqlite would, recording every
+// request, and failing the requests having a "bad" argument
+type insertServer struct {
+	*httptest.Server
+	mu          sync.Mutex
+	requests    [][][]interface{}
+	urls        []string
+	inFlight    int
+	maxInFlight int
+}
+
+func newInsertServer(t *testing.T) *insertServer {
+	is := &insertServer{}
+	is.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var statements [][]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&statements); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		is.mu.Lock()
+		is.requests = append(is.requests, statements)
+		is.urls = append(is.urls, r.URL.String())
+		is.inFlight++
+		if is.inFlight > is.maxInFlight {
+			is.maxInFlight = is.inFlight
+		}
+		is.mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		is.mu.Lock()
+		is.inFlight--
+		is.mu.Unlock()
+
+		results := make([]string, len(statements))
+		for i, stmt := range statements {
+			results[i] = fmt.Sprintf(`{"rows_affected":%d}`, (len(stmt)-1)/2)
+			for _, arg := range stmt[1:] {
+				if arg == "bad" {
+					results[i] = `{"error":"CHECK constraint failed"}`
+				}
+			}
+		}
+		w.Write([]byte(`{"results":[` + strings.Join(results, ",") + `]}`))
+	}))
+	t.Cleanup(is.Close)
+	return is
+}
+
+func makeRows(n int) [][]interface{} {
+	rows := make([][]interface{}, n)
+	for i := range rows {
+		rows[i] = []interface{}{i, fmt.Sprintf("name %d", i)}
+	}
+	return rows
+}
+
+func TestBulkInsert(t *testing.T) {
+	is := newInsertServer(t)
+	conn, err := OpenWithOptions(is.URL, WithClusterDiscovery(false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	result, err := conn.BulkInsertWithConfig(context.Background(), `my "table"`, []string{"id", "name"}, SliceRows(makeRows(25)), BulkInsertConfig{
+		RowsPerStatement: 4,
+		RowsPerChunk:     10,
+		Concurrency:      2,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.RowsInserted != 25 || result.Chunks != 3 || len(result.Errors) != 0 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	is.mu.Lock()
+	defer is.mu.Unlock()
+
+	if len(is.requests) != 3 {
+		t.Fatalf("got %d requests, want 3", len(is.requests))
+	}
+	if is.maxInFlight > 2 {
+		t.Errorf("got %d concurrent requests, want at most 2", is.maxInFlight)
+	}
+	if !strings.Contains(is.urls[0], "&transaction") {
+		t.Errorf("chunk not sent within a transaction: %s", is.urls[0])
+	}
+
+	// chunks may be sent in any order, find the first one
+	for _, statements := range is.requests {
+		if statements[0][1] != float64(0) {
+			continue
+		}
+		if len(statements) != 3 {
+			t.Fatalf("got %d statements in the first chunk, want 3", len(statements))
+		}
+		want := `INSERT INTO "my ""table""" ("id", "name") VALUES (?, ?), (?, ?), (?, ?), (?, ?)`
+		if statements[0][0] != want {
+			t.Errorf("got query %s, want %s", statements[0][0], want)
+		}
+		if len(statements[0]) != 9 || statements[0][8] != "name 3" {
+			t.Errorf("unexpected arguments: %v", statements[0][1:])
+		}
+		if len(statements[2]) != 5 {
+			t.Errorf("got %d arguments in the last statement, want 4", len(statements[2])-1)
+		}
+	}
+}
+
+func TestBulkInsertDefaults(t *testing.T) {
+	is := newInsertServer(t)
+	conn, err := OpenWithOptions(is.URL, WithClusterDiscovery(false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 400 columns only fit twice in 999 parameters
+	columns := make([]string, 400)
+	row := make([]interface{}, 400)
+	for i := range columns {
+		columns[i] = fmt.Sprintf("c%d", i)
+		row[i] = i
+	}
+	result, err := conn.BulkInsert(context.Background(), "foo", columns, SliceRows([][]interface{}{row, row, row, row, row}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Chunks != 1 {
+		t.Errorf("got %d chunks, want 1", result.Chunks)
+	}
+	if got := len(is.requests[0]); got != 3 {
+		t.Errorf("got %d statements, want 3", got)
+	}
+
+	_, err = conn.BulkInsertWithConfig(context.Background(), "foo", columns, SliceRows(nil), BulkInsertConfig{RowsPerStatement: 3})
+	if err == nil {
+		t.Errorf("expected error for too many parameters, got nil")
+	}
+}
+
+func TestBulkInsertErrors(t *testing.T) {
+	is := newInsertServer(t)
+	conn, err := OpenWithOptions(is.URL, WithClusterDiscovery(false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	config := BulkInsertConfig{RowsPerStatement: 2, RowsPerChunk: 5}
+
+	t.Run("failing chunk", func(t *testing.T) {
+		rows := makeRows(20)
+		rows[12][1] = "bad"
+		result, err := conn.BulkInsertWithConfig(context.Background(), "foo", []string{"id", "name"}, SliceRows(rows), config)
+		if err == nil {
+			t.Fatalf("expected error, got nil")
+		}
+		if result.RowsInserted != 15 || result.Chunks != 4 {
+			t.Errorf("unexpected result: %+v", result)
+		}
+		if len(result.Errors) != 1 {
+			t.Fatalf("got %d chunk errors, want 1", len(result.Errors))
+		}
+		ce := result.Errors[0]
+		if ce.Chunk != 2 || ce.FirstRow != 10 || ce.Rows != 5 {
+			t.Errorf("unexpected chunk error: %+v", ce)
+		}
+		var target *ChunkError
+		if !errors.As(err, &target) || !strings.Contains(err.Error(), "CHECK constraint failed") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("wrong number of values", func(t *testing.T) {
+		rows := makeRows(12)
+		rows[7] = []interface{}{7}
+		result, err := conn.BulkInsertWithConfig(context.Background(), "foo", []string{"id", "name"}, SliceRows(rows), config)
+		if err == nil || !strings.Contains(err.Error(), "row 7") {
+			t.Errorf("got %v, want an error for row 7", err)
+		}
+		// the first chunk was full, and sent
+		if result.RowsInserted != 5 {
+			t.Errorf("got %d rows inserted, want 5", result.RowsInserted)
+		}
+	})
+
+	t.Run("iterator error", func(t *testing.T) {
+		iterErr := errors.New("disk on fire")
+		_, err := conn.BulkInsertWithConfig(context.Background(), "foo", []string{"id"}, &failingRows{err: iterErr}, config)
+		if !errors.Is(err, iterErr) {
+			t.Errorf("got %v, want %v", err, iterErr)
+		}
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		if _, err := conn.BulkInsert(context.Background(), "", []string{"id"}, SliceRows(nil)); err == nil {
+			t.Errorf("expected error for empty table, got nil")
+		}
+		if _, err := conn.BulkInsert(context.Background(), "foo", nil, SliceRows(nil)); err == nil {
+			t.Errorf("expected error for no columns, got nil")
+		}
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := conn.BulkInsert(ctx, "foo", []string{"id", "name"}, SliceRows(makeRows(3)))
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got %v, want context.Canceled", err)
+		}
+	})
+
+	t.Run("closed connection", func(t *testing.T) {
+		conn.Close()
+		if _, err := conn.BulkInsert(context.Background(), "foo", []string{"id"}, SliceRows(nil)); err != ErrClosed {
+			t.Errorf("got %v, want ErrClosed", err)
+		}
+	})
+}
+
+// failingRows returns a few rows, then an error
+type failingRows struct {
+	n   int
+	err error
+}
+
+func (fr *failingRows) Next() ([]interface{}, error) {
+	if fr.n == 3 {
+		return nil, fr.err
+	}
+	fr.n++
+	return []interface{}{fr.n}, nil
+}
@@ -0,0 +1,307 @@
+package gorqlite
+
+/*
+	this file contains the BulkWriter, which coalesces single
+	statements written by many callers into batched writes
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBulkMaxStatements = 100
+	defaultBulkMaxBytes      = 1 << 20
+	defaultBulkFlushInterval = 10 * time.Millisecond
+)
+
+// ErrBulkWriterClosed is returned when writing to a closed BulkWriter.
+var ErrBulkWriterClosed = errors.New("gorqlite: bulk writer is closed")
+
+// BulkWriterConfig configures a BulkWriter. Zero values get the defaults.
+type BulkWriterConfig struct {
+	// MaxStatements flushes the buffer once it holds that many statements.
+	// Defaults to 100.
+	MaxStatements int
+	// MaxBytes flushes the buffer once the JSON encoding of its statements
+	// reaches that size. Defaults to 1 MiB.
+	MaxBytes int
+	// FlushInterval is the longest a statement waits in the buffer.
+	// Defaults to 10ms.
+	FlushInterval time.Duration
+	// MaxPending is the number of statements waiting for the batch in
+	// flight to finish before Write blocks. Defaults to 10 times MaxStatements.
+	MaxPending int
+}
+
+// BulkWriter collects statements written by many callers, possibly from
+// many goroutines, and sends them to rqlite as batched writes, one batch
+// at a time.
+//
+// Batches are executed without a transaction, since their statements are
+// unrelated: a statement failing does not affect the others.
+//
+// Create one with Connection.NewBulkWriter, and Close it when done.
+type BulkWriter struct {
+	conn   *Connection
+	config BulkWriterConfig
+
+	in      chan *pendingWrite
+	flushes chan chan struct{}
+
+	// closing is closed first when closing, for the writes blocked
+	// waiting for room to give up
+	closing   chan struct{}
+	closeOnce sync.Once
+	// mu is held for reading while sending to in, and for writing while
+	// closed is set and stopped closed, so that no statement gets in
+	// after the last drain
+	mu      sync.RWMutex
+	closed  bool
+	stopped chan struct{}
+	done    chan struct{}
+}
+
+// pendingWrite is a statement waiting in the buffer
+type pendingWrite struct {
+	statement ParameterizedStatement
+	size      int
+	future    *WriteFuture
+}
+
+// WriteFuture is the result of a statement written to a BulkWriter,
+// available once its batch has been executed.
+type WriteFuture struct {
+	done   chan struct{}
+	result WriteResult
+	err    error
+}
+
+// Done returns a channel closed once the result is available.
+func (f *WriteFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait waits for the result of the statement, or for ctx to be done.
+// The error is either the error of the statement or of its whole batch.
+func (f *WriteFuture) Wait(ctx context.Context) (WriteResult, error) {
+	select {
+	case <-f.done:
+		return f.result, f.err
+	case <-ctx.Done():
+		return WriteResult{Err: ctx.Err()}, ctx.Err()
+	}
+}
+
+func (f *WriteFuture) resolve(wr WriteResult, err error) {
+	f.result = wr
+	f.err = err
+	close(f.done)
+}
+
+// NewBulkWriter returns a BulkWriter sending its batches through conn.
+func (conn *Connection) NewBulkWriter(config BulkWriterConfig) *BulkWriter {
+	if config.MaxStatements <= 0 {
+		config.MaxStatements = defaultBulkMaxStatements
+	}
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = defaultBulkMaxBytes
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaultBulkFlushInterval
+	}
+	if config.MaxPending <= 0 {
+		config.MaxPending = 10 * config.MaxStatements
+	}
+
+	bw := &BulkWriter{
+		conn:    conn,
+		config:  config,
+		in:      make(chan *pendingWrite, config.MaxPending),
+		flushes: make(chan chan struct{}),
+		closing: make(chan struct{}),
+		stopped: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	trace("%s: NewBulkWriter() with %d statements, %d bytes, %s, %d pending", conn.ID,
+		config.MaxStatements, config.MaxBytes, config.FlushInterval, config.MaxPending)
+
+	go bw.run()
+	return bw
+}
+
+// Write adds a statement to the buffer and returns a future for its result.
+//
+// Write blocks while MaxPending statements are already waiting, until
+// there is room, ctx is done or the BulkWriter is closed.
+func (bw *BulkWriter) Write(ctx context.Context, statement ParameterizedStatement) (*WriteFuture, error) {
+	// encode now, so that a bad statement fails here rather than its batch
+	encoded, err := json.Marshal(formatStatement(statement))
+	if err != nil {
+		return nil, fmt.Errorf("could not encode statement: %w", err)
+	}
+
+	pw := &pendingWrite{
+		statement: statement,
+		size:      len(encoded),
+		future:    &WriteFuture{done: make(chan struct{})},
+	}
+
+	bw.mu.RLock()
+	defer bw.mu.RUnlock()
+	if bw.closed {
+		return nil, ErrBulkWriterClosed
+	}
+
+	select {
+	case bw.in <- pw:
+		return pw.future, nil
+	case <-bw.closing:
+		return nil, ErrBulkWriterClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// WriteOne writes a statement and waits for its result.
+func (bw *BulkWriter) WriteOne(ctx context.Context, statement ParameterizedStatement) (WriteResult, error) {
+	future, err := bw.Write(ctx, statement)
+	if err != nil {
+		return WriteResult{Err: err}, err
+	}
+	return future.Wait(ctx)
+}
+
+// Flush sends the statements buffered so far and waits for their
+// batches to be executed, or for ctx to be done.
+func (bw *BulkWriter) Flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+	select {
+	case bw.flushes <- flushed:
+	case <-bw.done:
+		return ErrBulkWriterClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting statements, sends the ones buffered and waits
+// for their batches to be executed, or for ctx to be done. It is safe
+// to call Close several times.
+//
+// Writes blocked waiting for room fail with ErrBulkWriterClosed.
+func (bw *BulkWriter) Close(ctx context.Context) error {
+	// the writes blocked give up first, so the lock is soon free
+	bw.closeOnce.Do(func() { close(bw.closing) })
+	bw.mu.Lock()
+	if !bw.closed {
+		bw.closed = true
+		close(bw.stopped)
+	}
+	bw.mu.Unlock()
+
+	select {
+	case <-bw.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run is the loop filling and sending the batches
+func (bw *BulkWriter) run() {
+	defer close(bw.done)
+
+	ticker := time.NewTicker(bw.config.FlushInterval)
+	defer ticker.Stop()
+
+	var batch []*pendingWrite
+	var batchBytes int
+
+	send := func() {
+		if len(batch) > 0 {
+			bw.execute(batch)
+		}
+		batch = nil
+		batchBytes = 0
+	}
+
+	// drain moves whatever is waiting in the channel to batches
+	drain := func() {
+		for {
+			select {
+			case pw := <-bw.in:
+				batch = append(batch, pw)
+				batchBytes += pw.size
+				if len(batch) >= bw.config.MaxStatements || batchBytes >= bw.config.MaxBytes {
+					send()
+				}
+			default:
+				send()
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case pw := <-bw.in:
+			batch = append(batch, pw)
+			batchBytes += pw.size
+			if len(batch) >= bw.config.MaxStatements || batchBytes >= bw.config.MaxBytes {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case flushed := <-bw.flushes:
+			drain()
+			close(flushed)
+		case <-bw.stopped:
+			drain()
+			trace("%s: BulkWriter closed", bw.conn.ID)
+			return
+		}
+	}
+}
+
+// execute sends a batch and hands each caller its result
+func (bw *BulkWriter) execute(batch []*pendingWrite) {
+	statements := make([]ParameterizedStatement, len(batch))
+	for i, pw := range batch {
+		statements[i] = pw.statement
+	}
+
+	trace("%s: BulkWriter sending a batch of %d statements", bw.conn.ID, len(statements))
+	ctx := WithRequestOptions(context.Background(), RequestTransaction(false))
+	results, err := bw.conn.WriteParameterizedContext(ctx, statements)
+
+	// an error other than statement errors failed the whole batch
+	var statementErrors StatementErrors
+	if err != nil && !errors.As(err, &statementErrors) {
+		for _, pw := range batch {
+			pw.future.resolve(WriteResult{Err: err}, err)
+		}
+		return
+	}
+
+	for i, pw := range batch {
+		if i >= len(results) {
+			err := errors.New("no result for statement")
+			pw.future.resolve(WriteResult{Err: err}, err)
+			continue
+		}
+		pw.future.resolve(results[i], results[i].Err)
+	}
+}
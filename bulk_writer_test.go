@@ -0,0 +1,340 @@
+package gorqlite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// bulkServer answers writes like rqlite would, recording the size of
+// every batch, and failing the statements whose query is "FAIL"
+type bulkServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	batches []int
+	urls    []string
+	block   chan struct{}
+}
+
+func newBulkServer(t *testing.T) *bulkServer {
+	bs := &bulkServer{}
+	bs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if bs.block != nil {
+			<-bs.block
+		}
+		var statements [][]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&statements); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		bs.mu.Lock()
+		bs.batches = append(bs.batches, len(statements))
+		bs.urls = append(bs.urls, r.URL.String())
+		bs.mu.Unlock()
+
+		results := make([]string, len(statements))
+		for i, stmt := range statements {
+			if stmt[0] == "FAIL" {
+				results[i] = `{"error":"near \"FAIL\": syntax error"}`
+			} else {
+				results[i] = fmt.Sprintf(`{"last_insert_id":%d,"rows_affected":1}`, i+1)
+			}
+		}
+		w.Write([]byte(`{"results":[` + strings.Join(results, ",") + `]}`))
+	}))
+	t.Cleanup(bs.Close)
+	return bs
+}
+
+func (bs *bulkServer) batchSizes() []int {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	return append([]int(nil), bs.batches...)
+}
+
+func openBulkConn(t *testing.T, bs *bulkServer) *Connection {
+	conn, err := OpenWithOptions(bs.URL, WithClusterDiscovery(false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return conn
+}
+
+func TestBulkWriterMaxStatements(t *testing.T) {
+	bs := newBulkServer(t)
+	conn := openBulkConn(t, bs)
+	bw := conn.NewBulkWriter(BulkWriterConfig{MaxStatements: 10, FlushInterval: time.Hour})
+
+	var futures []*WriteFuture
+	for i := 0; i < 25; i++ {
+		future, err := bw.Write(context.Background(), ParameterizedStatement{
+			Query:     "INSERT INTO foo(id) VALUES(?)",
+			Arguments: []interface{}{i},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		futures = append(futures, future)
+	}
+	if err := bw.Close(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i, future := range futures {
+		wr, err := future.Wait(context.Background())
+		if err != nil {
+			t.Fatalf("statement %d: unexpected error: %v", i, err)
+		}
+		if want := int64(i%10 + 1); wr.LastInsertID != want {
+			t.Errorf("statement %d: got last insert ID %d, want %d", i, wr.LastInsertID, want)
+		}
+	}
+
+	if got := fmt.Sprint(bs.batchSizes()); got != "[10 10 5]" {
+		t.Errorf("got batches %s, want [10 10 5]", got)
+	}
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if bs.urls[0] != "/db/execute?timings&level=weak" {
+		t.Errorf("unexpected URL: %s", bs.urls[0])
+	}
+}
+
+func TestBulkWriterMaxBytes(t *testing.T) {
+	bs := newBulkServer(t)
+	conn := openBulkConn(t, bs)
+
+	// each statement encodes to 31 bytes
+	stmt := ParameterizedStatement{Query: "INSERT INTO foo VALUES(?)", Arguments: []interface{}{1}}
+	bw := conn.NewBulkWriter(BulkWriterConfig{MaxBytes: 60, FlushInterval: time.Hour})
+	for i := 0; i < 5; i++ {
+		if _, err := bw.Write(context.Background(), stmt); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := bw.Flush(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := fmt.Sprint(bs.batchSizes()); got != "[2 2 1]" {
+		t.Errorf("got batches %s, want [2 2 1]", got)
+	}
+	bw.Close(context.Background())
+}
+
+func TestBulkWriterInterval(t *testing.T) {
+	bs := newBulkServer(t)
+	conn := openBulkConn(t, bs)
+	bw := conn.NewBulkWriter(BulkWriterConfig{FlushInterval: 5 * time.Millisecond})
+	defer bw.Close(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	wr, err := bw.WriteOne(ctx, ParameterizedStatement{Query: "INSERT INTO foo VALUES(1)"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if wr.RowsAffected != 1 {
+		t.Errorf("got %d rows affected, want 1", wr.RowsAffected)
+	}
+}
+
+func TestBulkWriterErrors(t *testing.T) {
+	bs := newBulkServer(t)
+	conn := openBulkConn(t, bs)
+	bw := conn.NewBulkWriter(BulkWriterConfig{FlushInterval: time.Hour})
+
+	t.Run("statement error", func(t *testing.T) {
+		ok, _ := bw.Write(context.Background(), ParameterizedStatement{Query: "INSERT INTO foo VALUES(1)"})
+		bad, _ := bw.Write(context.Background(), ParameterizedStatement{Query: "FAIL"})
+		if err := bw.Flush(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := ok.Wait(context.Background()); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if _, err := bad.Wait(context.Background()); err == nil || !strings.Contains(err.Error(), "syntax error") {
+			t.Errorf("got %v, want a syntax error", err)
+		}
+	})
+
+	t.Run("unencodable statement", func(t *testing.T) {
+		_, err := bw.Write(context.Background(), ParameterizedStatement{
+			Query:     "INSERT INTO foo VALUES(?)",
+			Arguments: []interface{}{make(chan int)},
+		})
+		if err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+
+	t.Run("batch error", func(t *testing.T) {
+		conn.Close()
+		future, _ := bw.Write(context.Background(), ParameterizedStatement{Query: "INSERT INTO foo VALUES(1)"})
+		if err := bw.Flush(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := future.Wait(context.Background()); !errors.Is(err, ErrClosed) {
+			t.Errorf("got %v, want ErrClosed", err)
+		}
+	})
+
+	t.Run("closed writer", func(t *testing.T) {
+		if err := bw.Close(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := bw.Close(context.Background()); err != nil {
+			t.Errorf("unexpected error closing twice: %v", err)
+		}
+		if _, err := bw.Write(context.Background(), ParameterizedStatement{Query: "INSERT INTO foo VALUES(1)"}); err != ErrBulkWriterClosed {
+			t.Errorf("got %v, want ErrBulkWriterClosed", err)
+		}
+		if err := bw.Flush(context.Background()); err != ErrBulkWriterClosed {
+			t.Errorf("got %v, want ErrBulkWriterClosed", err)
+		}
+	})
+}
+
+func TestBulkWriterBackpressure(t *testing.T) {
+	bs := newBulkServer(t)
+	bs.block = make(chan struct{})
+	conn := openBulkConn(t, bs)
+	bw := conn.NewBulkWriter(BulkWriterConfig{MaxStatements: 1, MaxPending: 2, FlushInterval: time.Hour})
+
+	stmt := ParameterizedStatement{Query: "INSERT INTO foo VALUES(1)"}
+
+	// one statement in flight, blocked by the server, and two pending
+	var futures []*WriteFuture
+	for i := 0; i < 3; i++ {
+		future, err := bw.Write(context.Background(), stmt)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		futures = append(futures, future)
+		if i == 0 {
+			// wait for the first batch to be picked up
+			for len(bw.in) > 0 {
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := bw.Write(ctx, stmt); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want a deadline exceeded error", err)
+	}
+
+	close(bs.block)
+	for _, future := range futures {
+		if _, err := future.Wait(context.Background()); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	bw.Close(context.Background())
+}
+
+func TestBulkWriterCloseRace(t *testing.T) {
+	bs := newBulkServer(t)
+	conn := openBulkConn(t, bs)
+	stmt := ParameterizedStatement{Query: "INSERT INTO foo VALUES(1)"}
+
+	for round := 0; round < 50; round++ {
+		bw := conn.NewBulkWriter(BulkWriterConfig{MaxStatements: 10, FlushInterval: time.Hour})
+
+		// writers write until closed, Close racing with them
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var futures []*WriteFuture
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					future, err := bw.Write(context.Background(), stmt)
+					if err != nil {
+						if !errors.Is(err, ErrBulkWriterClosed) {
+							t.Errorf("unexpected error: %v", err)
+						}
+						return
+					}
+					mu.Lock()
+					futures = append(futures, future)
+					mu.Unlock()
+				}
+			}()
+		}
+		time.Sleep(time.Millisecond)
+		bw.Close(context.Background())
+		wg.Wait()
+
+		// every statement let in before Close is sent
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		for _, future := range futures {
+			if _, err := future.Wait(ctx); err != nil {
+				cancel()
+				t.Fatalf("round %d: unexpected error: %v", round, err)
+			}
+		}
+		cancel()
+	}
+}
+
+func TestBulkWriterCloseDeadline(t *testing.T) {
+	bs := newBulkServer(t)
+	bs.block = make(chan struct{})
+	conn := openBulkConn(t, bs)
+	bw := conn.NewBulkWriter(BulkWriterConfig{MaxStatements: 1, MaxPending: 1, FlushInterval: time.Hour})
+
+	stmt := ParameterizedStatement{Query: "INSERT INTO foo VALUES(1)"}
+
+	// one statement in flight, blocked by the server, one pending, and
+	// one write blocked waiting for room
+	var futures []*WriteFuture
+	for i := 0; i < 2; i++ {
+		future, err := bw.Write(context.Background(), stmt)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		futures = append(futures, future)
+		if i == 0 {
+			for len(bw.in) > 0 {
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}
+	blocked := make(chan error)
+	go func() {
+		_, err := bw.Write(context.Background(), stmt)
+		blocked <- err
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := bw.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want a deadline exceeded error", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Close took %s past its deadline", elapsed)
+	}
+	if err := <-blocked; !errors.Is(err, ErrBulkWriterClosed) {
+		t.Errorf("got %v for the blocked write, want ErrBulkWriterClosed", err)
+	}
+
+	close(bs.block)
+	for _, future := range futures {
+		if _, err := future.Wait(context.Background()); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if err := bw.Close(context.Background()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/rqlite/gorqlite"
 )
@@ -72,6 +73,17 @@ func TestClosedConnection(t *testing.T) {
 		}
 	})
 
+	t.Run("SetFreshness", func(t *testing.T) {
+		err := conn.SetFreshness(time.Second, false)
+		if err == nil {
+			t.Errorf("expected error, got nil")
+		}
+
+		if !errors.Is(err, gorqlite.ErrClosed) {
+			t.Errorf("expected error to be ErrClosed, got %v", err)
+		}
+	})
+
 	t.Run("WriteOne", func(t *testing.T) {
 		_, err := conn.WriteOne("")
 		if err == nil {
@@ -248,6 +260,83 @@ func TestClosedConnection(t *testing.T) {
 		}
 	})
 
+	t.Run("QueueAndWait", func(t *testing.T) {
+		_, err := conn.QueueAndWait([]string{})
+		if err == nil {
+			t.Errorf("expected error, got nil")
+		}
+
+		if !errors.Is(err, gorqlite.ErrClosed) {
+			t.Errorf("expected error to be ErrClosed, got %v", err)
+		}
+	})
+
+	t.Run("QueueAndWaitContext", func(t *testing.T) {
+		_, err := conn.QueueAndWaitContext(context.Background(), []string{})
+		if err == nil {
+			t.Errorf("expected error, got nil")
+		}
+
+		if !errors.Is(err, gorqlite.ErrClosed) {
+			t.Errorf("expected error to be ErrClosed, got %v", err)
+		}
+	})
+
+	t.Run("QueueParameterizedAndWait", func(t *testing.T) {
+		_, err := conn.QueueParameterizedAndWait([]gorqlite.ParameterizedStatement{})
+		if err == nil {
+			t.Errorf("expected error, got nil")
+		}
+
+		if !errors.Is(err, gorqlite.ErrClosed) {
+			t.Errorf("expected error to be ErrClosed, got %v", err)
+		}
+	})
+
+	t.Run("QueueParameterizedAndWaitContext", func(t *testing.T) {
+		_, err := conn.QueueParameterizedAndWaitContext(context.Background(), []gorqlite.ParameterizedStatement{})
+		if err == nil {
+			t.Errorf("expected error, got nil")
+		}
+
+		if !errors.Is(err, gorqlite.ErrClosed) {
+			t.Errorf("expected error to be ErrClosed, got %v", err)
+		}
+	})
+
+	t.Run("Flush", func(t *testing.T) {
+		_, err := conn.Flush()
+		if err == nil {
+			t.Errorf("expected error, got nil")
+		}
+
+		if !errors.Is(err, gorqlite.ErrClosed) {
+			t.Errorf("expected error to be ErrClosed, got %v", err)
+		}
+	})
+
+	t.Run("FlushContext", func(t *testing.T) {
+		_, err := conn.FlushContext(context.Background())
+		if err == nil {
+			t.Errorf("expected error, got nil")
+		}
+
+		if !errors.Is(err, gorqlite.ErrClosed) {
+			t.Errorf("expected error to be ErrClosed, got %v", err)
+		}
+	})
+
+	t.Run("WaitForSequence", func(t *testing.T) {
+		err := conn.WaitForSequence(context.Background(), 1)
+		if err == nil {
+			t.Errorf("expected error, got nil")
+		}
+
+		if !errors.Is(err, gorqlite.ErrClosed) {
+			t.Errorf("expected error to be ErrClosed, got %v", err)
+		}
+	})
+
 	t.Run("QueryOne", func(t *testing.T) {
 		_, err := conn.QueryOne("")
 		if err == nil {
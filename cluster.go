@@ -7,8 +7,11 @@ package gorqlite
 		peer
 		rqliteCluster
 	Connection methods:
+		getCluster, setCluster (the cluster info, safe for concurrent use)
 		assembleURL (from a peer)
 		updateClusterInfo (does the full cluster discovery via status)
+
+	DNS based discovery lives in discovery.go
 */
 
 /* *****************************************************************
@@ -21,6 +24,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"net"
 	"net/url"
 	"strings"
 )
@@ -49,6 +53,21 @@ func (rc *rqliteCluster) PeerList() []peer {
 	return rc.peerList
 }
 
+// getCluster returns the current cluster info. Its peer lists are
+// never modified once set, so they may be read without the lock.
+func (conn *Connection) getCluster() rqliteCluster {
+	conn.clusterMu.RLock()
+	defer conn.clusterMu.RUnlock()
+	return conn.cluster
+}
+
+// setCluster replaces the cluster info
+func (conn *Connection) setCluster(rc rqliteCluster) {
+	conn.clusterMu.Lock()
+	defer conn.clusterMu.Unlock()
+	conn.cluster = rc
+}
+
 // tell it what peer to talk to and what kind of API operation you're
 // making, and it will return the full URL, from start to finish.
 // e.g.:
@@ -57,7 +76,10 @@ func (rc *rqliteCluster) PeerList() []peer {
 //
 // note: this func needs to live at the Connection level because the
 // Connection holds the username, password, consistencyLevel, etc.
-func (conn *Connection) assembleURL(apiOp apiOperation, p peer) string {
+// The settings of this very request (consistency level, transaction,
+// queueing, ...) come from the Connection, overridden by the request
+// options, see requestSettings().
+func (conn *Connection) assembleURL(apiOp apiOperation, p peer, rs requestSettings) string {
 	var builder strings.Builder
 
 	if conn.wantsHTTPS {
@@ -85,30 +107,59 @@ func (conn *Connection) assembleURL(apiOp apiOperation, p peer) string {
 		builder.WriteString("/db/execute")
 	case api_REQUEST:
 		builder.WriteString("/db/request")
+	case api_BACKUP:
+		builder.WriteString("/db/backup")
+	case api_LOAD:
+		builder.WriteString("/db/load")
+	case api_READYZ:
+		builder.WriteString("/readyz")
 	}
 
 	if apiOp == api_QUERY || apiOp == api_WRITE || apiOp == api_REQUEST {
 		builder.WriteString("?timings&level=")
-		builder.WriteString(consistencyLevelToString[conn.consistencyLevel])
-		if conn.wantsTransactions {
+		builder.WriteString(consistencyLevelToString[rs.consistencyLevel])
+		if rs.consistencyLevel == ConsistencyLevelNone && rs.freshness > 0 {
+			builder.WriteString("&freshness=")
+			builder.WriteString(rs.freshness.String())
+			if rs.freshnessStrict {
+				builder.WriteString("&freshness_strict")
+			}
+		}
+		if rs.transaction {
 			builder.WriteString("&transaction")
 		}
-		if apiOp == api_WRITE && conn.wantsQueueing {
+		if apiOp == api_WRITE && rs.queue {
 			builder.WriteString("&queue")
+			if rs.queueWait {
+				builder.WriteString("&wait")
+			}
 		}
+		if rs.redirect {
+			builder.WriteString("&redirect")
+		}
+	}
+
+	if apiOp == api_BACKUP && rs.backupFormat == BackupFormatSQL {
+		builder.WriteString("?fmt=sql")
 	}
 
 	switch apiOp {
 	case api_QUERY:
-		trace("%s: assembled URL for an api_QUERY: %s", conn.ID, builder.String())
+		trace("%s: assembled URL for an api_QUERY: %s", conn.ID, redactURL(builder.String()))
 	case api_STATUS:
-		trace("%s: assembled URL for an api_STATUS: %s", conn.ID, builder.String())
+		trace("%s: assembled URL for an api_STATUS: %s", conn.ID, redactURL(builder.String()))
 	case api_NODES:
-		trace("%s: assembled URL for an api_NODES: %s", conn.ID, builder.String())
+		trace("%s: assembled URL for an api_NODES: %s", conn.ID, redactURL(builder.String()))
 	case api_WRITE:
-		trace("%s: assembled URL for an api_WRITE: %s", conn.ID, builder.String())
+		trace("%s: assembled URL for an api_WRITE: %s", conn.ID, redactURL(builder.String()))
 	case api_REQUEST:
-		trace("%s: assembled URL for an api_REQUEST: %s", conn.ID, builder.String())
+		trace("%s: assembled URL for an api_REQUEST: %s", conn.ID, redactURL(builder.String()))
+	case api_BACKUP:
+		trace("%s: assembled URL for an api_BACKUP: %s", conn.ID, redactURL(builder.String()))
+	case api_LOAD:
+		trace("%s: assembled URL for an api_LOAD: %s", conn.ID, redactURL(builder.String()))
+	case api_READYZ:
+		trace("%s: assembled URL for an api_READYZ: %s", conn.ID, redactURL(builder.String()))
 	}
 
 	return builder.String()
@@ -119,14 +170,28 @@ func (conn *Connection) assembleURL(apiOp apiOperation, p peer) string {
 // with current info.
 //
 // The web heavy lifting (retrying, etc.) is done in rqliteApiGet()
-func (conn *Connection) updateClusterInfo() error {
+//
+// With DNS based discovery, the peer list is re-resolved first, so
+// that the status call goes to nodes that currently exist. Resolved
+// peers not reported by rqlite, under any name resolving to the same
+// address, are kept as fallbacks.
+func (conn *Connection) updateClusterInfo(ctx context.Context) error {
 	trace("%s: updateClusterInfo() called", conn.ID)
 
+	var resolved []peer
+	if conn.discoveryMode != DiscoveryModeNone {
+		var err error
+		if resolved, err = conn.resolvePeers(ctx); err != nil {
+			return err
+		}
+		conn.setCluster(conn.resolvedCluster(resolved))
+	}
+
 	// start with a fresh new cluster
 	var rc rqliteCluster
 	rc.conn = conn
 
-	responseBody, err := conn.rqliteApiGet(context.Background(), api_STATUS)
+	responseBody, err := conn.rqliteApiGet(ctx, api_STATUS)
 	if err != nil {
 		return err
 	}
@@ -172,7 +237,7 @@ func (conn *Connection) updateClusterInfo() error {
 	if rc.leader == "" {
 		// nodes/ API is available in 6.0+
 		trace("getting leader from metadata failed, trying nodes/")
-		responseBody, err := conn.rqliteApiGet(context.Background(), api_NODES)
+		responseBody, err := conn.rqliteApiGet(ctx, api_NODES)
 		if err != nil {
 			return errors.New("could not determine leader from API nodes call")
 		}
@@ -214,6 +279,26 @@ func (conn *Connection) updateClusterInfo() error {
 		rc.peerList = append(rc.peerList, rc.leader)
 	}
 
+	if len(resolved) > 0 {
+		known := make(map[string]bool)
+		for _, p := range rc.peerList {
+			conn.addPeerAddrs(ctx, known, p)
+		}
+		for _, p := range rc.otherPeers {
+			conn.addPeerAddrs(ctx, known, p)
+		}
+		for _, p := range resolved {
+			addrs := make(map[string]bool)
+			conn.addPeerAddrs(ctx, addrs, p)
+			if !sharesAddr(known, addrs) {
+				rc.otherPeers = append(rc.otherPeers, p)
+				for addr := range addrs {
+					known[addr] = true
+				}
+			}
+		}
+	}
+
 	rc.peerList = append(rc.peerList, rc.otherPeers...)
 
 	// dump to trace
@@ -224,7 +309,35 @@ func (conn *Connection) updateClusterInfo() error {
 	}
 
 	// now make it official
-	conn.cluster = rc
+	conn.setCluster(rc)
+	conn.log(ctx, LogLevelDebug, "cluster updated", "leader", string(rc.leader), "peers", len(rc.peerList))
 
 	return nil
 }
+
+// addPeerAddrs adds the host:port addresses the peer resolves to, or the
+// peer itself if its host can't be resolved
+func (conn *Connection) addPeerAddrs(ctx context.Context, addrs map[string]bool, p peer) {
+	addrs[string(p)] = true
+	host, port, err := net.SplitHostPort(string(p))
+	if err != nil || net.ParseIP(host) != nil {
+		return
+	}
+	ips, err := conn.resolver.LookupHost(ctx, host)
+	if err != nil {
+		trace("%s: could not resolve peer %s: %s", conn.ID, p, err.Error())
+		return
+	}
+	for _, ip := range ips {
+		addrs[net.JoinHostPort(ip, port)] = true
+	}
+}
+
+func sharesAddr(known, addrs map[string]bool) bool {
+	for addr := range addrs {
+		if known[addr] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,396 @@
+package main
+
+/*
+	this file contains the generation of the Go code of the queries
+*/
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/rqlite/gorqlite/internal/sqltype"
+)
+
+// goKind classifies a declared type by the Go type its values scan into:
+// time for the types gorqlite reads as times, bool for the numeric BOOL
+// types, and otherwise following their affinity
+func goKind(declType string) string {
+	switch {
+	case declType == "":
+		return ""
+	case sqltype.IsTime(declType):
+		return "time"
+	}
+	switch sqltype.AffinityOf(declType) {
+	case sqltype.Integer:
+		return "int"
+	case sqltype.Text:
+		return "string"
+	case sqltype.Blob:
+		return "bytes"
+	case sqltype.Numeric:
+		if strings.Contains(sqltype.Name(declType), "BOOL") {
+			return "bool"
+		}
+	}
+	return "float"
+}
+
+var (
+	plainTypes = map[string]string{
+		"int": "int64", "string": "string", "float": "float64", "bool": "bool", "time": "time.Time", "bytes": "[]byte",
+	}
+	nullTypes = map[string]string{
+		"int": "gorqlite.NullInt64", "string": "gorqlite.NullString", "float": "gorqlite.NullFloat64",
+		"bool": "gorqlite.NullBool", "time": "gorqlite.NullTime", "bytes": "[]byte",
+	}
+)
+
+// resultType returns the Go type a result column scans into
+func resultType(c column) (string, error) {
+	kind := goKind(c.declType)
+	if kind == "" {
+		return "", fmt.Errorf("column %s has no declared type, use CAST(... AS type)", c.name)
+	}
+	if c.notNull {
+		return plainTypes[kind], nil
+	}
+	return nullTypes[kind], nil
+}
+
+// paramType returns the Go type of a parameter: the type of its column,
+// a pointer to it if NULL may be assigned, or interface{} if unknown
+func paramType(p param) string {
+	if p.column == nil {
+		return "interface{}"
+	}
+	kind := goKind(p.column.declType)
+	if kind == "" {
+		return "interface{}"
+	}
+	if p.assigned && !p.column.notNull && kind != "bytes" {
+		return "*" + plainTypes[kind]
+	}
+	return plainTypes[kind]
+}
+
+// initialisms are written in capitals in Go names
+var initialisms = map[string]bool{
+	"ACL": true, "API": true, "CSV": true, "DB": true, "HTML": true, "HTTP": true, "ID": true, "IP": true,
+	"JSON": true, "SQL": true, "TLS": true, "TTL": true, "UI": true, "URI": true, "URL": true,
+	"UUID": true, "XML": true,
+}
+
+// goName turns an SQL name into an exported Go name: user_id is UserID
+func goName(name string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if initialisms[strings.ToUpper(word)] {
+			b.WriteString(strings.ToUpper(word))
+			continue
+		}
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	s := b.String()
+	if s == "" || unicode.IsDigit([]rune(s)[0]) {
+		s = "X" + s
+	}
+	return s
+}
+
+// localName turns an SQL name into an unexported Go name: user_id is userID
+func localName(name string) string {
+	s := goName(name)
+	// lower the leading initialism, or letter
+	runes := []rune(s)
+	i := 0
+	for i < len(runes) && unicode.IsUpper(runes[i]) {
+		i++
+	}
+	if i > 1 && i < len(runes) {
+		i--
+	}
+	for k := 0; k < i; k++ {
+		runes[k] = unicode.ToLower(runes[k])
+	}
+	if s = string(runes); token.IsKeyword(s) {
+		s += "_"
+	}
+	return s
+}
+
+// singular naively turns a table name into the name of a row: users
+// is user, categories is category
+func singular(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, "ies") && len(name) > 3:
+		return name[:len(name)-3] + "y"
+	case strings.HasSuffix(lower, "sses"), strings.HasSuffix(lower, "xes"), strings.HasSuffix(lower, "ches"), strings.HasSuffix(lower, "shes"):
+		return name[:len(name)-2]
+	case strings.HasSuffix(lower, "s") && !strings.HasSuffix(lower, "ss") && len(name) > 1:
+		return name[:len(name)-1]
+	}
+	return name
+}
+
+// generator writes the Go code of the queries
+type generator struct {
+	buf    bytes.Buffer
+	schema *schema
+	// models are the Go types of the rows of the tables, by table name
+	models map[string]string
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// generate returns the formatted Go code of the queries
+func generate(pkg string, sources []string, s *schema, queries []*query) ([]byte, error) {
+	g := &generator{schema: s, models: make(map[string]string)}
+
+	if err := g.modelTypes(); err != nil {
+		return nil, err
+	}
+	for _, q := range queries {
+		if err := g.query(q); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", q.pos, q.name, err)
+		}
+	}
+	code := g.buf.String()
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by gorqlite-gen from %s. DO NOT EDIT.\n\n", strings.Join(sources, ", "))
+	fmt.Fprintf(&out, "package %s\n\nimport (\n\t\"context\"\n", pkg)
+	if strings.Contains(code, "sql.ErrNoRows") {
+		out.WriteString("\t\"database/sql\"\n")
+	}
+	if strings.Contains(code, "time.Time") {
+		out.WriteString("\t\"time\"\n")
+	}
+	out.WriteString("\n\t\"github.com/rqlite/gorqlite\"\n)\n\n")
+	out.WriteString("// Queries runs the generated queries on a gorqlite.Connection.\n")
+	out.WriteString("type Queries struct {\n\tconn *gorqlite.Connection\n}\n\n")
+	out.WriteString("// New returns the Queries running on conn.\n")
+	out.WriteString("func New(conn *gorqlite.Connection) *Queries {\n\treturn &Queries{conn: conn}\n}\n\n")
+	out.WriteString(code)
+	if strings.Contains(code, "blobArg(") {
+		out.WriteString(blobArg)
+	}
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting the generated code: %w\n%s", err, out.Bytes())
+	}
+	return src, nil
+}
+
+// blobArg is written along the queries taking blobs: a JSON string would
+// be stored as text, so they are sent as arrays of bytes, which rqlite
+// binds as blobs
+const blobArg = `
+// blobArg returns b as the array of its bytes, which rqlite binds as a
+// blob, or nil for NULL.
+func blobArg(b []byte) interface{} {
+	if b == nil {
+		return nil
+	}
+	bytes := make([]int, len(b))
+	for i, c := range b {
+		bytes[i] = int(c)
+	}
+	return bytes
+}
+`
+
+// modelTypes writes a struct for the rows of every table
+func (g *generator) modelTypes() error {
+	used := make(map[string]bool)
+	for _, t := range g.schema.tables {
+		name := goName(singular(t.name))
+		if used[name] {
+			return fmt.Errorf("tables %s and another both have %s for rows", t.name, name)
+		}
+		if err := g.structType(name, fmt.Sprintf("%s is a row of the %s table.", name, t.name), t.columns); err != nil {
+			// a row can't be scanned, so there is no model for it
+			continue
+		}
+		used[name] = true
+		g.models[t.name] = name
+	}
+	return nil
+}
+
+// structType writes a struct with a field per column
+func (g *generator) structType(name, doc string, columns []column) error {
+	var fields bytes.Buffer
+	names := make(map[string]bool)
+	for _, c := range columns {
+		typ, err := resultType(c)
+		if err != nil {
+			return err
+		}
+		field := goName(c.name)
+		if names[field] {
+			return fmt.Errorf("columns named %s twice", field)
+		}
+		names[field] = true
+		fmt.Fprintf(&fields, "\t%s %s\n", field, typ)
+	}
+	g.printf("// %s\ntype %s struct {\n%s}\n\n", doc, name, fields.String())
+	return nil
+}
+
+// rowType returns the Go type of the rows of a query: the model of a
+// table if the columns are the table's, or else a new struct
+func (g *generator) rowType(q *query) (string, error) {
+	for _, t := range g.schema.tables {
+		model, ok := g.models[t.name]
+		if ok && sameColumns(t.columns, q.columns) {
+			return model, nil
+		}
+	}
+	name := q.name + "Row"
+	return name, g.structType(name, fmt.Sprintf("%s is a row of %s.", name, q.name), q.columns)
+}
+
+func sameColumns(a, b []column) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].name != b[i].name || goKind(a[i].declType) != goKind(b[i].declType) || a[i].notNull != b[i].notNull {
+			return false
+		}
+	}
+	return true
+}
+
+// args names the Go parameters of a query, returning the declaration
+// and the Arguments of the statement
+func args(q *query) (string, string) {
+	var decls []string
+	var values []string
+	used := map[string]bool{"ctx": true, "q": true}
+	byParam := make(map[string]string)
+	for i, p := range q.params {
+		sqlName := p.name
+		if sqlName == "" {
+			sqlName = fmt.Sprintf("arg%d", i+1)
+		}
+		if q.named {
+			if _, done := byParam[sqlName]; done {
+				continue
+			}
+		}
+
+		name := localName(sqlName)
+		for n := 2; used[name]; n++ {
+			name = localName(sqlName) + strconv.Itoa(n)
+		}
+		used[name] = true
+		byParam[sqlName] = name
+		typ := paramType(p)
+		decls = append(decls, name+" "+typ)
+		value := name
+		if typ == "[]byte" {
+			value = "blobArg(" + name + ")"
+		}
+		if q.named {
+			values = append(values, fmt.Sprintf("%q: %s", sqlName, value))
+		} else {
+			values = append(values, value)
+		}
+	}
+
+	if len(values) == 0 {
+		return strings.Join(decls, ", "), ""
+	}
+	if q.named {
+		return strings.Join(decls, ", "), "[]interface{}{map[string]interface{}{" + strings.Join(values, ", ") + "}}"
+	}
+	return strings.Join(decls, ", "), "[]interface{}{" + strings.Join(values, ", ") + "}"
+}
+
+// quoteSQL quotes the SQL of a query as a Go string
+func quoteSQL(sql string) string {
+	if strings.Contains(sql, "`") || strings.Contains(sql, "\r") {
+		return strconv.Quote(sql)
+	}
+	return "`" + sql + "`"
+}
+
+// query writes the constant and method of a query
+func (g *generator) query(q *query) error {
+	constName := localName(q.name)
+	g.printf("const %s = %s\n\n", constName, quoteSQL(q.sql))
+
+	var rowType string
+	if q.kind == kindOne || q.kind == kindMany {
+		var err error
+		if rowType, err = g.rowType(q); err != nil {
+			return err
+		}
+	}
+
+	if len(q.doc) == 0 {
+		q.doc = []string{fmt.Sprintf("%s runs the %s query.", q.name, constName)}
+	}
+	for _, line := range q.doc {
+		g.printf("// %s\n", line)
+	}
+	decls, arguments := args(q)
+	if decls != "" {
+		decls = ", " + decls
+	}
+	stmt := "gorqlite.ParameterizedStatement{\n\t\tQuery: " + constName + ",\n"
+	if arguments != "" {
+		stmt += "\t\tArguments: " + arguments + ",\n"
+	}
+	stmt += "\t}"
+
+	var scan []string
+	for _, c := range q.columns {
+		scan = append(scan, "&row."+goName(c.name))
+	}
+
+	switch q.kind {
+	case kindOne:
+		g.printf("func (q *Queries) %s(ctx context.Context%s) (%s, error) {\n", q.name, decls, rowType)
+		g.printf("\tqr, err := q.conn.QueryOneParameterizedContext(ctx, %s)\n", stmt)
+		g.printf("\tvar row %s\n\tif err != nil {\n\t\treturn row, err\n\t}\n", rowType)
+		g.printf("\tif !qr.Next() {\n\t\treturn row, sql.ErrNoRows\n\t}\n")
+		g.printf("\terr = qr.Scan(%s)\n\treturn row, err\n}\n\n", strings.Join(scan, ", "))
+	case kindMany:
+		g.printf("func (q *Queries) %s(ctx context.Context%s) ([]%s, error) {\n", q.name, decls, rowType)
+		g.printf("\tqr, err := q.conn.QueryOneParameterizedContext(ctx, %s)\n", stmt)
+		g.printf("\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+		g.printf("\trows := make([]%s, 0, qr.NumRows())\n\tfor qr.Next() {\n\t\tvar row %s\n", rowType, rowType)
+		g.printf("\t\tif err := qr.Scan(%s); err != nil {\n\t\t\treturn nil, err\n\t\t}\n", strings.Join(scan, ", "))
+		g.printf("\t\trows = append(rows, row)\n\t}\n\treturn rows, nil\n}\n\n")
+	case kindExec:
+		g.printf("func (q *Queries) %s(ctx context.Context%s) error {\n", q.name, decls)
+		g.printf("\t_, err := q.conn.WriteOneParameterizedContext(ctx, %s)\n\treturn err\n}\n\n", stmt)
+	case kindExecResult:
+		g.printf("func (q *Queries) %s(ctx context.Context%s) (gorqlite.WriteResult, error) {\n", q.name, decls)
+		g.printf("\treturn q.conn.WriteOneParameterizedContext(ctx, %s)\n}\n\n", stmt)
+	case kindExecRows, kindExecLastID:
+		field := "RowsAffected"
+		if q.kind == kindExecLastID {
+			field = "LastInsertID"
+		}
+		g.printf("func (q *Queries) %s(ctx context.Context%s) (int64, error) {\n", q.name, decls)
+		g.printf("\twr, err := q.conn.WriteOneParameterizedContext(ctx, %s)\n\treturn wr.%s, err\n}\n\n", stmt, field)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+// Command gorqlite-gen generates type-safe Go functions from annotated
+// SQL queries, calling the parameterized methods of gorqlite.Connection.
+//
+// Usage:
+//
+//	gorqlite-gen [-schema PATH,...] [-url URL] [-package NAME] [-o FILE] QUERIES.sql...
+//
+// Every query is preceded by an annotation naming it, and telling what
+// it returns, the comments right after becoming its documentation:
+//
+//	-- name: GetUser :one
+//	-- GetUser returns a user by ID.
+//	SELECT * FROM users WHERE id = ?;
+//
+// The kinds of queries are:
+//
+//	:one          the first row, or sql.ErrNoRows
+//	:many         all the rows
+//	:exec         the error only
+//	:execresult   the gorqlite.WriteResult
+//	:execrows     the number of rows affected
+//	:execlastid   the ID of the last row inserted
+//
+// The result columns and the parameters are typed from the schema: the
+// CREATE TABLE statements of the -schema files, applied in order, or the
+// migrations of the -schema directories, or else the live schema of the
+// database at -url. A row of a table gets a struct of its own, and a
+// query returning other columns gets a struct named after it. A column
+// that may be NULL is a gorqlite.NullString and the like, a parameter
+// assigned to it a pointer.
+//
+// Parameters are either all positional, ?, or all named, :name, @name
+// or $name. The name of a positional one comes from the column it is
+// compared or assigned to, and its type is interface{} when there is
+// no such column. Expressions in the results need an alias, and a CAST
+// when their type can't be told.
+//
+// It is meant for go generate:
+//
+//	//go:generate go run github.com/rqlite/gorqlite/cmd/gorqlite-gen -schema migrations queries.sql
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const defaultOutput = "queries.gen.go"
+
+// stdout and stderr are variables for the tests
+var (
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+)
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	flags := flag.NewFlagSet("gorqlite-gen", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	schemaPaths := flags.String("schema", "", "comma-separated SQL files or migration directories with the schema")
+	connURL := flags.String("url", "", "rqlite connection URL to read the schema from, instead of -schema")
+	defaultPackage := os.Getenv("GOPACKAGE")
+	if defaultPackage == "" {
+		defaultPackage = "db"
+	}
+	pkg := flags.String("package", defaultPackage, "package of the generated code")
+	output := flags.String("o", defaultOutput, "file to write the generated code to, - for stdout")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: gorqlite-gen [flags] QUERIES.sql...\n\nflags:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 || (*schemaPaths == "") == (*connURL == "") {
+		fmt.Fprintf(stderr, "gorqlite-gen: want query files, and either -schema or -url\n")
+		flags.Usage()
+		return 2
+	}
+
+	if err := gen(*schemaPaths, *connURL, *pkg, *output, flags.Args()); err != nil {
+		fmt.Fprintf(stderr, "gorqlite-gen: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// gen generates the code of the queries of files
+func gen(schemaPaths, connURL, pkg, output string, files []string) error {
+	var s *schema
+	var err error
+	if connURL != "" {
+		s, err = liveSchema(context.Background(), connURL)
+	} else {
+		s, err = readSchema(strings.Split(schemaPaths, ","))
+	}
+	if err != nil {
+		return err
+	}
+
+	var queries []*query
+	var sources []string
+	names := make(map[string]string)
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		parsed, err := parseQueries(s, file, string(content))
+		if err != nil {
+			return err
+		}
+		for _, q := range parsed {
+			if pos, ok := names[q.name]; ok {
+				return fmt.Errorf("%s: query %s already defined at %s", q.pos, q.name, pos)
+			}
+			names[q.name] = q.pos
+		}
+		queries = append(queries, parsed...)
+		sources = append(sources, filepath.Base(file))
+	}
+
+	src, err := generate(pkg, sources, s, queries)
+	if err != nil {
+		return err
+	}
+	if output == "-" {
+		_, err = stdout.Write(src)
+		return err
+	}
+	return os.WriteFile(output, src, 0o644)
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+const testSchema = `
+CREATE TABLE teams (id INTEGER PRIMARY KEY, name TEXT NOT NULL UNIQUE);
+CREATE TABLE IF NOT EXISTS "users" (
+  id INTEGER,
+  team_id INTEGER REFERENCES teams (id),
+  email VARCHAR(255) NOT NULL,
+  score DECIMAL(10, 2) DEFAULT 0,
+  created_at DATETIME NOT NULL,
+  PRIMARY KEY (id)
+);
+ALTER TABLE users ADD COLUMN bio TEXT;
+ALTER TABLE users RENAME COLUMN bio TO about;
+CREATE TABLE dropped (id INTEGER);
+DROP TABLE dropped;
+INSERT INTO teams (name) VALUES ('ignored');
+CREATE VIEW team_sizes AS SELECT t.name, count(*) AS size FROM teams t JOIN users u ON u.team_id = t.id GROUP BY t.name;
+`
+
+func testSchemaOf(t *testing.T) *schema {
+	t.Helper()
+	s := &schema{}
+	if err := s.apply(testSchema); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return s
+}
+
+func TestSchema(t *testing.T) {
+	s := testSchemaOf(t)
+
+	var names []string
+	for _, tbl := range s.tables {
+		names = append(names, tbl.name)
+	}
+	if !reflect.DeepEqual(names, []string{"teams", "users", "team_sizes"}) {
+		t.Fatalf("unexpected tables: %v", names)
+	}
+
+	want := []column{
+		{name: "id", declType: "INTEGER", notNull: true},
+		{name: "team_id", declType: "INTEGER"},
+		{name: "email", declType: "VARCHAR(255)", notNull: true},
+		{name: "score", declType: "DECIMAL(10,2)"},
+		{name: "created_at", declType: "DATETIME", notNull: true},
+		{name: "about", declType: "TEXT"},
+	}
+	if got := s.table("USERS").columns; !reflect.DeepEqual(got, want) {
+		t.Errorf("got columns %+v\nwant %+v", got, want)
+	}
+
+	want = []column{{name: "name", declType: "TEXT", notNull: true}, {name: "size", declType: "INTEGER", notNull: true}}
+	if got := s.table("team_sizes").columns; !reflect.DeepEqual(got, want) {
+		t.Errorf("got view columns %+v\nwant %+v", got, want)
+	}
+
+	if err := (&schema{}).apply("ALTER TABLE missing ADD COLUMN a TEXT"); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
+
+func TestReadSchemaMigrations(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"1_teams.up.sql":   "CREATE TABLE teams (id INTEGER PRIMARY KEY);",
+		"1_teams.down.sql": "DROP TABLE teams;",
+		"2_name.up.sql":    "ALTER TABLE teams ADD name TEXT;",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := readSchema([]string{dir})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tbl := s.table("teams"); tbl == nil || len(tbl.columns) != 2 {
+		t.Errorf("unexpected schema: %+v", s.tables)
+	}
+}
+
+func TestParseQueries(t *testing.T) {
+	s := testSchemaOf(t)
+	queries, err := parseQueries(s, "queries.sql", `
+-- name: GetUser :one
+-- GetUser returns a user.
+SELECT * FROM users WHERE id = ?;
+
+-- name: ListUsers :many
+SELECT u.id, u.email AS address, t.name, upper(u.about) AS about
+FROM users u LEFT JOIN teams t ON t.id = u.team_id
+WHERE u.team_id = :team AND u.created_at BETWEEN :from AND :to OR t.id = :team
+LIMIT :limit;
+
+-- name: Stats :one
+SELECT count(*) AS n, max(score) AS best, coalesce(sum(score), 0) AS total, CAST(avg(id) AS INTEGER) AS mean FROM users;
+
+-- name: CreateUser :execlastid
+INSERT INTO users (email, created_at, about) VALUES (?, ?, ?);
+
+-- name: SetAbout :execrows
+UPDATE users SET about = ? WHERE id = ? AND ? > 0;
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(queries) != 5 {
+		t.Fatalf("got %d queries, want 5", len(queries))
+	}
+
+	get := queries[0]
+	if get.name != "GetUser" || get.kind != kindOne || get.sql != "SELECT * FROM users WHERE id = ?" ||
+		!reflect.DeepEqual(get.doc, []string{"GetUser returns a user."}) || len(get.columns) != 6 {
+		t.Errorf("unexpected query: %+v", get)
+	}
+
+	list := queries[1]
+	var columns []string
+	for _, c := range list.columns {
+		typ, _ := resultType(c)
+		columns = append(columns, c.name+" "+typ)
+	}
+	want := []string{"id int64", "address string", "name gorqlite.NullString", "about gorqlite.NullString"}
+	if !reflect.DeepEqual(columns, want) {
+		t.Errorf("got columns %v, want %v", columns, want)
+	}
+	decls, arguments := args(list)
+	if decls != "team int64, from time.Time, to time.Time, limit int64" {
+		t.Errorf("unexpected parameters: %s", decls)
+	}
+	if arguments != `[]interface{}{map[string]interface{}{"team": team, "from": from, "to": to, "limit": limit}}` {
+		t.Errorf("unexpected arguments: %s", arguments)
+	}
+
+	columns = nil
+	for _, c := range queries[2].columns {
+		typ, _ := resultType(c)
+		columns = append(columns, c.name+" "+typ)
+	}
+	want = []string{"n int64", "best gorqlite.NullFloat64", "total float64", "mean gorqlite.NullInt64"}
+	if !reflect.DeepEqual(columns, want) {
+		t.Errorf("got columns %v, want %v", columns, want)
+	}
+
+	if decls, _ := args(queries[3]); decls != "email string, createdAt time.Time, about *string" {
+		t.Errorf("unexpected parameters: %s", decls)
+	}
+	if decls, _ := args(queries[4]); decls != "about *string, id int64, arg3 interface{}" {
+		t.Errorf("unexpected parameters: %s", decls)
+	}
+}
+
+func TestParseQueriesErrors(t *testing.T) {
+	s := testSchemaOf(t)
+	tests := map[string]string{
+		"unknown kind":     "-- name: A :all\nSELECT 1 AS a;",
+		"two statements":   "-- name: A :exec\nDELETE FROM users; DELETE FROM teams;",
+		"mixed parameters": "-- name: A :exec\nDELETE FROM users WHERE id = ? AND email = :email;",
+		"no alias":         "-- name: A :one\nSELECT count(*) FROM users;",
+		"unknown type":     "-- name: A :one\nSELECT id + 1 AS next FROM users;",
+		"unknown column":   "-- name: A :one\nSELECT missing FROM users;",
+		"ambiguous column": "-- name: A :one\nSELECT id FROM users JOIN teams ON teams.id = users.team_id;",
+		"duplicate column": "-- name: A :many\nSELECT users.id, teams.id FROM users JOIN teams ON teams.id = users.team_id;",
+		"no rows":          "-- name: A :one\nDELETE FROM users;",
+	}
+	for name, content := range tests {
+		if _, err := parseQueries(s, "queries.sql", content); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	tests := []struct{ sql, exported, local string }{
+		{"user_id", "UserID", "userID"},
+		{"id", "ID", "id"},
+		{"url_path", "URLPath", "urlPath"},
+		{"type", "Type", "type_"},
+		{"2fa", "X2fa", "x2fa"},
+	}
+	for _, test := range tests {
+		if got := goName(test.sql); got != test.exported {
+			t.Errorf("goName(%s): got %s, want %s", test.sql, got, test.exported)
+		}
+		if got := localName(test.sql); got != test.local {
+			t.Errorf("localName(%s): got %s, want %s", test.sql, got, test.local)
+		}
+	}
+	for name, want := range map[string]string{"users": "user", "categories": "category", "addresses": "address", "boxes": "box", "access": "access"} {
+		if got := singular(name); got != want {
+			t.Errorf("singular(%s): got %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	schemaFile := filepath.Join(dir, "schema.sql")
+	queryFile := filepath.Join(dir, "queries.sql")
+	output := filepath.Join(dir, "queries.gen.go")
+	os.WriteFile(schemaFile, []byte(testSchema), 0o644)
+	os.WriteFile(queryFile, []byte("-- name: GetUser :one\nSELECT * FROM users WHERE id = ?;\n\n"+
+		"-- name: ListSizes :many\nSELECT * FROM team_sizes;\n\n"+
+		"-- name: DeleteUser :exec\nDELETE FROM users WHERE id = ?;\n"), 0o644)
+
+	if code := run([]string{"-schema", schemaFile, "-package", "store", "-o", output, queryFile}); code != 0 {
+		t.Fatalf("got exit code %d", code)
+	}
+	src, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"// Code generated by gorqlite-gen from queries.sql. DO NOT EDIT.",
+		"package store",
+		"\t\"database/sql\"\n\t\"time\"\n",
+		"type User struct {\n\tID        int64\n\tTeamID    gorqlite.NullInt64\n",
+		"func (q *Queries) GetUser(ctx context.Context, id int64) (User, error) {",
+		"func (q *Queries) ListSizes(ctx context.Context) ([]TeamSize, error) {",
+		"// DeleteUser runs the deleteUser query.\nfunc (q *Queries) DeleteUser(ctx context.Context, id int64) error {",
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("generated code is missing %q:\n%s", want, src)
+		}
+	}
+
+	var errors bytes.Buffer
+	stderr = &errors
+	defer func() { stderr = os.Stderr }()
+	if code := run([]string{queryFile}); code != 2 {
+		t.Errorf("got exit code %d without a schema, want 2", code)
+	}
+}
+
+// TestGolden generates the code of testdata/NAME.sql, with the schema
+// of testdata/NAME.schema.sql, and compares it to testdata/NAME.gen.go.golden
+func TestGolden(t *testing.T) {
+	for _, name := range []string{"blobs"} {
+		t.Run(name, func(t *testing.T) {
+			output := filepath.Join(t.TempDir(), "queries.gen.go")
+			schemaFile := filepath.Join("testdata", name+".schema.sql")
+			if code := run([]string{"-schema", schemaFile, "-package", "store", "-o", output, filepath.Join("testdata", name+".sql")}); code != 0 {
+				t.Fatalf("got exit code %d", code)
+			}
+			got, err := os.ReadFile(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", name+".gen.go.golden")
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("generated code differs from %s:\n%s", golden, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,663 @@
+package main
+
+/*
+	this file contains the parsing of the annotated queries, and the
+	inference of their parameters and result columns from the schema
+*/
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/rqlite/gorqlite/internal/sqltok"
+)
+
+// query kinds, as in the annotations
+const (
+	kindOne        = "one"
+	kindMany       = "many"
+	kindExec       = "exec"
+	kindExecResult = "execresult"
+	kindExecRows   = "execrows"
+	kindExecLastID = "execlastid"
+)
+
+var kinds = []string{kindOne, kindMany, kindExec, kindExecResult, kindExecRows, kindExecLastID}
+
+// query is an annotated query
+type query struct {
+	name string
+	kind string
+	doc  []string
+	sql  string
+	// named tells whether the parameters are named, rather than positional
+	named   bool
+	params  []param
+	columns []column
+	// pos is the file and line of the annotation, for the errors
+	pos string
+}
+
+// param is a parameter of a query
+type param struct {
+	// name is the name of a named parameter, or the one inferred
+	name string
+	// column is the column the parameter is compared or assigned to, if known
+	column *column
+	// assigned tells whether the parameter is assigned to the column, in
+	// which case it may be NULL if the column may
+	assigned bool
+}
+
+// annotation matches the line naming a query, sqlc-style
+var annotation = regexp.MustCompile(`^\s*--\s*name:\s*(\w+)\s+:(\w+)\s*$`)
+
+// parseQueries reads the annotated queries of an SQL file
+func parseQueries(s *schema, fileName, content string) ([]*query, error) {
+	var queries []*query
+	var current *query
+	var body []string
+	inDoc := false
+
+	end := func() error {
+		if current == nil {
+			return nil
+		}
+		err := current.parse(s, strings.Join(body, "\n"))
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", current.pos, current.name, err)
+		}
+		queries = append(queries, current)
+		return nil
+	}
+
+	for i, line := range strings.Split(content, "\n") {
+		m := annotation.FindStringSubmatch(line)
+		if m == nil {
+			if current == nil {
+				continue
+			}
+			// the comments right after the annotation document the query
+			if trimmed := strings.TrimSpace(line); inDoc && strings.HasPrefix(trimmed, "--") {
+				current.doc = append(current.doc, strings.TrimSpace(strings.TrimPrefix(trimmed, "--")))
+				continue
+			}
+			inDoc = false
+			body = append(body, line)
+			continue
+		}
+
+		if err := end(); err != nil {
+			return nil, err
+		}
+		pos := fmt.Sprintf("%s:%d", fileName, i+1)
+		if !validKind(m[2]) {
+			return nil, fmt.Errorf("%s: unknown query kind :%s, want one of :%s", pos, m[2], strings.Join(kinds, ", :"))
+		}
+		current = &query{name: m[1], kind: m[2], pos: pos}
+		body = nil
+		inDoc = true
+	}
+	if err := end(); err != nil {
+		return nil, err
+	}
+	return queries, nil
+}
+
+func validKind(kind string) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// parse parses the SQL of the query, inferring its parameters, and its
+// result columns for :one and :many
+func (q *query) parse(s *schema, sql string) error {
+	statements := sqltok.Split(sql)
+	if len(statements) != 1 {
+		return fmt.Errorf("want a single statement, got %d", len(statements))
+	}
+	q.sql = statements[0].Text
+	tokens := significant(statements[0].Tokens)
+
+	if err := q.inferParams(s, tokens); err != nil {
+		return err
+	}
+	if q.kind == kindOne || q.kind == kindMany {
+		columns, err := resultColumns(s, tokens)
+		if err != nil {
+			return err
+		}
+		q.columns = columns
+	}
+	return nil
+}
+
+// tableRef is a table referenced by a statement
+type tableRef struct {
+	name  string
+	alias string
+	// table is nil for the tables not in the schema
+	table *table
+	// nullable tells that the columns may be NULL, the table being on
+	// the outer side of a join
+	nullable bool
+}
+
+// refKeywords are the keywords that can't be a table alias
+var refKeywords = map[string]bool{
+	"WHERE": true, "JOIN": true, "LEFT": true, "RIGHT": true, "FULL": true, "INNER": true,
+	"CROSS": true, "NATURAL": true, "OUTER": true, "ON": true, "USING": true, "GROUP": true,
+	"ORDER": true, "LIMIT": true, "HAVING": true, "WINDOW": true, "UNION": true, "EXCEPT": true,
+	"INTERSECT": true, "SET": true, "VALUES": true, "DEFAULT": true, "SELECT": true,
+	"RETURNING": true, "INDEXED": true, "NOT": true, "AS": true, "OFFSET": true, "END": true,
+	"NULL": true, "TRUE": true, "FALSE": true, "ELSE": true, "THEN": true, "WHEN": true,
+	"AND": true, "OR": true, "COLLATE": true, "ASC": true, "DESC": true, "FROM": true,
+}
+
+func isKeyword(tok sqltok.Token) bool {
+	return tok.Kind == sqltok.Word && refKeywords[strings.ToUpper(tok.Text)]
+}
+
+// tableRefs returns the tables referenced after FROM, JOIN, INTO and
+// UPDATE, within subqueries too if nested
+func tableRefs(s *schema, tokens []sqltok.Token, nested bool) []tableRef {
+	var refs []tableRef
+	inFrom := false
+	depth := 0
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch tok.Text {
+		case "(":
+			depth++
+			continue
+		case ")":
+			depth--
+			continue
+		}
+		if depth > 0 && !nested {
+			continue
+		}
+
+		switch {
+		case tok.Is("FROM") || tok.Is("JOIN") || tok.Is("INTO") || tok.Is("UPDATE"):
+			inFrom = tok.Is("FROM") || tok.Is("JOIN")
+		case tok.Text == "," && inFrom:
+		default:
+			if tok.Is("WHERE") || tok.Is("ON") || tok.Is("USING") || tok.Is("SELECT") || tok.Is("SET") ||
+				tok.Is("GROUP") || tok.Is("ORDER") || tok.Is("LIMIT") || tok.Is("VALUES") {
+				inFrom = false
+			}
+			continue
+		}
+
+		j := i + 1
+		if tok.Is("UPDATE") && j+1 < len(tokens) && tokens[j].Is("OR") {
+			j += 2
+		}
+		name, rest := qualifiedName(tokens[j:])
+		if name == "" || isKeyword(tokens[j]) {
+			continue
+		}
+		ref := tableRef{name: name, table: s.table(name)}
+		switch {
+		case len(rest) > 1 && rest[0].Is("AS") && isName(rest[1]):
+			ref.alias = rest[1].Ident()
+		case len(rest) > 0 && isName(rest[0]) && !isKeyword(rest[0]):
+			ref.alias = rest[0].Ident()
+		}
+
+		if tok.Is("JOIN") {
+			switch joinKind(tokens[:i]) {
+			case "LEFT":
+				ref.nullable = true
+			case "RIGHT":
+				for k := range refs {
+					refs[k].nullable = true
+				}
+			case "FULL":
+				ref.nullable = true
+				for k := range refs {
+					refs[k].nullable = true
+				}
+			}
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// joinKind returns LEFT, RIGHT or FULL for the outer joins ending tokens
+func joinKind(tokens []sqltok.Token) string {
+	for i := len(tokens) - 1; i >= 0 && i >= len(tokens)-2; i-- {
+		for _, kind := range []string{"LEFT", "RIGHT", "FULL"} {
+			if tokens[i].Is(kind) {
+				return kind
+			}
+		}
+	}
+	return ""
+}
+
+// lookup finds a column, possibly qualified by a table name or alias
+func lookup(refs []tableRef, qualifier, name string) (*column, error) {
+	var found *column
+	for _, ref := range refs {
+		if qualifier != "" && !strings.EqualFold(qualifier, ref.alias) && !strings.EqualFold(qualifier, ref.name) {
+			continue
+		}
+		if ref.table == nil {
+			if qualifier != "" {
+				return nil, fmt.Errorf("no such table: %s", ref.name)
+			}
+			continue
+		}
+		c := ref.table.column(name)
+		if c == nil {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("ambiguous column name: %s", name)
+		}
+		col := *c
+		if ref.nullable {
+			col.notNull = false
+		}
+		found = &col
+	}
+	if found == nil {
+		if qualifier != "" {
+			return nil, fmt.Errorf("no such column: %s.%s", qualifier, name)
+		}
+		return nil, fmt.Errorf("no such column: %s", name)
+	}
+	return found, nil
+}
+
+// columnAt reads a column name, possibly qualified, ending at index end
+// of tokens, returning the qualifier and the name
+func columnAt(tokens []sqltok.Token, end int) (string, string, bool) {
+	if end < 0 || !isName(tokens[end]) || isKeyword(tokens[end]) {
+		return "", "", false
+	}
+	if end >= 2 && tokens[end-1].Text == "." && isName(tokens[end-2]) {
+		return tokens[end-2].Ident(), tokens[end].Ident(), true
+	}
+	return "", tokens[end].Ident(), true
+}
+
+// comparisons are the operators a parameter is compared to a column with
+var comparisons = map[string]bool{"=": true, "==": true, "!=": true, "<>": true, "<": true, ">": true, "<=": true, ">=": true}
+
+func isComparison(tok sqltok.Token) bool {
+	return comparisons[tok.Text] || tok.Is("LIKE") || tok.Is("GLOB") || tok.Is("IS")
+}
+
+// inferParams finds the parameters of the query, with the column each
+// is compared or assigned to where it can be told
+func (q *query) inferParams(s *schema, tokens []sqltok.Token) error {
+	refs := tableRefs(s, tokens, true)
+	inserted := insertedColumns(s, tokens)
+
+	positional := 0
+	inSet := false
+	depth := 0
+	for i, tok := range tokens {
+		switch {
+		case tok.Text == "(":
+			depth++
+		case tok.Text == ")":
+			depth--
+		case tok.Is("SET") && depth == 0:
+			inSet = true
+		case (tok.Is("WHERE") || tok.Is("FROM") || tok.Is("RETURNING")) && depth == 0:
+			inSet = false
+		}
+		if tok.Kind != sqltok.Param {
+			continue
+		}
+
+		var p param
+		if tok.Text[0] == '?' {
+			if len(tok.Text) > 1 {
+				return fmt.Errorf("numbered parameters such as %s are not supported", tok.Text)
+			}
+			positional++
+		} else {
+			q.named = true
+			p.name = tok.Text[1:]
+		}
+		if positional > 0 && q.named {
+			return errors.New("mixing positional and named parameters is not supported")
+		}
+
+		qualifier, name, ok := "", "", false
+		switch {
+		case i >= 2 && isComparison(tokens[i-1]):
+			qualifier, name, ok = columnAt(tokens, i-2)
+			p.assigned = inSet && tokens[i-1].Text == "="
+		case i >= 3 && tokens[i-1].Is("NOT") && tokens[i-2].Is("IS"):
+			qualifier, name, ok = columnAt(tokens, i-3)
+		case i >= 2 && tokens[i-1].Is("BETWEEN"):
+			qualifier, name, ok = columnAt(tokens, i-2)
+		case i >= 4 && tokens[i-1].Is("AND") && tokens[i-3].Is("BETWEEN"):
+			qualifier, name, ok = columnAt(tokens, i-4)
+		case i+2 < len(tokens) && isComparison(tokens[i+1]):
+			qualifier, name, ok = columnAt(tokens, i+2)
+		case i >= 1 && (tokens[i-1].Is("LIMIT") || tokens[i-1].Is("OFFSET")):
+			if p.name == "" {
+				p.name = strings.ToLower(tokens[i-1].Text)
+			}
+			p.column = &column{name: p.name, declType: "INTEGER", notNull: true}
+		}
+		if c, found := inserted[i]; found {
+			p.column = c
+			p.assigned = true
+		}
+		if ok {
+			c, err := lookup(refs, qualifier, name)
+			if err != nil {
+				return err
+			}
+			p.column = c
+		}
+		if p.name == "" && p.column != nil {
+			p.name = p.column.name
+		}
+		q.params = append(q.params, p)
+	}
+	return nil
+}
+
+// insertedColumns maps the parameters of the VALUES of an INSERT to the
+// columns they are inserted into, by index in tokens
+func insertedColumns(s *schema, tokens []sqltok.Token) map[int]*column {
+	inserted := make(map[int]*column)
+	if len(tokens) == 0 || !tokens[0].Is("INSERT") && !tokens[0].Is("REPLACE") {
+		return inserted
+	}
+	i := 0
+	for i < len(tokens) && !tokens[i].Is("INTO") {
+		i++
+	}
+	name, rest := qualifiedName(tokens[min(i+1, len(tokens)):])
+	t := s.table(name)
+	if t == nil {
+		return inserted
+	}
+	if len(rest) > 1 && rest[0].Is("AS") {
+		rest = rest[2:]
+	}
+
+	var columns []*column
+	if len(rest) > 0 && rest[0].Text == "(" {
+		var list []sqltok.Token
+		list, rest = parenthesized(rest)
+		for _, item := range splitList(list) {
+			columns = append(columns, t.column(item[0].Ident()))
+		}
+	} else {
+		for k := range t.columns {
+			columns = append(columns, &t.columns[k])
+		}
+	}
+	if len(rest) == 0 || !rest[0].Is("VALUES") {
+		return inserted
+	}
+
+	// the index of rest in tokens
+	offset := len(tokens) - len(rest)
+	for k := 1; k < len(rest) && rest[k].Text == "("; {
+		row, after := parenthesized(rest[k:])
+		start := offset + k + 1
+		for n, item := range splitList(row) {
+			if n < len(columns) && columns[n] != nil && len(item) == 1 && item[0].Kind == sqltok.Param {
+				inserted[start+indexOf(row, item[0])] = columns[n]
+			}
+		}
+		k = len(rest) - len(after)
+		if k < len(rest) && rest[k].Text == "," {
+			k++
+		}
+	}
+	return inserted
+}
+
+func indexOf(tokens []sqltok.Token, tok sqltok.Token) int {
+	for i := range tokens {
+		if tokens[i].Pos == tok.Pos {
+			return i
+		}
+	}
+	return -1
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// resultColumns infers the columns of the result of a SELECT
+func resultColumns(s *schema, tokens []sqltok.Token) ([]column, error) {
+	if len(tokens) == 0 || !tokens[0].Is("SELECT") {
+		if len(tokens) > 0 && tokens[0].Is("WITH") {
+			return nil, errors.New("WITH queries are not supported")
+		}
+		return nil, errors.New("only SELECT queries return rows")
+	}
+	tokens = tokens[1:]
+	if len(tokens) > 0 && (tokens[0].Is("DISTINCT") || tokens[0].Is("ALL")) {
+		tokens = tokens[1:]
+	}
+
+	end := len(tokens)
+	depth := 0
+	for i, tok := range tokens {
+		switch {
+		case tok.Text == "(":
+			depth++
+		case tok.Text == ")":
+			depth--
+		case depth == 0 && (tok.Is("FROM") || tok.Is("WHERE") || tok.Is("GROUP") || tok.Is("ORDER") ||
+			tok.Is("LIMIT") || tok.Is("UNION") || tok.Is("EXCEPT") || tok.Is("INTERSECT")):
+			if i < end {
+				end = i
+			}
+		}
+	}
+	refs := tableRefs(s, tokens[end:], false)
+
+	var columns []column
+	for n, item := range splitList(tokens[:end]) {
+		expr, alias := splitAlias(item)
+		if len(expr) == 1 && expr[0].Text == "*" || len(expr) == 3 && expr[1].Text == "." && expr[2].Text == "*" {
+			qualifier := ""
+			if len(expr) == 3 {
+				qualifier = expr[0].Ident()
+			}
+			star, err := starColumns(refs, qualifier)
+			if err != nil {
+				return nil, err
+			}
+			columns = append(columns, star...)
+			continue
+		}
+
+		c, err := exprType(refs, expr)
+		if err != nil {
+			return nil, fmt.Errorf("result column %d: %w", n+1, err)
+		}
+		if alias != "" {
+			c.name = alias
+		} else if len(expr) != 1 && !(len(expr) == 3 && expr[1].Text == ".") {
+			return nil, fmt.Errorf("result column %d needs a name, use AS", n+1)
+		}
+		columns = append(columns, c)
+	}
+
+	for i := range columns {
+		for j := 0; j < i; j++ {
+			if strings.EqualFold(columns[i].name, columns[j].name) {
+				return nil, fmt.Errorf("duplicate result column %s, use AS", columns[i].name)
+			}
+		}
+	}
+	return columns, nil
+}
+
+// splitAlias splits a result column into its expression and alias
+func splitAlias(item []sqltok.Token) ([]sqltok.Token, string) {
+	n := len(item)
+	if n >= 3 && item[n-2].Is("AS") {
+		return item[:n-2], item[n-1].Ident()
+	}
+	if n >= 2 && isName(item[n-1]) && !isKeyword(item[n-1]) && item[n-2].Text != "." &&
+		(item[n-2].Kind == sqltok.QuotedIdent || item[n-2].Kind == sqltok.Number || item[n-2].Kind == sqltok.String ||
+			item[n-2].Text == ")" || item[n-2].Kind == sqltok.Word && !isKeyword(item[n-2])) {
+		return item[:n-1], item[n-1].Ident()
+	}
+	return item, ""
+}
+
+// starColumns expands * or table.*
+func starColumns(refs []tableRef, qualifier string) ([]column, error) {
+	var columns []column
+	for _, ref := range refs {
+		if qualifier != "" && !strings.EqualFold(qualifier, ref.alias) && !strings.EqualFold(qualifier, ref.name) {
+			continue
+		}
+		if ref.table == nil {
+			return nil, fmt.Errorf("no such table: %s", ref.name)
+		}
+		for _, c := range ref.table.columns {
+			if ref.nullable {
+				c.notNull = false
+			}
+			columns = append(columns, c)
+		}
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no columns for %s.*", qualifier)
+	}
+	return columns, nil
+}
+
+// function result types: the declared type, and whether the result is
+// NULL when an argument is
+var functionTypes = map[string]struct {
+	declType   string
+	nullIfNull bool
+}{
+	"count": {"INTEGER", false}, "changes": {"INTEGER", false}, "total_changes": {"INTEGER", false},
+	"last_insert_rowid": {"INTEGER", false}, "random": {"INTEGER", false},
+	"length": {"INTEGER", true}, "instr": {"INTEGER", true}, "unicode": {"INTEGER", true},
+	"total": {"REAL", false}, "round": {"REAL", true},
+	"typeof": {"TEXT", false}, "quote": {"TEXT", false}, "printf": {"TEXT", false},
+	"format": {"TEXT", false}, "concat": {"TEXT", false},
+	"lower": {"TEXT", true}, "upper": {"TEXT", true}, "trim": {"TEXT", true}, "ltrim": {"TEXT", true},
+	"rtrim": {"TEXT", true}, "substr": {"TEXT", true}, "substring": {"TEXT", true}, "replace": {"TEXT", true},
+	"hex": {"TEXT", false}, "date": {"TEXT", true}, "time": {"TEXT", true}, "datetime": {"TEXT", true},
+	"strftime": {"TEXT", true}, "json": {"TEXT", true}, "json_extract": {"TEXT", true},
+}
+
+// exprType infers the type of an expression
+func exprType(refs []tableRef, expr []sqltok.Token) (column, error) {
+	n := len(expr)
+	switch {
+	case n == 0:
+		return column{}, errors.New("empty expression")
+	case n == 1 && expr[0].Kind == sqltok.Number:
+		declType := "INTEGER"
+		if strings.ContainsAny(expr[0].Text, ".eE") && !strings.HasPrefix(strings.ToLower(expr[0].Text), "0x") {
+			declType = "REAL"
+		}
+		return column{declType: declType, notNull: true}, nil
+	case n == 1 && expr[0].Kind == sqltok.String:
+		return column{declType: "TEXT", notNull: true}, nil
+	case n == 1 && expr[0].Kind == sqltok.Blob:
+		return column{declType: "BLOB", notNull: true}, nil
+	case n == 1 && expr[0].Is("NULL"):
+		return column{}, errors.New("cannot infer the type of NULL, use CAST")
+	case n == 1 && expr[0].Kind != sqltok.Punct || n == 3 && expr[1].Text == ".":
+		qualifier, name, ok := columnAt(expr, n-1)
+		if !ok {
+			break
+		}
+		c, err := lookup(refs, qualifier, name)
+		if err != nil {
+			return column{}, err
+		}
+		return *c, nil
+	case n >= 3 && expr[0].Kind == sqltok.Word && expr[1].Text == "(" && expr[n-1].Text == ")":
+		inner, after := parenthesized(expr[1:])
+		if len(after) > 0 {
+			break
+		}
+		return callType(refs, strings.ToLower(expr[0].Text), inner)
+	}
+	return column{}, errors.New("cannot infer the type of the expression, use CAST(... AS type)")
+}
+
+// callType infers the type of a function call, or of a CAST
+func callType(refs []tableRef, function string, args []sqltok.Token) (column, error) {
+	if function == "cast" {
+		for i := len(args) - 1; i > 0; i-- {
+			if args[i].Is("AS") {
+				var declType []string
+				for _, tok := range args[i+1:] {
+					declType = append(declType, tok.Text)
+				}
+				c, err := exprType(refs, args[:i])
+				return column{declType: strings.Join(declType, " "), notNull: err == nil && c.notNull}, nil
+			}
+		}
+		return column{}, errors.New("invalid CAST")
+	}
+
+	var argTypes []column
+	argsNotNull := true
+	for _, arg := range splitList(args) {
+		c, err := exprType(refs, arg)
+		if err != nil {
+			argsNotNull = false
+			continue
+		}
+		argTypes = append(argTypes, c)
+		argsNotNull = argsNotNull && c.notNull
+	}
+
+	switch function {
+	case "sum", "avg":
+		return column{declType: "REAL"}, nil
+	case "min", "max", "abs":
+		if len(argTypes) == 0 {
+			break
+		}
+		c := argTypes[0]
+		// an aggregate over no rows is NULL
+		c.notNull = function != "abs" && len(splitList(args)) > 1 && argsNotNull || function == "abs" && c.notNull
+		return column{declType: c.declType, notNull: c.notNull}, nil
+	case "coalesce", "ifnull":
+		if len(argTypes) == 0 {
+			break
+		}
+		c := column{declType: argTypes[0].declType}
+		for _, arg := range argTypes {
+			c.notNull = c.notNull || arg.notNull
+		}
+		return c, nil
+	case "group_concat", "string_agg":
+		return column{declType: "TEXT"}, nil
+	}
+	if ft, ok := functionTypes[function]; ok {
+		return column{declType: ft.declType, notNull: !ft.nullIfNull || argsNotNull}, nil
+	}
+	return column{}, fmt.Errorf("cannot infer the type of %s(), use CAST(... AS type)", function)
+}
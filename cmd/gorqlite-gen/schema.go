@@ -0,0 +1,421 @@
+package main
+
+/*
+	this file contains the schema the queries are checked against, read
+	from CREATE TABLE statements or from a live database
+*/
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rqlite/gorqlite"
+	"github.com/rqlite/gorqlite/internal/sqltok"
+	"github.com/rqlite/gorqlite/migrate"
+)
+
+// table is a table or view of the schema
+type table struct {
+	name    string
+	columns []column
+}
+
+// column is a column of a table, or of the result of a query
+type column struct {
+	name     string
+	declType string
+	notNull  bool
+}
+
+func (t *table) column(name string) *column {
+	for i := range t.columns {
+		if strings.EqualFold(t.columns[i].name, name) {
+			return &t.columns[i]
+		}
+	}
+	return nil
+}
+
+// schema are the tables of the database, in order of creation
+type schema struct {
+	tables []*table
+}
+
+func (s *schema) table(name string) *table {
+	for _, t := range s.tables {
+		if strings.EqualFold(t.name, name) {
+			return t
+		}
+	}
+	return nil
+}
+
+func (s *schema) drop(name string) {
+	for i, t := range s.tables {
+		if strings.EqualFold(t.name, name) {
+			s.tables = append(s.tables[:i], s.tables[i+1:]...)
+			return
+		}
+	}
+}
+
+// liveSchema reads the schema of the database at connURL
+func liveSchema(ctx context.Context, connURL string) (*schema, error) {
+	conn, err := gorqlite.Open(connURL)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	live, err := conn.Schema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s := &schema{}
+	for _, t := range live.Tables {
+		tbl := &table{name: t.Name}
+		for _, c := range t.Columns {
+			tbl.columns = append(tbl.columns, column{
+				name:     c.Name,
+				declType: c.Type,
+				notNull:  c.NotNull || c.PrimaryKey > 0 && isRowID(c.Type),
+			})
+		}
+		s.tables = append(s.tables, tbl)
+	}
+	return s, nil
+}
+
+// isRowID tells whether a primary key column of that type is an alias
+// of the rowid, which is never NULL
+func isRowID(declType string) bool {
+	return strings.EqualFold(strings.TrimSpace(declType), "INTEGER")
+}
+
+// readSchema reads the schema from SQL files, or directories of
+// migrations read with migrate.Load, in order
+func readSchema(paths []string) (*schema, error) {
+	s := &schema{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			if err := s.apply(string(content)); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			continue
+		}
+
+		migrations, err := migrate.Load(os.DirFS(path))
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range migrations {
+			if err := s.apply(m.Up); err != nil {
+				return nil, fmt.Errorf("%s: %w", filepath.Join(path, m.String()), err)
+			}
+		}
+	}
+	return s, nil
+}
+
+// apply applies the DDL statements of an SQL script to the schema,
+// ignoring the other statements
+func (s *schema) apply(sql string) error {
+	for _, stmt := range sqltok.Split(sql) {
+		tokens := significant(stmt.Tokens)
+		var err error
+		switch {
+		case len(tokens) < 3:
+		case tokens[0].Is("CREATE"):
+			err = s.create(tokens[1:])
+		case tokens[0].Is("ALTER") && tokens[1].Is("TABLE"):
+			err = s.alter(tokens[2:])
+		case tokens[0].Is("DROP") && (tokens[1].Is("TABLE") || tokens[1].Is("VIEW")):
+			tokens = tokens[2:]
+			if len(tokens) > 2 && tokens[0].Is("IF") && tokens[1].Is("EXISTS") {
+				tokens = tokens[2:]
+			}
+			name, _ := qualifiedName(tokens)
+			s.drop(name)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", firstLine(stmt.Text), err)
+		}
+	}
+	return nil
+}
+
+// create applies a CREATE TABLE or CREATE VIEW statement
+func (s *schema) create(tokens []sqltok.Token) error {
+	if len(tokens) > 0 && (tokens[0].Is("TEMP") || tokens[0].Is("TEMPORARY")) {
+		tokens = tokens[1:]
+	}
+	if len(tokens) < 2 || !tokens[0].Is("TABLE") && !tokens[0].Is("VIEW") {
+		return nil
+	}
+	view := tokens[0].Is("VIEW")
+	tokens = tokens[1:]
+	if len(tokens) > 3 && tokens[0].Is("IF") && tokens[1].Is("NOT") && tokens[2].Is("EXISTS") {
+		tokens = tokens[3:]
+	}
+	name, tokens := qualifiedName(tokens)
+	if name == "" {
+		return fmt.Errorf("missing name")
+	}
+	if s.table(name) != nil {
+		return nil
+	}
+
+	t := &table{name: name}
+	if view {
+		var names []string
+		if len(tokens) > 0 && tokens[0].Text == "(" {
+			var list []sqltok.Token
+			list, tokens = parenthesized(tokens)
+			for _, item := range splitList(list) {
+				names = append(names, item[0].Ident())
+			}
+		}
+		if len(tokens) < 2 || !tokens[0].Is("AS") {
+			return fmt.Errorf("missing AS")
+		}
+		columns, err := resultColumns(s, tokens[1:])
+		if err != nil {
+			// the view can't be queried, but the rest of the schema is fine
+			return nil
+		}
+		for i := range columns {
+			if i < len(names) {
+				columns[i].name = names[i]
+			}
+		}
+		t.columns = columns
+		s.tables = append(s.tables, t)
+		return nil
+	}
+
+	if len(tokens) > 0 && tokens[0].Is("AS") {
+		columns, err := resultColumns(s, tokens[1:])
+		if err != nil {
+			return err
+		}
+		t.columns = columns
+		s.tables = append(s.tables, t)
+		return nil
+	}
+	if len(tokens) == 0 || tokens[0].Text != "(" {
+		return fmt.Errorf("missing column definitions")
+	}
+	definitions, _ := parenthesized(tokens)
+	var primaryKey []string
+	for _, def := range splitList(definitions) {
+		switch {
+		case def[0].Is("CONSTRAINT") || def[0].Is("UNIQUE") || def[0].Is("CHECK") || def[0].Is("FOREIGN"):
+		case def[0].Is("PRIMARY"):
+			// PRIMARY KEY (a, b)
+			for i, tok := range def {
+				if tok.Text == "(" {
+					keys, _ := parenthesized(def[i:])
+					for _, key := range splitList(keys) {
+						primaryKey = append(primaryKey, key[0].Ident())
+					}
+					break
+				}
+			}
+		default:
+			t.columns = append(t.columns, columnDefinition(def))
+		}
+	}
+	for _, name := range primaryKey {
+		if c := t.column(name); c != nil && len(primaryKey) == 1 && isRowID(c.declType) {
+			c.notNull = true
+		}
+	}
+	s.tables = append(s.tables, t)
+	return nil
+}
+
+// columnConstraints are the keywords ending the type of a column
+var columnConstraints = []string{"CONSTRAINT", "PRIMARY", "NOT", "NULL", "UNIQUE", "CHECK", "DEFAULT", "COLLATE", "REFERENCES", "GENERATED", "AS"}
+
+func isColumnConstraint(tok sqltok.Token) bool {
+	for _, keyword := range columnConstraints {
+		if tok.Is(keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// columnDefinition parses a column definition: name, type, constraints
+func columnDefinition(def []sqltok.Token) column {
+	c := column{name: def[0].Ident()}
+	i := 1
+	var typeTokens []string
+	for ; i < len(def) && !isColumnConstraint(def[i]); i++ {
+		if def[i].Text == "(" && len(typeTokens) > 0 {
+			// VARCHAR(255), DECIMAL(10, 2)
+			var size []sqltok.Token
+			size, _ = parenthesized(def[i:])
+			var text []string
+			for _, tok := range size {
+				text = append(text, tok.Text)
+			}
+			typeTokens[len(typeTokens)-1] += "(" + strings.Join(text, "") + ")"
+			i += len(size) + 1
+			continue
+		}
+		typeTokens = append(typeTokens, def[i].Text)
+	}
+	c.declType = strings.Join(typeTokens, " ")
+
+	primaryKey := false
+	for ; i < len(def); i++ {
+		switch {
+		case def[i].Is("NOT") && i+1 < len(def) && def[i+1].Is("NULL"):
+			c.notNull = true
+		case def[i].Is("PRIMARY"):
+			primaryKey = true
+		}
+	}
+	if primaryKey && isRowID(c.declType) {
+		c.notNull = true
+	}
+	return c
+}
+
+// alter applies an ALTER TABLE statement
+func (s *schema) alter(tokens []sqltok.Token) error {
+	name, tokens := qualifiedName(tokens)
+	t := s.table(name)
+	if t == nil {
+		return fmt.Errorf("no such table: %s", name)
+	}
+	if len(tokens) < 2 {
+		return nil
+	}
+
+	switch {
+	case tokens[0].Is("RENAME") && tokens[1].Is("TO") && len(tokens) > 2:
+		t.name = tokens[2].Ident()
+	case tokens[0].Is("RENAME"):
+		tokens = tokens[1:]
+		if tokens[0].Is("COLUMN") {
+			tokens = tokens[1:]
+		}
+		if len(tokens) < 3 || !tokens[1].Is("TO") {
+			return fmt.Errorf("invalid RENAME")
+		}
+		c := t.column(tokens[0].Ident())
+		if c == nil {
+			return fmt.Errorf("no such column: %s", tokens[0].Ident())
+		}
+		c.name = tokens[2].Ident()
+	case tokens[0].Is("ADD"):
+		tokens = tokens[1:]
+		if tokens[0].Is("COLUMN") && len(tokens) > 1 {
+			tokens = tokens[1:]
+		}
+		t.columns = append(t.columns, columnDefinition(tokens))
+	case tokens[0].Is("DROP"):
+		tokens = tokens[1:]
+		if tokens[0].Is("COLUMN") && len(tokens) > 1 {
+			tokens = tokens[1:]
+		}
+		for i := range t.columns {
+			if strings.EqualFold(t.columns[i].name, tokens[0].Ident()) {
+				t.columns = append(t.columns[:i], t.columns[i+1:]...)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// significant drops the whitespace and comments
+func significant(tokens []sqltok.Token) []sqltok.Token {
+	var sig []sqltok.Token
+	for _, tok := range tokens {
+		if tok.Significant() {
+			sig = append(sig, tok)
+		}
+	}
+	return sig
+}
+
+// qualifiedName reads a name, possibly schema.name, returning the name
+// and the tokens after it
+func qualifiedName(tokens []sqltok.Token) (string, []sqltok.Token) {
+	if len(tokens) == 0 || !isName(tokens[0]) {
+		return "", tokens
+	}
+	if len(tokens) > 2 && tokens[1].Text == "." && isName(tokens[2]) {
+		return tokens[2].Ident(), tokens[3:]
+	}
+	return tokens[0].Ident(), tokens[1:]
+}
+
+func isName(tok sqltok.Token) bool {
+	return tok.Kind == sqltok.Word || tok.Kind == sqltok.QuotedIdent || tok.Kind == sqltok.String
+}
+
+// parenthesized returns the tokens within the parentheses tokens start
+// with, and the tokens after them
+func parenthesized(tokens []sqltok.Token) ([]sqltok.Token, []sqltok.Token) {
+	depth := 0
+	for i, tok := range tokens {
+		switch tok.Text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return tokens[1:i], tokens[i+1:]
+			}
+		}
+	}
+	return tokens[1:], nil
+}
+
+// splitList splits tokens on the commas outside of parentheses
+func splitList(tokens []sqltok.Token) [][]sqltok.Token {
+	var items [][]sqltok.Token
+	depth, start := 0, 0
+	for i, tok := range tokens {
+		switch tok.Text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		case ",":
+			if depth == 0 {
+				if i > start {
+					items = append(items, tokens[start:i])
+				}
+				start = i + 1
+			}
+		}
+	}
+	if start < len(tokens) {
+		items = append(items, tokens[start:])
+	}
+	return items
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i] + " ..."
+	}
+	return s
+}
@@ -0,0 +1,6 @@
+CREATE TABLE files (
+  id INTEGER PRIMARY KEY,
+  name TEXT NOT NULL,
+  data BLOB NOT NULL,
+  thumbnail BLOB
+);
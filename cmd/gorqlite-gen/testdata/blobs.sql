@@ -0,0 +1,8 @@
+-- name: GetFile :one
+SELECT * FROM files WHERE id = ?;
+
+-- name: CreateFile :execlastid
+INSERT INTO files (name, data, thumbnail) VALUES (?, ?, ?);
+
+-- name: SetThumbnail :exec
+UPDATE files SET thumbnail = :thumbnail WHERE id = :id;
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// newFlagSet returns the flags of a command, reporting errors as
+// usage errors rather than exiting
+func newFlagSet(name, usage string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: gorqlite %s\n", usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseFlags parses the arguments of a command, expecting n positional ones
+func parseFlags(flags *flag.FlagSet, args []string, n int) error {
+	if err := flags.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	if flags.NArg() != n {
+		flags.Usage()
+		return usageError(fmt.Sprintf("expected %d arguments, got %d", n, flags.NArg()))
+	}
+	return nil
+}
+
+func printStatus(ctx context.Context, conn *gorqlite.Connection, w io.Writer) error {
+	status, err := conn.StatusContext(ctx)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(b))
+	return err
+}
+
+func runStatus(ctx context.Context, conn *gorqlite.Connection, args []string) error {
+	flags := newFlagSet("status", "status")
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	return printStatus(ctx, conn, stdout)
+}
+
+func printNodes(ctx context.Context, conn *gorqlite.Connection, w io.Writer) error {
+	nodes, err := conn.NodesContext(ctx)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, len(nodes))
+	for i, node := range nodes {
+		rows[i] = []string{
+			node.ID,
+			node.APIAddr,
+			node.Addr,
+			strconv.FormatBool(node.Voter),
+			strconv.FormatBool(node.Reachable),
+			strconv.FormatBool(node.Leader),
+			strconv.FormatFloat(node.Time, 'f', -1, 64),
+			node.Error,
+		}
+	}
+	printTable(w, []string{"id", "api_addr", "addr", "voter", "reachable", "leader", "time", "error"}, rows)
+	return nil
+}
+
+func runNodes(ctx context.Context, conn *gorqlite.Connection, args []string) error {
+	flags := newFlagSet("nodes", "nodes")
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	return printNodes(ctx, conn, stdout)
+}
+
+func runLeader(ctx context.Context, conn *gorqlite.Connection, args []string) error {
+	flags := newFlagSet("leader", "leader")
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	leader, err := conn.Leader()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, leader)
+	return nil
+}
+
+// createFile opens path for writing, "-" being stdout
+func createFile(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return nopCloser{stdout}, nil
+	}
+	return os.Create(path)
+}
+
+// openFile opens path for reading, "-" being stdin
+func openFile(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(stdin), nil
+	}
+	return os.Open(path)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+func runBackup(ctx context.Context, conn *gorqlite.Connection, args []string) error {
+	flags := newFlagSet("backup", "backup [-sql] FILE")
+	sql := flags.Bool("sql", false, "write a text SQL dump rather than a SQLite database file")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+
+	format := gorqlite.BackupFormatSQLite
+	if *sql {
+		format = gorqlite.BackupFormatSQL
+	}
+	f, err := createFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := conn.BackupContext(ctx, f, format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func runLoad(ctx context.Context, conn *gorqlite.Connection, args []string) error {
+	flags := newFlagSet("load", "load FILE")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+
+	f, err := openFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return conn.LoadContext(ctx, f)
+}
+
+// formatOf returns the format given, or else the one of the file extension
+func formatOf(format, path string) (string, error) {
+	if format == "" {
+		format = "csv"
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".ndjson", ".jsonl":
+			format = "ndjson"
+		}
+	}
+	if format != "csv" && format != "ndjson" {
+		return "", usageError("unknown format " + format + ", want csv or ndjson")
+	}
+	return format, nil
+}
+
+func runImport(ctx context.Context, conn *gorqlite.Connection, args []string) error {
+	flags := newFlagSet("import", "import [flags] TABLE FILE")
+	format := flags.String("format", "", "csv or ndjson, defaults to the file extension, or else csv")
+	maxErrors := flags.Int("max-errors", 0, "stop after that many line errors, 0 for no limit")
+	emptyAsNull := flags.Bool("empty-as-null", false, "import empty CSV fields as NULL in text columns too")
+	if err := parseFlags(flags, args, 2); err != nil {
+		return err
+	}
+	table, path := flags.Arg(0), flags.Arg(1)
+	f, err := formatOf(*format, path)
+	if err != nil {
+		return err
+	}
+
+	r, err := openFile(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	config := gorqlite.ImportConfig{MaxErrors: *maxErrors, EmptyAsNull: *emptyAsNull}
+	var result gorqlite.ImportResult
+	if f == "csv" {
+		result, err = conn.ImportCSV(ctx, r, table, config)
+	} else {
+		result, err = conn.ImportNDJSON(ctx, r, table, config)
+	}
+	for _, lineErr := range result.Errors {
+		fmt.Fprintln(stderr, lineErr)
+	}
+	fmt.Fprintf(stdout, "%d rows imported from %d lines\n", result.RowsImported, result.Lines)
+	return err
+}
+
+func runExport(ctx context.Context, conn *gorqlite.Connection, args []string) error {
+	flags := newFlagSet("export", "export [flags] QUERY")
+	format := flags.String("format", "", "csv or ndjson, defaults to the output file extension, or else csv")
+	pageSize := flags.Int("page", 1000, "rows read per request")
+	output := flags.String("o", "-", "output file")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	f, err := formatOf(*format, *output)
+	if err != nil {
+		return err
+	}
+
+	w, err := createFile(*output)
+	if err != nil {
+		return err
+	}
+	statement := gorqlite.ParameterizedStatement{Query: flags.Arg(0)}
+	if f == "csv" {
+		_, err = conn.ExportQueryCSV(ctx, w, statement, *pageSize)
+	} else {
+		_, err = conn.ExportQueryNDJSON(ctx, w, statement, *pageSize)
+	}
+	if err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func runWatch(ctx context.Context, conn *gorqlite.Connection, args []string) error {
+	flags := newFlagSet("watch", "watch [flags]")
+	interval := flags.Duration("interval", 2*time.Second, "time between two checks")
+	count := flags.Int("count", 0, "stop after that many checks, 0 for none")
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	if *interval <= 0 {
+		return usageError("invalid interval " + interval.String())
+	}
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for n := 1; ; n++ {
+		watchOnce(ctx, conn, stdout)
+		if *count > 0 && n >= *count {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// watchOnce prints the health of the cluster, as seen at that time
+func watchOnce(ctx context.Context, conn *gorqlite.Connection, w io.Writer) {
+	checkCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	now := time.Now().Format(time.RFC3339)
+	nodes, err := conn.NodesContext(checkCtx)
+	if err != nil {
+		fmt.Fprintf(w, "%s  UNHEALTHY: %s\n\n", now, strings.TrimSpace(err.Error()))
+		return
+	}
+
+	var leader string
+	reachable := 0
+	for _, node := range nodes {
+		if node.Reachable {
+			reachable++
+		}
+		if node.Leader {
+			leader = node.ID
+		}
+	}
+	health := "HEALTHY"
+	switch {
+	case leader == "":
+		health = "UNHEALTHY: no leader"
+	case reachable < len(nodes):
+		health = "DEGRADED"
+	}
+	fmt.Fprintf(w, "%s  %s, leader %s, %d of %d nodes reachable\n", now, health, leader, reachable, len(nodes))
+
+	rows := make([][]string, len(nodes))
+	for i, node := range nodes {
+		rows[i] = []string{node.ID, node.APIAddr, strconv.FormatBool(node.Reachable), strconv.FormatBool(node.Leader), node.Error}
+	}
+	printTable(w, []string{"id", "api_addr", "reachable", "leader", "error"}, rows)
+	fmt.Fprintln(w)
+}
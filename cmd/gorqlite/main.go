@@ -0,0 +1,141 @@
+// Command gorqlite is a command-line client for rqlite, built on the
+// gorqlite package. It takes the same connection URLs as gorqlite.Open.
+//
+// Usage:
+//
+//	gorqlite [-url URL] [command] [arguments]
+//
+// Without a command, it starts an interactive SQL shell. The commands are:
+//
+//	shell                   interactive SQL shell, the default
+//	status                  status of the node answering, as JSON
+//	nodes                   nodes of the cluster
+//	leader                  leader of the cluster
+//	backup [-sql] FILE      write a backup of the database to FILE
+//	load FILE               replace the database with a backup or SQL dump
+//	import [-format F] TABLE FILE
+//	                        import CSV or NDJSON rows into TABLE
+//	export [-format F] [-page N] [-o FILE] QUERY
+//	                        export the rows of QUERY as CSV or NDJSON
+//	watch [-interval D]     watch the health of the cluster
+//
+// The URL defaults to the RQLITE_URL environment variable, or else to
+// http://localhost:4001.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/rqlite/gorqlite"
+)
+
+const defaultURL = "http://localhost:4001"
+
+// command is a subcommand of gorqlite
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, conn *gorqlite.Connection, args []string) error
+}
+
+var commands = []command{
+	{"shell", "interactive SQL shell, the default", runShell},
+	{"status", "status of the node answering, as JSON", runStatus},
+	{"nodes", "nodes of the cluster", runNodes},
+	{"leader", "leader of the cluster", runLeader},
+	{"backup", "write a backup of the database to a file", runBackup},
+	{"load", "replace the database with a backup or SQL dump", runLoad},
+	{"import", "import CSV or NDJSON rows into a table", runImport},
+	{"export", "export the rows of a query as CSV or NDJSON", runExport},
+	{"watch", "watch the health of the cluster", runWatch},
+}
+
+// stdout and stderr are variables for the tests
+var (
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+)
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	flags := flag.NewFlagSet("gorqlite", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	defaultConnURL := os.Getenv("RQLITE_URL")
+	if defaultConnURL == "" {
+		defaultConnURL = defaultURL
+	}
+	connURL := flags.String("url", defaultConnURL, "rqlite connection URL, as taken by gorqlite.Open")
+	trace := flags.Bool("trace", false, "trace what gorqlite does to stderr")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: gorqlite [flags] [command] [arguments]\n\ncommands:\n")
+		for _, cmd := range commands {
+			fmt.Fprintf(stderr, "  %-8s %s\n", cmd.name, cmd.summary)
+		}
+		fmt.Fprintf(stderr, "\nflags:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	name := "shell"
+	args = flags.Args()
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == name {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(stderr, "gorqlite: unknown command %s\n", name)
+		flags.Usage()
+		return 2
+	}
+
+	if *trace {
+		gorqlite.TraceOn(stderr)
+	}
+
+	conn, err := gorqlite.Open(*connURL)
+	if err != nil {
+		fmt.Fprintf(stderr, "gorqlite: %s\n", err)
+		return 1
+	}
+	defer conn.Close()
+
+	// interrupting a command stops it cleanly, but the shell is left
+	// to the default behavior, since it is waiting for input
+	ctx := context.Background()
+	if name != "shell" {
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, os.Interrupt)
+		defer stop()
+	}
+
+	if err := cmd.run(ctx, conn, args); err != nil {
+		fmt.Fprintf(stderr, "gorqlite %s: %s\n", name, err)
+		if _, ok := err.(usageError); ok {
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+// usageError is an error in the arguments of a command
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrintTable(t *testing.T) {
+	var buf bytes.Buffer
+	printTable(&buf, []string{"id", "name"}, [][]string{{"1", "alice"}, {"10", "bö"}})
+	want := "id | name\n" +
+		"---+------\n" +
+		"1  | alice\n" +
+		"10 | bö\n"
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	tests := []struct {
+		format, path, want string
+	}{
+		{"", "rows.csv", "csv"},
+		{"", "rows.ndjson", "ndjson"},
+		{"", "rows.JSONL", "ndjson"},
+		{"", "-", "csv"},
+		{"ndjson", "rows.csv", "ndjson"},
+	}
+	for _, test := range tests {
+		got, err := formatOf(test.format, test.path)
+		if err != nil || got != test.want {
+			t.Errorf("%q, %q: got %q, %v, want %q", test.format, test.path, got, err, test.want)
+		}
+	}
+	if _, err := formatOf("xml", "rows.xml"); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
+
+// newTestServer answers like a single node rqlite would
+func newTestServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/nodes":
+			fmt.Fprintf(w, `{"1":{"api_addr":"http://%s","addr":"localhost:4002","reachable":true,"leader":true}}`, r.Host)
+		case "/db/request":
+			var body bytes.Buffer
+			body.ReadFrom(r.Body)
+			switch {
+			case strings.Contains(body.String(), "SELECT"):
+				w.Write([]byte(`{"results":[{"columns":["id","name"],"types":["integer","text"],"values":[[1,"alice"],[2,null]],"time":0.5}]}`))
+			case strings.Contains(body.String(), "INSERT"):
+				w.Write([]byte(`{"results":[{"last_insert_id":3,"rows_affected":1}]}`))
+			default:
+				w.Write([]byte(`{"results":[{"error":"near \"bad\": syntax error"}]}`))
+			}
+		case "/db/query":
+			w.Write([]byte(`{"results":[{"columns":["name"],"types":["text"],"values":[["foo"]]}]}`))
+		case "/db/backup":
+			w.Write([]byte("CREATE TABLE foo (id INTEGER);\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// runCLI runs gorqlite with the given stdin, and returns its exit
+// code and output
+func runCLI(t *testing.T, input string, args ...string) (int, string, string) {
+	var out, errOut bytes.Buffer
+	stdin, stdout, stderr = strings.NewReader(input), &out, &errOut
+	defer func() {
+		stdin, stdout, stderr = os.Stdin, os.Stdout, os.Stderr
+	}()
+	code := run(args)
+	return code, out.String(), errOut.String()
+}
+
+func TestCommands(t *testing.T) {
+	srv := newTestServer(t)
+	connURL := srv.URL + "?disableClusterDiscovery=true"
+
+	t.Run("shell", func(t *testing.T) {
+		input := "SELECT id, name\nFROM foo;\nINSERT INTO foo VALUES (3, 'carol');\nbad;\n.tables\n.timer on\nSELECT 1;\n.quit\nSELECT 'not run';\n"
+		code, out, _ := runCLI(t, input, "-url", connURL)
+		if code != 0 {
+			t.Fatalf("got exit code %d", code)
+		}
+		for _, want := range []string{
+			"id | name\n---+------\n1  | alice\n2  | NULL\n(2 rows)\n",
+			"1 row(s) affected, last insert ID 3\n",
+			"Error: near \"bad\": syntax error\n",
+			"name\n----\nfoo\n(1 row)\n",
+			"Run time: 0.500000 seconds\n",
+		} {
+			if !strings.Contains(out, want) {
+				t.Errorf("missing %q in output:\n%s", want, out)
+			}
+		}
+		if strings.Count(out, "(2 rows)") != 2 {
+			t.Errorf("expected the statement after .quit not to run:\n%s", out)
+		}
+	})
+
+	t.Run("nodes", func(t *testing.T) {
+		code, out, _ := runCLI(t, "", "-url", connURL, "nodes")
+		if code != 0 || !strings.Contains(out, "localhost:4002 | false | true      | true") {
+			t.Errorf("unexpected output, exit code %d:\n%s", code, out)
+		}
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		code, out, _ := runCLI(t, "", "-url", connURL, "watch", "-count", "1")
+		if code != 0 || !strings.Contains(out, "HEALTHY, leader 1, 1 of 1 nodes reachable") {
+			t.Errorf("unexpected output, exit code %d:\n%s", code, out)
+		}
+	})
+
+	t.Run("backup", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "backup.sql")
+		code, _, errOut := runCLI(t, "", "-url", connURL, "backup", "-sql", path)
+		if code != 0 {
+			t.Fatalf("got exit code %d: %s", code, errOut)
+		}
+		b, _ := os.ReadFile(path)
+		if string(b) != "CREATE TABLE foo (id INTEGER);\n" {
+			t.Errorf("unexpected backup: %q", b)
+		}
+	})
+
+	t.Run("usage errors", func(t *testing.T) {
+		if code, _, _ := runCLI(t, "", "-url", connURL, "frobnicate"); code != 2 {
+			t.Errorf("got exit code %d for an unknown command, want 2", code)
+		}
+		if code, _, _ := runCLI(t, "", "-url", connURL, "backup"); code != 2 {
+			t.Errorf("got exit code %d for a missing argument, want 2", code)
+		}
+	})
+}
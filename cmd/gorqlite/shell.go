@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// stdin is a variable for the tests
+var stdin io.Reader = os.Stdin
+
+const shellHelp = `Statements end with a semicolon, and may span several lines.
+Commands:
+  .help              show this help
+  .tables            list the tables
+  .schema [TABLE]    show the CREATE statements, of TABLE or of all
+  .status            status of the node answering
+  .nodes             nodes of the cluster
+  .leader            leader of the cluster
+  .level [LEVEL]     show or set the consistency level: none, weak,
+                     linearizable or strong
+  .timer on|off      show the time taken by rqlite for each statement
+  .quit              exit, as does end of input`
+
+// shell is the state of the interactive shell
+type shell struct {
+	conn  *gorqlite.Connection
+	out   io.Writer
+	timer bool
+}
+
+// isTerminal tells whether r is an interactive terminal
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func runShell(ctx context.Context, conn *gorqlite.Connection, args []string) error {
+	if len(args) > 0 {
+		return usageError("usage: gorqlite shell")
+	}
+
+	sh := &shell{conn: conn, out: stdout}
+	interactive := isTerminal(stdin)
+	if interactive {
+		fmt.Fprintln(sh.out, `Connected. Enter ".help" for usage hints.`)
+	}
+
+	scanner := bufio.NewScanner(stdin)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var statement strings.Builder
+	for {
+		if interactive {
+			if statement.Len() == 0 {
+				fmt.Fprint(sh.out, "rqlite> ")
+			} else {
+				fmt.Fprint(sh.out, "   ...> ")
+			}
+		}
+		if !scanner.Scan() {
+			break
+		}
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if statement.Len() == 0 {
+			if trimmed == "" {
+				continue
+			}
+			if strings.HasPrefix(trimmed, ".") {
+				if quit := sh.command(ctx, trimmed); quit {
+					return nil
+				}
+				continue
+			}
+		}
+
+		statement.WriteString(line)
+		statement.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			sh.execute(ctx, statement.String())
+			statement.Reset()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// run a last statement missing its semicolon
+	if strings.TrimSpace(statement.String()) != "" {
+		sh.execute(ctx, statement.String())
+	}
+	if interactive {
+		fmt.Fprintln(sh.out)
+	}
+	return nil
+}
+
+// execute runs a statement, read or write, and prints its result
+func (sh *shell) execute(ctx context.Context, statement string) {
+	results, err := sh.conn.RequestContext(ctx, []string{statement})
+	if err != nil && (len(results) != 1 || results[0].Err == nil) {
+		fmt.Fprintf(sh.out, "Error: %s\n", err)
+		return
+	}
+	if len(results) == 0 {
+		return
+	}
+
+	result := results[0]
+	switch {
+	case result.Err != nil:
+		fmt.Fprintf(sh.out, "Error: %s\n", result.Err)
+	case result.Query != nil:
+		if err := printQueryResult(sh.out, result.Query); err != nil {
+			fmt.Fprintf(sh.out, "Error: %s\n", err)
+		}
+		if sh.timer {
+			fmt.Fprintf(sh.out, "Run time: %f seconds\n", result.Query.Timing)
+		}
+	case result.Write != nil:
+		fmt.Fprintf(sh.out, "%d row(s) affected, last insert ID %d\n", result.Write.RowsAffected, result.Write.LastInsertID)
+		if sh.timer {
+			fmt.Fprintf(sh.out, "Run time: %f seconds\n", result.Write.Timing)
+		}
+	}
+}
+
+// query runs a read and prints its rows
+func (sh *shell) query(ctx context.Context, statement gorqlite.ParameterizedStatement) {
+	qr, err := sh.conn.QueryOneParameterizedContext(ctx, statement)
+	if err != nil {
+		fmt.Fprintf(sh.out, "Error: %s\n", err)
+		return
+	}
+	if err := printQueryResult(sh.out, &qr); err != nil {
+		fmt.Fprintf(sh.out, "Error: %s\n", err)
+	}
+}
+
+// command runs a dot command, and tells whether to quit
+func (sh *shell) command(ctx context.Context, line string) bool {
+	fields := strings.Fields(line)
+	name, args := fields[0], fields[1:]
+
+	switch name {
+	case ".quit", ".exit":
+		return true
+	case ".help":
+		fmt.Fprintln(sh.out, shellHelp)
+	case ".tables":
+		sh.query(ctx, gorqlite.ParameterizedStatement{
+			Query: "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name",
+		})
+	case ".schema":
+		statement := gorqlite.ParameterizedStatement{
+			Query: "SELECT sql FROM sqlite_master WHERE sql IS NOT NULL ORDER BY tbl_name, type DESC, name",
+		}
+		if len(args) > 0 {
+			statement = gorqlite.ParameterizedStatement{
+				Query:     "SELECT sql FROM sqlite_master WHERE sql IS NOT NULL AND tbl_name = ? ORDER BY type DESC, name",
+				Arguments: []interface{}{args[0]},
+			}
+		}
+		qr, err := sh.conn.QueryOneParameterizedContext(ctx, statement)
+		if err != nil {
+			fmt.Fprintf(sh.out, "Error: %s\n", err)
+			return false
+		}
+		for qr.Next() {
+			var sql string
+			if err := qr.Scan(&sql); err != nil {
+				fmt.Fprintf(sh.out, "Error: %s\n", err)
+				return false
+			}
+			fmt.Fprintf(sh.out, "%s;\n", sql)
+		}
+	case ".status":
+		if err := printStatus(ctx, sh.conn, sh.out); err != nil {
+			fmt.Fprintf(sh.out, "Error: %s\n", err)
+		}
+	case ".nodes":
+		if err := printNodes(ctx, sh.conn, sh.out); err != nil {
+			fmt.Fprintf(sh.out, "Error: %s\n", err)
+		}
+	case ".leader":
+		leader, err := sh.conn.Leader()
+		if err != nil {
+			fmt.Fprintf(sh.out, "Error: %s\n", err)
+			return false
+		}
+		fmt.Fprintln(sh.out, leader)
+	case ".level":
+		if len(args) == 0 {
+			level, _ := sh.conn.ConsistencyLevel()
+			fmt.Fprintln(sh.out, level)
+			return false
+		}
+		level, err := gorqlite.ParseConsistencyLevel(args[0])
+		if err == nil {
+			err = sh.conn.SetConsistencyLevel(level)
+		}
+		if err != nil {
+			fmt.Fprintf(sh.out, "Error: %s\n", err)
+		}
+	case ".timer":
+		if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+			fmt.Fprintln(sh.out, "usage: .timer on|off")
+			return false
+		}
+		sh.timer = args[0] == "on"
+	default:
+		fmt.Fprintf(sh.out, "Error: unknown command %s, enter \".help\" for usage hints\n", name)
+	}
+	return false
+}
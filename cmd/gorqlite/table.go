@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// formatValue formats a value as returned by QueryResult.Slice()
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(b)
+	}
+}
+
+// printTable writes rows below a header, in aligned columns
+func printTable(w io.Writer, header []string, rows [][]string) {
+	widths := make([]int, len(header))
+	for i, h := range header {
+		widths[i] = utf8.RuneCountInString(h)
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			if n := utf8.RuneCountInString(cell); i < len(widths) && n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	line := func(cells []string) {
+		var b strings.Builder
+		for i, cell := range cells {
+			if i > 0 {
+				b.WriteString(" | ")
+			}
+			b.WriteString(cell)
+			if i < len(cells)-1 {
+				b.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell)))
+			}
+		}
+		fmt.Fprintln(w, b.String())
+	}
+
+	line(header)
+	separators := make([]string, len(header))
+	for i, width := range widths {
+		separators[i] = strings.Repeat("-", width)
+	}
+	fmt.Fprintln(w, strings.Join(separators, "-+-"))
+	for _, row := range rows {
+		line(row)
+	}
+}
+
+// printQueryResult writes the rows of a query result as a table,
+// followed by their number
+func printQueryResult(w io.Writer, qr *gorqlite.QueryResult) error {
+	var rows [][]string
+	for qr.Next() {
+		values, err := qr.Slice()
+		if err != nil {
+			return err
+		}
+		row := make([]string, len(values))
+		for i, v := range values {
+			// keep the table on one line per row
+			row[i] = strings.ReplaceAll(formatValue(v), "\n", `\n`)
+		}
+		rows = append(rows, row)
+	}
+
+	printTable(w, qr.Columns(), rows)
+	if len(rows) == 1 {
+		fmt.Fprintln(w, "(1 row)")
+	} else {
+		fmt.Fprintf(w, "(%d rows)\n", len(rows))
+	}
+	return nil
+}
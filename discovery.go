@@ -0,0 +1,134 @@
+package gorqlite
+
+/*
+	this file holds the DNS-based node discovery:
+
+	types:
+		discoveryMode
+		Resolver
+	Connection methods:
+		resolvePeers (turns DNS records into a list of peers)
+		resolveCluster (replaces the cluster info with the resolved peers)
+		resolvedCluster (the cluster info of resolved peers)
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+type discoveryMode int
+
+const (
+	// DiscoveryModeNone uses the host given in the connection URL as is.
+	DiscoveryModeNone discoveryMode = iota
+	// DiscoveryModeDNS resolves all A/AAAA records of the host given in the
+	// connection URL, e.g. a Kubernetes headless service, and uses each
+	// address as a peer on the port given in the URL. Over https, the
+	// certificates of all the peers are verified against that host,
+	// unless another server name is given, e.g. with WithTLSServerName.
+	DiscoveryModeDNS
+	// DiscoveryModeSRV resolves the SRV records of the host given in the
+	// connection URL (_rqlite._tcp.<host>) and uses each target as a peer.
+	DiscoveryModeSRV
+)
+
+var discoveryModeToString = map[discoveryMode]string{
+	DiscoveryModeNone: "none",
+	DiscoveryModeDNS:  "dns",
+	DiscoveryModeSRV:  "srv",
+}
+
+// String returns the string representation of a discoveryMode.
+func (d discoveryMode) String() string {
+	return discoveryModeToString[d]
+}
+
+// ParseDiscoveryMode parses a string into a discoveryMode.
+func ParseDiscoveryMode(s string) (discoveryMode, error) {
+	for k, v := range discoveryModeToString {
+		if v == s {
+			return k, nil
+		}
+	}
+	return DiscoveryModeNone, fmt.Errorf("unknown discovery mode: %s", s)
+}
+
+// Resolver is the subset of *net.Resolver used for DNS based discovery.
+// It exists so that tests, or users with special needs, can provide
+// their own implementation.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) (addrs []string, err error)
+	LookupSRV(ctx context.Context, service, proto, name string) (cname string, addrs []*net.SRV, err error)
+}
+
+// resolvePeers looks up the discovery host according to the discovery
+// mode of the connection and returns the peers found, in the order
+// the resolver handed them to us.
+//
+// For SRV records, a host starting with an underscore is taken as the
+// full record name (e.g. _rqlite._tcp.svc), otherwise the standard
+// _rqlite._tcp prefix is added.
+func (conn *Connection) resolvePeers(ctx context.Context) ([]peer, error) {
+	var peers []peer
+
+	switch conn.discoveryMode {
+	case DiscoveryModeDNS:
+		addrs, err := conn.resolver.LookupHost(ctx, conn.discoveryHost)
+		if err != nil {
+			return nil, fmt.Errorf("could not resolve %s: %w", conn.discoveryHost, err)
+		}
+		for _, addr := range addrs {
+			peers = append(peers, peer(net.JoinHostPort(addr, conn.discoveryPort)))
+		}
+	case DiscoveryModeSRV:
+		service, proto := "rqlite", "tcp"
+		if strings.HasPrefix(conn.discoveryHost, "_") {
+			service, proto = "", ""
+		}
+		_, addrs, err := conn.resolver.LookupSRV(ctx, service, proto, conn.discoveryHost)
+		if err != nil {
+			return nil, fmt.Errorf("could not resolve SRV records for %s: %w", conn.discoveryHost, err)
+		}
+		for _, srv := range addrs {
+			target := strings.TrimSuffix(srv.Target, ".")
+			peers = append(peers, peer(net.JoinHostPort(target, fmt.Sprint(srv.Port))))
+		}
+	default:
+		return nil, errors.New("resolvePeers() called without a DNS discovery mode")
+	}
+
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("no peers found for %s", conn.discoveryHost)
+	}
+
+	trace("%s: resolved %d peer(s) for %s", conn.ID, len(peers), conn.discoveryHost)
+	return peers, nil
+}
+
+// resolveCluster re-resolves the discovery host and replaces the
+// cluster info with the peers found. As in initConnection(), the
+// first peer is assumed to be the leader until updateClusterInfo()
+// tells us otherwise.
+func (conn *Connection) resolveCluster(ctx context.Context) error {
+	peers, err := conn.resolvePeers(ctx)
+	if err != nil {
+		return err
+	}
+	conn.setCluster(conn.resolvedCluster(peers))
+	return nil
+}
+
+// resolvedCluster returns the cluster info of the peers resolved, the
+// first one assumed to be the leader
+func (conn *Connection) resolvedCluster(peers []peer) rqliteCluster {
+	var rc rqliteCluster
+	rc.conn = conn
+	rc.leader = peers[0]
+	rc.otherPeers = peers[1:]
+	rc.peerList = peers
+	return rc
+}
@@ -0,0 +1,326 @@
+package gorqlite
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+type stubResolver struct {
+	hosts map[string][]string
+	srvs  map[string][]*net.SRV
+}
+
+func (r *stubResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	addrs, ok := r.hosts[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return addrs, nil
+}
+
+func (r *stubResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	if service != "" {
+		name = "_" + service + "._" + proto + "." + name
+	}
+	addrs, ok := r.srvs[name]
+	if !ok {
+		return "", nil, errors.New("no such host")
+	}
+	return name, addrs, nil
+}
+
+func Test_ParseDiscoveryMode(t *testing.T) {
+	for _, mode := range []discoveryMode{DiscoveryModeNone, DiscoveryModeDNS, DiscoveryModeSRV} {
+		got, err := ParseDiscoveryMode(mode.String())
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", mode, err)
+		}
+		if got != mode {
+			t.Errorf("got %v, want %v", got, mode)
+		}
+	}
+
+	if _, err := ParseDiscoveryMode("invalid"); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
+
+func TestInitConnectionDiscoveryMode(t *testing.T) {
+	tests := []struct {
+		url       string
+		mode      discoveryMode
+		https     bool
+		host      string
+		port      string
+		wantError bool
+	}{
+		{url: "http://localhost:4001", mode: DiscoveryModeNone, host: "localhost", port: "4001"},
+		{url: "http+dns://rqlite-headless:4003", mode: DiscoveryModeDNS, host: "rqlite-headless", port: "4003"},
+		{url: "https+dns://rqlite-headless", mode: DiscoveryModeDNS, https: true, host: "rqlite-headless", port: "4001"},
+		{url: "http+srv://rqlite.service.consul", mode: DiscoveryModeSRV, host: "rqlite.service.consul", port: "4001"},
+		{url: "http://_rqlite._tcp.svc?discovery=srv", mode: DiscoveryModeSRV, host: "_rqlite._tcp.svc", port: "4001"},
+		{url: "http://rqlite?discovery=bogus", wantError: true},
+		{url: "http+bogus://rqlite", wantError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			conn := &Connection{}
+			err := conn.initConnection(test.url)
+			if test.wantError {
+				if err == nil {
+					t.Errorf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if conn.discoveryMode != test.mode {
+				t.Errorf("got mode %v, want %v", conn.discoveryMode, test.mode)
+			}
+			if conn.wantsHTTPS != test.https {
+				t.Errorf("got wantsHTTPS %v, want %v", conn.wantsHTTPS, test.https)
+			}
+			if conn.discoveryHost != test.host {
+				t.Errorf("got host %s, want %s", conn.discoveryHost, test.host)
+			}
+			if conn.discoveryPort != test.port {
+				t.Errorf("got port %s, want %s", conn.discoveryPort, test.port)
+			}
+		})
+	}
+}
+
+func TestResolvePeers(t *testing.T) {
+	resolver := &stubResolver{
+		hosts: map[string][]string{
+			"rqlite-headless": {"10.0.0.1", "10.0.0.2", "fd00::3"},
+		},
+		srvs: map[string][]*net.SRV{
+			"_rqlite._tcp.rqlite.service.consul": {
+				{Target: "node1.example.com.", Port: 4001},
+				{Target: "node2.example.com.", Port: 4011},
+			},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		url       string
+		want      []peer
+		wantError bool
+	}{
+		{
+			name: "A/AAAA records",
+			url:  "http+dns://rqlite-headless:4003",
+			want: []peer{"10.0.0.1:4003", "10.0.0.2:4003", "[fd00::3]:4003"},
+		},
+		{
+			name: "SRV records",
+			url:  "http+srv://rqlite.service.consul",
+			want: []peer{"node1.example.com:4001", "node2.example.com:4011"},
+		},
+		{
+			name: "SRV records by full name",
+			url:  "http://_rqlite._tcp.rqlite.service.consul?discovery=srv",
+			want: []peer{"node1.example.com:4001", "node2.example.com:4011"},
+		},
+		{
+			name:      "unknown host",
+			url:       "http+dns://nowhere",
+			wantError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn := &Connection{resolver: resolver}
+			if err := conn.initConnection(test.url); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			err := conn.resolveCluster(context.Background())
+			if test.wantError {
+				if err == nil {
+					t.Errorf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(conn.cluster.PeerList(), test.want) {
+				t.Errorf("got peers %v, want %v", conn.cluster.PeerList(), test.want)
+			}
+			if conn.cluster.leader != test.want[0] {
+				t.Errorf("got leader %s, want %s", conn.cluster.leader, test.want[0])
+			}
+		})
+	}
+}
+
+func TestUpdateClusterInfoWithDiscovery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"store":{"leader":{"node_id":"n1"},"metadata":{"n1":{"api_addr":"rqlite-1:4001"}}}}`))
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	resolver := &stubResolver{
+		hosts: map[string][]string{
+			"rqlite-headless": {"10.255.255.1", u.Hostname()},
+		},
+	}
+
+	conn := &Connection{resolver: resolver}
+	if err := conn.initConnection("http+dns://rqlite-headless:" + u.Port()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// route every peer to the test server
+	conn.client = &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return net.Dial(network, u.Host)
+		},
+	}}
+
+	if err := conn.updateClusterInfo(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []peer{"rqlite-1:4001", peer("10.255.255.1:" + u.Port()), peer(u.Host)}
+	if !reflect.DeepEqual(conn.cluster.PeerList(), want) {
+		t.Errorf("got peers %v, want %v", conn.cluster.PeerList(), want)
+	}
+}
+
+func TestUpdateClusterInfoWithDiscoveryDuplicates(t *testing.T) {
+	var port string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"store":{"leader":{"node_id":"n1"},"metadata":{"n1":{"api_addr":"rqlite-1:` + port + `"}}}}`))
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	port = u.Port()
+	// the leader is reported by name, and resolved by address
+	resolver := &stubResolver{
+		hosts: map[string][]string{
+			"rqlite-headless": {"10.255.255.1", "10.255.255.2"},
+			"rqlite-1":        {"10.255.255.2"},
+		},
+	}
+
+	conn := &Connection{resolver: resolver}
+	if err := conn.initConnection("http+dns://rqlite-headless:" + port); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	conn.client = &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return net.Dial(network, u.Host)
+		},
+	}}
+
+	if err := conn.updateClusterInfo(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []peer{peer("rqlite-1:" + port), peer("10.255.255.1:" + port)}
+	if !reflect.DeepEqual(conn.cluster.PeerList(), want) {
+		t.Errorf("got peers %v, want %v", conn.cluster.PeerList(), want)
+	}
+}
+
+func TestDNSDiscoveryServerName(t *testing.T) {
+	resolver := &stubResolver{hosts: map[string][]string{"rqlite-headless": {"10.255.255.1"}}}
+	serverName := func(url string, opts ...Option) string {
+		t.Helper()
+		conn, err := OpenWithOptions(url, append(opts, WithResolver(resolver), WithClusterDiscovery(false))...)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		transport, ok := conn.client.Transport.(*http.Transport)
+		if !ok || transport.TLSClientConfig == nil {
+			return ""
+		}
+		return transport.TLSClientConfig.ServerName
+	}
+
+	if name := serverName("https+dns://rqlite-headless:4001"); name != "rqlite-headless" {
+		t.Errorf("got server name %q, want rqlite-headless", name)
+	}
+	if name := serverName("https+dns://rqlite-headless:4001", WithTLSServerName("rqlite.example.com")); name != "rqlite.example.com" {
+		t.Errorf("got server name %q, want rqlite.example.com", name)
+	}
+	// the config of the transport of the client is kept
+	pool := x509.NewCertPool()
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	conn, err := OpenWithOptions("https+dns://rqlite-headless:4001", WithHTTPClient(client), WithResolver(resolver), WithClusterDiscovery(false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config := conn.client.Transport.(*http.Transport).TLSClientConfig; config.RootCAs != pool || config.ServerName != "rqlite-headless" {
+		t.Errorf("got RootCAs %p and server name %q, want %p and rqlite-headless", config.RootCAs, config.ServerName, pool)
+	}
+	if name := serverName("http+dns://rqlite-headless:4001"); name != "" {
+		t.Errorf("got server name %q over http", name)
+	}
+}
+
+func TestRefreshWhileQuerying(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/status":
+			w.Write([]byte(`{"store":{"leader":{"node_id":"n1"},"metadata":{"n1":{"api_addr":"` + r.Host + `"}}}}`))
+		default:
+			w.Write([]byte(`{"results":[{"columns":["id"],"types":["integer"],"values":[[1]]}]}`))
+		}
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	resolver := &stubResolver{hosts: map[string][]string{"rqlite-headless": {u.Hostname()}}}
+	conn, err := OpenWithOptions("http+dns://rqlite-headless:"+u.Port(), WithResolver(resolver))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if _, err := conn.Peers(); err != nil {
+					t.Errorf("unexpected error: %v", err)
+					return
+				}
+				if _, err := conn.Leader(); err != nil {
+					t.Errorf("unexpected error: %v", err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if _, err := conn.QueryOne("SELECT 1"); err != nil {
+					t.Errorf("unexpected error: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -4,9 +4,48 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 )
 
 var _ error = StatementErrors{}
+var _ error = &StaleReadError{}
+
+// ErrStaleRead is matched by errors.Is for any *StaleReadError.
+var ErrStaleRead = errors.New("gorqlite: stale read")
+
+// staleReadMessage is the error rqlite returns when a read at level none
+// does not meet the freshness bound
+const staleReadMessage = "stale read"
+
+// StaleReadError is returned when rqlite rejects a read at consistency level
+// none because the node answering could not meet the requested freshness.
+// Callers can fall back to a read at a stronger consistency level.
+type StaleReadError struct {
+	Freshness time.Duration // the freshness bound requested
+	Strict    bool          // whether freshness_strict was requested
+}
+
+// Error returns a string representation of the stale read error.
+func (e *StaleReadError) Error() string {
+	if e.Strict {
+		return fmt.Sprintf("stale read: data older than freshness %s (strict)", e.Freshness)
+	}
+	return fmt.Sprintf("stale read: no contact with the leader within freshness %s", e.Freshness)
+}
+
+// Is returns true if the target error is ErrStaleRead.
+func (e *StaleReadError) Is(target error) bool {
+	return target == ErrStaleRead
+}
+
+// checkStaleRead turns err into a *StaleReadError if it is rqlite
+// rejecting a read as stale, and returns it unchanged otherwise
+func checkStaleRead(err error, rs requestSettings) error {
+	if err == nil || err.Error() != staleReadMessage {
+		return err
+	}
+	return &StaleReadError{Freshness: rs.freshness, Strict: rs.freshnessStrict}
+}
 
 type StatementErrors []error
 
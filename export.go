@@ -0,0 +1,280 @@
+package gorqlite
+
+/*
+	this file contains the CSV and NDJSON exports of query results
+*/
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/rqlite/gorqlite/internal/sqltok"
+)
+
+// rowEncoder writes exported rows in some format
+type rowEncoder interface {
+	header(columns []string) error
+	row(values []interface{}) error
+	flush() error
+}
+
+// csvEncoder writes rows as CSV, with a header line
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvEncoder) header(columns []string) error {
+	return e.w.Write(columns)
+}
+
+func (e *csvEncoder) row(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		s, err := formatCSVValue(v)
+		if err != nil {
+			return err
+		}
+		record[i] = s
+	}
+	return e.w.Write(record)
+}
+
+func (e *csvEncoder) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// formatCSVValue formats a value as returned by QueryResult.Slice(),
+// NULL being an empty field
+func formatCSVValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case float64:
+		// avoid the exponent format for large integers
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	default:
+		b, err := json.Marshal(v)
+		return string(b), err
+	}
+}
+
+// ndjsonEncoder writes rows as JSON objects, one per line, keeping
+// the order of the columns
+type ndjsonEncoder struct {
+	w       io.Writer
+	columns [][]byte
+	buf     bytes.Buffer
+}
+
+func (e *ndjsonEncoder) header(columns []string) error {
+	e.columns = make([][]byte, len(columns))
+	for i, column := range columns {
+		b, err := json.Marshal(column)
+		if err != nil {
+			return err
+		}
+		e.columns[i] = b
+	}
+	return nil
+}
+
+func (e *ndjsonEncoder) row(values []interface{}) error {
+	e.buf.Reset()
+	e.buf.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			e.buf.WriteByte(',')
+		}
+		e.buf.Write(e.columns[i])
+		e.buf.WriteByte(':')
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		e.buf.Write(b)
+	}
+	e.buf.WriteString("}\n")
+	_, err := e.w.Write(e.buf.Bytes())
+	return err
+}
+
+func (e *ndjsonEncoder) flush() error {
+	return nil
+}
+
+// ExportCSV writes the rows of qr left to iterate over to w as CSV,
+// after a header line holding the column names. NULL values are
+// written as empty fields, and date and datetime columns in RFC 3339.
+func ExportCSV(w io.Writer, qr *QueryResult) error {
+	e := &csvEncoder{w: csv.NewWriter(w)}
+	if err := e.header(qr.Columns()); err != nil {
+		return err
+	}
+	if _, err := exportRows(e, qr); err != nil {
+		return err
+	}
+	return e.flush()
+}
+
+// ExportNDJSON writes the rows of qr left to iterate over to w as
+// newline delimited JSON: one object per row, keyed by column name.
+// Date and datetime columns are written in RFC 3339.
+func ExportNDJSON(w io.Writer, qr *QueryResult) error {
+	e := &ndjsonEncoder{w: w}
+	if err := e.header(qr.Columns()); err != nil {
+		return err
+	}
+	_, err := exportRows(e, qr)
+	return err
+}
+
+// exportRows writes the rows left in qr, and returns their number
+func exportRows(e rowEncoder, qr *QueryResult) (int64, error) {
+	if qr.Err != nil {
+		return 0, qr.Err
+	}
+	var n int64
+	for qr.Next() {
+		values, err := qr.Slice()
+		if err != nil {
+			return n, fmt.Errorf("row %d: %w", qr.RowNumber(), err)
+		}
+		if err := e.row(values); err != nil {
+			return n, fmt.Errorf("row %d: %w", qr.RowNumber(), err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// ExportQueryCSV runs a query page by page, pageSize rows at a time,
+// and writes all its rows to w as ExportCSV does. It returns the number
+// of rows written. See ExportQueryNDJSON.
+func (conn *Connection) ExportQueryCSV(ctx context.Context, w io.Writer, statement ParameterizedStatement, pageSize int) (int64, error) {
+	e := &csvEncoder{w: csv.NewWriter(w)}
+	n, err := conn.exportQuery(ctx, e, statement, pageSize)
+	if err != nil {
+		return n, err
+	}
+	return n, e.flush()
+}
+
+// ExportQueryNDJSON runs a query page by page, pageSize rows at a time,
+// and writes all its rows to w as ExportNDJSON does. It returns the
+// number of rows written.
+//
+// Pages are read with LIMIT and OFFSET, so the query should have an
+// ORDER BY clause for the pages to be consistent, and every page is a
+// separate request: rows changed meanwhile may be missed or repeated.
+// The named parameters gorqlite_limit and gorqlite_offset are reserved
+// for the pages.
+func (conn *Connection) ExportQueryNDJSON(ctx context.Context, w io.Writer, statement ParameterizedStatement, pageSize int) (int64, error) {
+	return conn.exportQuery(ctx, &ndjsonEncoder{w: w}, statement, pageSize)
+}
+
+// exportQuery writes the rows of a query read page by page
+func (conn *Connection) exportQuery(ctx context.Context, e rowEncoder, statement ParameterizedStatement, pageSize int) (int64, error) {
+	if pageSize <= 0 {
+		return 0, fmt.Errorf("invalid page size: %d", pageSize)
+	}
+
+	query := trimQuery(statement.Query)
+	if query == "" {
+		return 0, errors.New("empty query")
+	}
+
+	var n int64
+	for page := 0; ; page++ {
+		paged, err := pageStatement(query, statement.Arguments, pageSize, page*pageSize)
+		if err != nil {
+			return n, err
+		}
+
+		trace("%s: exportQuery() reading page %d", conn.ID, page)
+		qr, err := conn.QueryOneParameterizedContext(ctx, paged)
+		if err != nil {
+			return n, err
+		}
+		if page == 0 {
+			if err := e.header(qr.Columns()); err != nil {
+				return n, err
+			}
+		}
+
+		rows, err := exportRows(e, &qr)
+		n += rows
+		if err != nil {
+			return n, err
+		}
+		if rows < int64(pageSize) {
+			return n, nil
+		}
+	}
+}
+
+// trimQuery trims the whitespace, comments and semicolons around a query,
+// for it to be wrapped: a trailing line comment would swallow the rest
+func trimQuery(query string) string {
+	tokens := sqltok.Tokenize(query)
+	trimmed := func(t sqltok.Token) bool {
+		return !t.Significant() || t.Kind == sqltok.Semicolon
+	}
+	start, end := 0, len(tokens)
+	for start < end && trimmed(tokens[start]) {
+		start++
+	}
+	for end > start && trimmed(tokens[end-1]) {
+		end--
+	}
+	if start == end {
+		return ""
+	}
+	first, last := tokens[start], tokens[end-1]
+	return query[first.Pos : last.Pos+len(last.Text)]
+}
+
+// pageStatement wraps a query to read a single page of its rows
+func pageStatement(query string, arguments []interface{}, limit, offset int) (ParameterizedStatement, error) {
+	// named parameters are passed as a single map
+	if len(arguments) == 1 {
+		if named, ok := arguments[0].(map[string]interface{}); ok {
+			for _, reserved := range []string{"gorqlite_limit", "gorqlite_offset"} {
+				if _, ok := named[reserved]; ok {
+					return ParameterizedStatement{}, fmt.Errorf("named parameter %s is reserved", reserved)
+				}
+			}
+			withPage := make(map[string]interface{}, len(named)+2)
+			for k, v := range named {
+				withPage[k] = v
+			}
+			withPage["gorqlite_limit"] = limit
+			withPage["gorqlite_offset"] = offset
+			return ParameterizedStatement{
+				Query:     "SELECT * FROM (" + query + ") LIMIT :gorqlite_limit OFFSET :gorqlite_offset",
+				Arguments: []interface{}{withPage},
+			}, nil
+		}
+	}
+
+	withPage := make([]interface{}, 0, len(arguments)+2)
+	withPage = append(withPage, arguments...)
+	withPage = append(withPage, limit, offset)
+	return ParameterizedStatement{
+		Query:     "SELECT * FROM (" + query + ") LIMIT ? OFFSET ?",
+		Arguments: withPage,
+	}, nil
+}
@@ -0,0 +1,171 @@
+package gorqlite
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func testQueryResult() QueryResult {
+	return QueryResult{
+		conn:    &Connection{},
+		columns: []string{"id", "name", "score", "created"},
+		types:   []string{"integer", "text", "real", "datetime"},
+		values: []interface{}{
+			[]interface{}{float64(1), "alice", 1.5, "2023-01-02T03:04:05Z"},
+			[]interface{}{float64(12345678901), "bob, \"the\" builder", nil, nil},
+		},
+		rowNumber: -1,
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	qr := testQueryResult()
+	var buf bytes.Buffer
+	if err := ExportCSV(&buf, &qr); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "id,name,score,created\n" +
+		"1,alice,1.5,2023-01-02T03:04:05Z\n" +
+		"12345678901,\"bob, \"\"the\"\" builder\",,\n"
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestExportNDJSON(t *testing.T) {
+	qr := testQueryResult()
+	var buf bytes.Buffer
+	if err := ExportNDJSON(&buf, &qr); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `{"id":1,"name":"alice","score":1.5,"created":"2023-01-02T03:04:05Z"}` + "\n" +
+		`{"id":12345678901,"name":"bob, \"the\" builder","score":null,"created":null}` + "\n"
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestExportRemainingRows(t *testing.T) {
+	qr := testQueryResult()
+	qr.Next()
+	var buf bytes.Buffer
+	if err := ExportNDJSON(&buf, &qr); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 1 {
+		t.Errorf("got %d rows, want 1", n)
+	}
+}
+
+func TestPageStatement(t *testing.T) {
+	stmt, err := pageStatement("SELECT * FROM foo WHERE id > ?", []interface{}{3}, 10, 20)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stmt.Query != "SELECT * FROM (SELECT * FROM foo WHERE id > ?) LIMIT ? OFFSET ?" {
+		t.Errorf("unexpected query: %s", stmt.Query)
+	}
+	if fmt.Sprint(stmt.Arguments) != "[3 10 20]" {
+		t.Errorf("unexpected arguments: %v", stmt.Arguments)
+	}
+
+	named := map[string]interface{}{"id": 3}
+	stmt, err = pageStatement("SELECT * FROM foo WHERE id > :id", []interface{}{named}, 10, 20)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stmt.Query != "SELECT * FROM (SELECT * FROM foo WHERE id > :id) LIMIT :gorqlite_limit OFFSET :gorqlite_offset" {
+		t.Errorf("unexpected query: %s", stmt.Query)
+	}
+	args := stmt.Arguments[0].(map[string]interface{})
+	if args["id"] != 3 || args["gorqlite_limit"] != 10 || args["gorqlite_offset"] != 20 {
+		t.Errorf("unexpected arguments: %v", args)
+	}
+	if len(named) != 1 {
+		t.Errorf("the arguments given were modified")
+	}
+
+	for _, reserved := range []string{"gorqlite_limit", "gorqlite_offset"} {
+		if _, err := pageStatement("SELECT * FROM foo", []interface{}{map[string]interface{}{reserved: 1}}, 10, 20); err == nil {
+			t.Errorf("expected error for the reserved parameter %s, got nil", reserved)
+		}
+	}
+}
+
+func TestTrimQuery(t *testing.T) {
+	for query, want := range map[string]string{
+		"SELECT 1":                                 "SELECT 1",
+		" SELECT 1 ;\n":                            "SELECT 1",
+		"SELECT 1 -- the first\n":                  "SELECT 1",
+		"SELECT 1; -- the first":                   "SELECT 1",
+		"/* one */ SELECT 1 /* two */;;":           "SELECT 1",
+		"SELECT '--' FROM foo -- not a string; \n": "SELECT '--' FROM foo",
+		"-- nothing\n;":                            "",
+	} {
+		if got := trimQuery(query); got != want {
+			t.Errorf("%q: got %q, want %q", query, got, want)
+		}
+	}
+}
+
+func TestExportQuery(t *testing.T) {
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var statements [][]interface{}
+		json.NewDecoder(r.Body).Decode(&statements)
+		queries = append(queries, statements[0][0].(string))
+
+		// serve 5 rows, page by page
+		limit := int(statements[0][1].(float64))
+		offset := int(statements[0][2].(float64))
+		var rows []string
+		for i := offset; i < offset+limit && i < 5; i++ {
+			rows = append(rows, fmt.Sprintf(`[%d,"row %d"]`, i, i))
+		}
+		fmt.Fprintf(w, `{"results":[{"columns":["id","name"],"types":["integer","text"],"values":[%s]}]}`, strings.Join(rows, ","))
+	}))
+	defer srv.Close()
+
+	conn, err := OpenWithOptions(srv.URL, WithClusterDiscovery(false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	n, err := conn.ExportQueryCSV(context.Background(), &buf, ParameterizedStatement{Query: "SELECT id, name FROM foo ORDER BY id; -- by id"}, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 5 {
+		t.Errorf("got %d rows, want 5", n)
+	}
+	want := "id,name\n0,row 0\n1,row 1\n2,row 2\n3,row 3\n4,row 4\n"
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+	if len(queries) != 3 {
+		t.Errorf("got %d pages, want 3", len(queries))
+	}
+	if queries[0] != "SELECT * FROM (SELECT id, name FROM foo ORDER BY id) LIMIT ? OFFSET ?" {
+		t.Errorf("unexpected query: %s", queries[0])
+	}
+
+	buf.Reset()
+	n, err = conn.ExportQueryNDJSON(context.Background(), &buf, ParameterizedStatement{Query: "SELECT id, name FROM foo ORDER BY id"}, 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 5 || !strings.HasPrefix(buf.String(), `{"id":0,"name":"row 0"}`+"\n") {
+		t.Errorf("unexpected export of %d rows:\n%s", n, buf.String())
+	}
+
+	if _, err := conn.ExportQueryCSV(context.Background(), &buf, ParameterizedStatement{Query: "SELECT 1"}, 0); err == nil {
+		t.Errorf("expected error for page size 0, got nil")
+	}
+}
@@ -0,0 +1,93 @@
+package gorqlite
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFreshness(t *testing.T) {
+	urls := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		urls <- r.URL.String()
+		switch r.URL.Query().Get("freshness") {
+		case "":
+			w.Write([]byte(`{"results":[{"columns":["id"],"types":["integer"],"values":[[1]]}]}`))
+		case "1ms":
+			w.Write([]byte(`{"error":"stale read"}`))
+		default:
+			w.Write([]byte(`{"results":[{"error":"stale read"}]}`))
+		}
+	}))
+	defer srv.Close()
+
+	t.Run("from the URL", func(t *testing.T) {
+		conn, err := OpenWithOptions(srv.URL+"?level=none&freshness=1ms&freshnessStrict=true", WithClusterDiscovery(false))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		_, err = conn.QueryOne("SELECT 1")
+		if got := <-urls; got != "/db/query?timings&level=none&freshness=1ms&freshness_strict&transaction" {
+			t.Errorf("unexpected URL: %s", got)
+		}
+
+		var staleErr *StaleReadError
+		if !errors.As(err, &staleErr) {
+			t.Fatalf("expected a *StaleReadError, got %v", err)
+		}
+		if staleErr.Freshness != time.Millisecond || !staleErr.Strict {
+			t.Errorf("unexpected stale read error: %+v", staleErr)
+		}
+		if !errors.Is(err, ErrStaleRead) {
+			t.Errorf("expected error to be ErrStaleRead")
+		}
+	})
+
+	t.Run("per query", func(t *testing.T) {
+		conn, err := OpenWithOptions(srv.URL, WithClusterDiscovery(false), WithFreshness(time.Millisecond, false))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// ignored above level none
+		if _, err := conn.QueryOne("SELECT 1"); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if got := <-urls; got != "/db/query?timings&level=weak&transaction" {
+			t.Errorf("unexpected URL: %s", got)
+		}
+
+		ctx := WithRequestOptions(context.Background(), RequestConsistencyLevel(ConsistencyLevelNone), RequestFreshness(time.Second))
+		qr, err := conn.QueryOneContext(ctx, "SELECT 1")
+		if got := <-urls; got != "/db/query?timings&level=none&freshness=1s&transaction" {
+			t.Errorf("unexpected URL: %s", got)
+		}
+		if !errors.Is(err, ErrStaleRead) {
+			t.Fatalf("expected error to be ErrStaleRead, got %v", err)
+		}
+		var staleErr *StaleReadError
+		if !errors.As(qr.Err, &staleErr) || staleErr.Freshness != time.Second {
+			t.Errorf("unexpected result error: %v", qr.Err)
+		}
+
+		// the fallback
+		ctx = WithRequestOptions(ctx, RequestConsistencyLevel(ConsistencyLevelLinearizable))
+		if _, err := conn.QueryOneContext(ctx, "SELECT 1"); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		<-urls
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if _, err := OpenWithOptions(srv.URL+"?freshness=soon", WithClusterDiscovery(false)); err == nil {
+			t.Errorf("expected error, got nil")
+		}
+		if _, err := OpenWithOptions(srv.URL, WithClusterDiscovery(false), WithFreshness(-time.Second, false)); err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+}
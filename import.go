@@ -0,0 +1,399 @@
+package gorqlite
+
+/*
+	this file contains the CSV and NDJSON imports into a table
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/rqlite/gorqlite/internal/sqltype"
+)
+
+// ImportConfig configures ImportCSV and ImportNDJSON. Zero values get
+// the defaults.
+type ImportConfig struct {
+	// ColumnTypes maps each column to its declared SQL type, which
+	// decides how values are converted. By default, the types are read
+	// from the table.
+	ColumnTypes map[string]string
+	// Columns are the columns of the NDJSON objects, in order. Defaults
+	// to the columns of ColumnTypes, or else of the table. It is
+	// ignored by ImportCSV, which reads them from the header line.
+	Columns []string
+	// EmptyAsNull makes empty CSV fields NULL in text columns too.
+	// Empty fields are always NULL in the other columns.
+	EmptyAsNull bool
+	// MaxErrors stops the import after that many line errors. Zero
+	// means no limit.
+	MaxErrors int
+	// BulkInsert configures the INSERT statements.
+	BulkInsert BulkInsertConfig
+}
+
+// ImportResult is the outcome of ImportCSV and ImportNDJSON.
+type ImportResult struct {
+	// Lines is the number of lines read, the CSV header included.
+	Lines int
+	// RowsImported is the number of rows inserted.
+	RowsImported int64
+	// Errors holds the lines that were not imported, ordered by line.
+	Errors []*LineError
+}
+
+// LineError is the error of a line not imported, or of a range of
+// lines sent together and rejected by rqlite.
+type LineError struct {
+	// Line is the line number, starting at 1.
+	Line int
+	// LastLine is the last line of the range, the same as Line for
+	// a single line.
+	LastLine int
+	Err      error
+}
+
+// Error returns a string representation of the line error.
+func (e *LineError) Error() string {
+	if e.LastLine != e.Line {
+		return fmt.Sprintf("lines %d to %d: %s", e.Line, e.LastLine, e.Err)
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+// Unwrap returns the error of the line.
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// columnAffinity returns the affinity values are converted to for a
+// column of the declared type: its SQLite affinity, except for date and
+// datetime columns, whose times are kept as text
+func columnAffinity(declaredType string) sqltype.Affinity {
+	if sqltype.IsTime(declaredType) {
+		return sqltype.Text
+	}
+	return sqltype.AffinityOf(declaredType)
+}
+
+// coerceString converts a textual value to the affinity of its column
+func coerceString(s string, aff sqltype.Affinity, emptyAsNull bool) (interface{}, error) {
+	if s == "" && (emptyAsNull || aff >= sqltype.Numeric) {
+		return nil, nil
+	}
+
+	switch aff {
+	case sqltype.Integer, sqltype.Numeric:
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i, nil
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			// integral reals are integers, as SQLite would store them
+			if aff == sqltype.Integer && f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+				return int64(f), nil
+			}
+			return f, nil
+		}
+		if b, err := strconv.ParseBool(s); err == nil {
+			if b {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		}
+		return nil, fmt.Errorf("cannot convert %q to a number", s)
+	case sqltype.Real:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot convert %q to a real", s)
+		}
+		return f, nil
+	default:
+		return s, nil
+	}
+}
+
+// coerceJSON converts a JSON value to the affinity of its column
+func coerceJSON(v interface{}, aff sqltype.Affinity) (interface{}, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case json.Number:
+		return coerceString(v.String(), aff, false)
+	case string:
+		return coerceString(v, aff, false)
+	case bool:
+		if aff >= sqltype.Numeric {
+			if v {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		}
+		return strconv.FormatBool(v), nil
+	default:
+		// objects and arrays are stored as JSON text
+		if aff >= sqltype.Numeric {
+			return nil, fmt.Errorf("cannot convert %T to a number", v)
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	}
+}
+
+// columnTypes reads the declared types of the columns of a table,
+// in order
+func (conn *Connection) columnTypes(ctx context.Context, table string) ([]string, map[string]string, error) {
+	qr, err := conn.QueryOneParameterizedContext(ctx, ParameterizedStatement{
+		Query:     "SELECT name, type FROM pragma_table_info(?)",
+		Arguments: []interface{}{table},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var columns []string
+	types := make(map[string]string)
+	for qr.Next() {
+		var name, declaredType string
+		if err := qr.Scan(&name, &declaredType); err != nil {
+			return nil, nil, err
+		}
+		columns = append(columns, name)
+		types[name] = declaredType
+	}
+	if len(columns) == 0 {
+		return nil, nil, fmt.Errorf("table %s not found", table)
+	}
+	return columns, types, nil
+}
+
+// lineParser reads the next line of an import, returning the line
+// number and the row values, or io.EOF
+type lineParser func() (int, []interface{}, error)
+
+// importRows is the RowIterator feeding an import into BulkInsert,
+// skipping and recording the lines that can't be parsed
+type importRows struct {
+	parse     lineParser
+	maxErrors int
+	lines     int
+	rowLines  []int
+	errors    []*LineError
+}
+
+// errTooManyErrors stops an import after MaxErrors line errors
+var errTooManyErrors = errors.New("too many line errors")
+
+func (ir *importRows) Next() ([]interface{}, error) {
+	for {
+		line, row, err := ir.parse()
+		if line > ir.lines {
+			ir.lines = line
+		}
+		if err == nil {
+			ir.rowLines = append(ir.rowLines, line)
+			return row, nil
+		}
+
+		var le *LineError
+		if !errors.As(err, &le) {
+			return nil, err
+		}
+		ir.errors = append(ir.errors, le)
+		if ir.maxErrors > 0 && len(ir.errors) >= ir.maxErrors {
+			return nil, errTooManyErrors
+		}
+	}
+}
+
+// runImport inserts the rows of an import, and gathers the errors by line
+func (conn *Connection) runImport(ctx context.Context, table string, columns []string, ir *importRows, config ImportConfig) (ImportResult, error) {
+	bir, err := conn.BulkInsertWithConfig(ctx, table, columns, ir, config.BulkInsert)
+
+	result := ImportResult{
+		Lines:        ir.lines,
+		RowsImported: bir.RowsInserted,
+		Errors:       ir.errors,
+	}
+	for _, ce := range bir.Errors {
+		result.Errors = append(result.Errors, &LineError{
+			Line:     ir.rowLines[ce.FirstRow],
+			LastLine: ir.rowLines[ce.FirstRow+ce.Rows-1],
+			Err:      ce.Err,
+		})
+	}
+	sort.Slice(result.Errors, func(i, j int) bool {
+		return result.Errors[i].Line < result.Errors[j].Line
+	})
+
+	trace("%s: import into %s: %d lines, %d rows imported, %d line errors", conn.ID, table, result.Lines, result.RowsImported, len(result.Errors))
+
+	var chunkErr *ChunkError
+	if err != nil && !errors.As(err, &chunkErr) {
+		return result, err
+	}
+	if len(result.Errors) > 0 {
+		return result, fmt.Errorf("%d line errors, first: %w", len(result.Errors), result.Errors[0])
+	}
+	return result, nil
+}
+
+// ImportCSV reads CSV from r and inserts its rows into table. The first
+// line is a header holding the column names.
+//
+// Each value is converted following the affinity of its column type:
+// integer, real and numeric columns get numbers, date and datetime
+// columns keep their text, and empty fields are NULL. A line that can't
+// be parsed or converted is skipped and reported, and so are the lines of
+// a chunk rejected by rqlite. The error is non-nil if any line was not
+// imported.
+func (conn *Connection) ImportCSV(ctx context.Context, r io.Reader, table string, config ImportConfig) (ImportResult, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return ImportResult{}, fmt.Errorf("reading header: %w", err)
+	}
+	columns := append([]string(nil), header...)
+
+	types := config.ColumnTypes
+	if types == nil {
+		_, types, err = conn.columnTypes(ctx, table)
+		if err != nil {
+			return ImportResult{Lines: 1}, err
+		}
+	}
+	affinities := make([]sqltype.Affinity, len(columns))
+	for i, column := range columns {
+		declaredType, ok := types[column]
+		if !ok {
+			return ImportResult{Lines: 1}, fmt.Errorf("unknown column %s", column)
+		}
+		affinities[i] = columnAffinity(declaredType)
+	}
+
+	parse := func() (int, []interface{}, error) {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return 0, nil, err
+		}
+		if err != nil {
+			var pe *csv.ParseError
+			if errors.As(err, &pe) {
+				return pe.Line, nil, &LineError{Line: pe.StartLine, LastLine: pe.Line, Err: pe.Err}
+			}
+			return 0, nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		if len(record) != len(columns) {
+			return line, nil, &LineError{Line: line, LastLine: line, Err: fmt.Errorf("got %d fields, want %d", len(record), len(columns))}
+		}
+
+		row := make([]interface{}, len(record))
+		for i, field := range record {
+			v, err := coerceString(field, affinities[i], config.EmptyAsNull)
+			if err != nil {
+				return line, nil, &LineError{Line: line, LastLine: line, Err: fmt.Errorf("column %s: %w", columns[i], err)}
+			}
+			row[i] = v
+		}
+		return line, row, nil
+	}
+
+	ir := &importRows{parse: parse, maxErrors: config.MaxErrors, lines: 1}
+	return conn.runImport(ctx, table, columns, ir, config)
+}
+
+// ImportNDJSON reads newline delimited JSON from r and inserts its rows
+// into table. Each line is an object keyed by column name: missing
+// columns are NULL, and unknown ones make the line fail.
+//
+// Values are converted as ImportCSV does, booleans becoming 1 or 0, and
+// objects and arrays being stored as JSON text. Blank lines are skipped.
+func (conn *Connection) ImportNDJSON(ctx context.Context, r io.Reader, table string, config ImportConfig) (ImportResult, error) {
+	types := config.ColumnTypes
+	columns := config.Columns
+	if types == nil {
+		var tableColumns []string
+		var err error
+		tableColumns, types, err = conn.columnTypes(ctx, table)
+		if err != nil {
+			return ImportResult{}, err
+		}
+		if columns == nil {
+			columns = tableColumns
+		}
+	}
+	if columns == nil {
+		for column := range types {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+	}
+
+	affinities := make(map[string]sqltype.Affinity, len(columns))
+	index := make(map[string]int, len(columns))
+	for i, column := range columns {
+		declaredType, ok := types[column]
+		if !ok {
+			return ImportResult{}, fmt.Errorf("unknown column %s", column)
+		}
+		affinities[column] = columnAffinity(declaredType)
+		index[column] = i
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+
+	parse := func() (int, []interface{}, error) {
+		for scanner.Scan() {
+			line++
+			text := bytes.TrimSpace(scanner.Bytes())
+			if len(text) == 0 {
+				continue
+			}
+
+			var object map[string]interface{}
+			decoder := json.NewDecoder(bytes.NewReader(text))
+			decoder.UseNumber()
+			if err := decoder.Decode(&object); err != nil {
+				return line, nil, &LineError{Line: line, LastLine: line, Err: err}
+			}
+
+			row := make([]interface{}, len(columns))
+			for column, value := range object {
+				i, ok := index[column]
+				if !ok {
+					return line, nil, &LineError{Line: line, LastLine: line, Err: fmt.Errorf("unknown column %s", column)}
+				}
+				v, err := coerceJSON(value, affinities[column])
+				if err != nil {
+					return line, nil, &LineError{Line: line, LastLine: line, Err: fmt.Errorf("column %s: %w", column, err)}
+				}
+				row[i] = v
+			}
+			return line, row, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return line, nil, err
+		}
+		return line, nil, io.EOF
+	}
+
+	ir := &importRows{parse: parse, maxErrors: config.MaxErrors}
+	return conn.runImport(ctx, table, columns, ir, config)
+}
@@ -0,0 +1,266 @@
+package gorqlite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rqlite/gorqlite/internal/sqltype"
+)
+
+func TestColumnAffinity(t *testing.T) {
+	tests := map[string]sqltype.Affinity{
+		"INTEGER":          sqltype.Integer,
+		"bigint":           sqltype.Integer,
+		"VARCHAR(255)":     sqltype.Text,
+		"TEXT":             sqltype.Text,
+		"BLOB":             sqltype.Blob,
+		"":                 sqltype.Blob,
+		"REAL":             sqltype.Real,
+		"DOUBLE PRECISION": sqltype.Real,
+		"DECIMAL(10,5)":    sqltype.Numeric,
+		"BOOLEAN":          sqltype.Numeric,
+		// times are kept as text
+		"DATETIME": sqltype.Text,
+		"date":     sqltype.Text,
+	}
+	for declaredType, want := range tests {
+		if got := columnAffinity(declaredType); got != want {
+			t.Errorf("%q: got affinity %d, want %d", declaredType, got, want)
+		}
+	}
+}
+
+func TestCoerceString(t *testing.T) {
+	tests := []struct {
+		s       string
+		aff     sqltype.Affinity
+		want    interface{}
+		wantErr bool
+	}{
+		{s: "42", aff: sqltype.Integer, want: int64(42)},
+		{s: "42.0", aff: sqltype.Integer, want: int64(42)},
+		{s: "42.5", aff: sqltype.Integer, want: 42.5},
+		{s: "true", aff: sqltype.Integer, want: int64(1)},
+		{s: "abc", aff: sqltype.Integer, wantErr: true},
+		{s: "", aff: sqltype.Integer, want: nil},
+		{s: "42", aff: sqltype.Real, want: float64(42)},
+		{s: "abc", aff: sqltype.Real, wantErr: true},
+		{s: "42.0", aff: sqltype.Numeric, want: 42.0},
+		{s: "42", aff: sqltype.Text, want: "42"},
+		{s: "", aff: sqltype.Text, want: ""},
+		{s: "", aff: sqltype.Blob, want: ""},
+	}
+	for _, test := range tests {
+		got, err := coerceString(test.s, test.aff, false)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%q as %d: expected error, got nil", test.s, test.aff)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q as %d: unexpected error: %v", test.s, test.aff, err)
+		}
+		if got != test.want {
+			t.Errorf("%q as %d: got %#v, want %#v", test.s, test.aff, got, test.want)
+		}
+	}
+
+	if got, _ := coerceString("", sqltype.Text, true); got != nil {
+		t.Errorf("got %#v, want nil with EmptyAsNull", got)
+	}
+}
+
+// importServer serves the columns of a users table, and records the
+// inserted rows, rejecting the statements having a "reject" argument
+type importServer struct {
+	*httptest.Server
+	mu   sync.Mutex
+	rows [][]interface{}
+}
+
+func newImportServer(t *testing.T) *importServer {
+	is := &importServer{}
+	is.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var statements [][]interface{}
+		d := json.NewDecoder(r.Body)
+		d.UseNumber()
+		if err := d.Decode(&statements); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if r.URL.Path == "/db/query" {
+			values := ""
+			if statements[0][1] == "users" {
+				values = `["id","INTEGER"],["name","TEXT"],["score","REAL"],["active","BOOLEAN"]`
+			}
+			fmt.Fprintf(w, `{"results":[{"columns":["name","type"],"types":["text","text"],"values":[%s]}]}`, values)
+			return
+		}
+
+		results := make([]string, len(statements))
+		for i, stmt := range statements {
+			results[i] = fmt.Sprintf(`{"rows_affected":%d}`, (len(stmt)-1)/4)
+			for _, arg := range stmt[1:] {
+				if arg == "reject" {
+					results[i] = `{"error":"UNIQUE constraint failed"}`
+				}
+			}
+		}
+		is.mu.Lock()
+		for _, stmt := range statements {
+			for i := 1; i+4 <= len(stmt); i += 4 {
+				is.rows = append(is.rows, stmt[i:i+4])
+			}
+		}
+		is.mu.Unlock()
+		w.Write([]byte(`{"results":[` + strings.Join(results, ",") + `]}`))
+	}))
+	t.Cleanup(is.Close)
+	return is
+}
+
+func TestImportCSV(t *testing.T) {
+	is := newImportServer(t)
+	conn, err := OpenWithOptions(is.URL, WithClusterDiscovery(false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	input := "id,name,score,active\n" +
+		"1,alice,1.5,true\n" +
+		"2,\"bob\nthe builder\",,0\n" +
+		"x,carol,2,1\n" +
+		"4,dave,2\n" +
+		"5,,3,false\n"
+	result, err := conn.ImportCSV(context.Background(), strings.NewReader(input), "users", ImportConfig{})
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if result.RowsImported != 3 || result.Lines != 7 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if len(result.Errors) != 2 {
+		t.Fatalf("got %d line errors, want 2: %v", len(result.Errors), result.Errors)
+	}
+	if result.Errors[0].Line != 5 || !strings.Contains(result.Errors[0].Error(), "column id") {
+		t.Errorf("unexpected first error: %v", result.Errors[0])
+	}
+	if result.Errors[1].Line != 6 || !strings.Contains(result.Errors[1].Error(), "got 3 fields") {
+		t.Errorf("unexpected second error: %v", result.Errors[1])
+	}
+
+	want := [][]interface{}{
+		{json.Number("1"), "alice", json.Number("1.5"), json.Number("1")},
+		{json.Number("2"), "bob\nthe builder", nil, json.Number("0")},
+		{json.Number("5"), "", json.Number("3"), json.Number("0")},
+	}
+	if !reflect.DeepEqual(is.rows, want) {
+		t.Errorf("got rows %v, want %v", is.rows, want)
+	}
+}
+
+func TestImportNDJSON(t *testing.T) {
+	is := newImportServer(t)
+	conn, err := OpenWithOptions(is.URL, WithClusterDiscovery(false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	input := `{"id":1,"name":"alice","score":1.5,"active":true}` + "\n" +
+		"\n" +
+		`{"id":"2","name":{"first":"bob"}}` + "\n" +
+		`{"id":3,"nickname":"c"}` + "\n" +
+		`{"id":4,` + "\n" +
+		`{"id":5,"score":"high"}` + "\n"
+	result, err := conn.ImportNDJSON(context.Background(), strings.NewReader(input), "users", ImportConfig{})
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if result.RowsImported != 2 || result.Lines != 6 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	var lines []int
+	for _, le := range result.Errors {
+		lines = append(lines, le.Line)
+	}
+	if fmt.Sprint(lines) != "[4 5 6]" {
+		t.Errorf("got errors on lines %v, want [4 5 6]: %v", lines, result.Errors)
+	}
+
+	want := [][]interface{}{
+		{json.Number("1"), "alice", json.Number("1.5"), json.Number("1")},
+		{json.Number("2"), `{"first":"bob"}`, nil, nil},
+	}
+	if !reflect.DeepEqual(is.rows, want) {
+		t.Errorf("got rows %v, want %v", is.rows, want)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	is := newImportServer(t)
+	conn, err := OpenWithOptions(is.URL, WithClusterDiscovery(false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	t.Run("rejected chunk", func(t *testing.T) {
+		input := "id,name\n1,a\n2,b\n3,reject\n4,d\n"
+		config := ImportConfig{BulkInsert: BulkInsertConfig{RowsPerChunk: 2}}
+		result, err := conn.ImportCSV(context.Background(), strings.NewReader(input), "users", config)
+		if err == nil {
+			t.Fatalf("expected error, got nil")
+		}
+		if len(result.Errors) != 1 {
+			t.Fatalf("got %d line errors, want 1", len(result.Errors))
+		}
+		le := result.Errors[0]
+		if le.Line != 4 || le.LastLine != 5 || !strings.HasPrefix(le.Error(), "lines 4 to 5:") || !strings.Contains(le.Error(), "UNIQUE") {
+			t.Errorf("unexpected error: %v", le)
+		}
+	})
+
+	t.Run("max errors", func(t *testing.T) {
+		input := "id\nx\ny\nz\n"
+		result, err := conn.ImportCSV(context.Background(), strings.NewReader(input), "users", ImportConfig{MaxErrors: 2})
+		if !errors.Is(err, errTooManyErrors) {
+			t.Errorf("got %v, want errTooManyErrors", err)
+		}
+		if len(result.Errors) != 2 {
+			t.Errorf("got %d line errors, want 2", len(result.Errors))
+		}
+	})
+
+	t.Run("unknown table", func(t *testing.T) {
+		_, err := conn.ImportCSV(context.Background(), strings.NewReader("id\n1\n"), "nope", ImportConfig{})
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("got %v, want a table not found error", err)
+		}
+	})
+
+	t.Run("unknown column", func(t *testing.T) {
+		_, err := conn.ImportCSV(context.Background(), strings.NewReader("id,nickname\n1,a\n"), "users", ImportConfig{})
+		if err == nil || !strings.Contains(err.Error(), "unknown column nickname") {
+			t.Errorf("got %v, want an unknown column error", err)
+		}
+	})
+
+	t.Run("given column types", func(t *testing.T) {
+		config := ImportConfig{
+			ColumnTypes: map[string]string{"b": "TEXT", "a": "INTEGER"},
+		}
+		_, err := conn.ImportNDJSON(context.Background(), strings.NewReader(`{"a":1,"b":"x"}`), "other", config)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
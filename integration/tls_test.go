@@ -0,0 +1,244 @@
+package integration
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// testCA is a throwaway certificate authority issuing the
+// certificates of the TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating CA key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gorqlite test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating CA certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parsing CA certificate: %v", err)
+	}
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue returns a PEM certificate and key signed by the CA
+func (ca *testCA) issue(t *testing.T, serial int64, usage x509.ExtKeyUsage, dnsNames []string, ips []net.IP) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "gorqlite test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshaling key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("writing %s: %v", name, err)
+	}
+	return path
+}
+
+// newTLSServer starts a TLS server answering queries like rqlite would,
+// with a certificate valid for rqlite.example.com only, and requiring
+// client certificates if clientCAs is set
+func newTLSServer(t *testing.T, ca *testCA, clientCAs *x509.CertPool) *httptest.Server {
+	certPEM, keyPEM := ca.issue(t, 2, x509.ExtKeyUsageServerAuth, []string{"rqlite.example.com"}, nil)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("loading server certificate: %v", err)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"results":[{"columns":["id"],"types":["integer"],"values":[[1]]}]}`))
+	}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	if clientCAs != nil {
+		srv.TLS.ClientCAs = clientCAs
+		srv.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func queryOverTLS(connURL string, opts ...gorqlite.Option) error {
+	opts = append(opts, gorqlite.WithClusterDiscovery(false))
+	conn, err := gorqlite.OpenWithOptions(connURL, opts...)
+	if err != nil {
+		return err
+	}
+	_, err = conn.QueryOne("SELECT 1")
+	return err
+}
+
+func TestTLSServerVerification(t *testing.T) {
+	ca := newTestCA(t)
+	srv := newTLSServer(t, ca, nil)
+	caFile := writeFile(t, t.TempDir(), "ca.pem", ca.pem)
+
+	u, _ := url.Parse(srv.URL)
+	base := "https://" + u.Host
+
+	tests := []struct {
+		name    string
+		url     string
+		opts    []gorqlite.Option
+		wantErr bool
+	}{
+		{
+			name:    "untrusted CA",
+			url:     base + "?tlsServerName=rqlite.example.com",
+			wantErr: true,
+		},
+		{
+			name:    "wrong server name",
+			url:     base + "?tlsCACert=" + url.QueryEscape(caFile),
+			wantErr: true,
+		},
+		{
+			name: "CA bundle and server name in URL",
+			url:  base + "?tlsCACert=" + url.QueryEscape(caFile) + "&tlsServerName=rqlite.example.com",
+		},
+		{
+			name: "CA bundle and server name as options",
+			url:  base,
+			opts: []gorqlite.Option{gorqlite.WithTLSCACert(caFile), gorqlite.WithTLSServerName("rqlite.example.com")},
+		},
+		{
+			name: "option overriding URL",
+			url:  base + "?tlsCACert=" + url.QueryEscape(caFile) + "&tlsServerName=wrong.example.com",
+			opts: []gorqlite.Option{gorqlite.WithTLSServerName("rqlite.example.com")},
+		},
+		{
+			name: "insecure skip verify",
+			url:  base + "?tlsInsecureSkipVerify=true",
+		},
+		{
+			name:    "missing CA bundle",
+			url:     base + "?tlsCACert=/nonexistent/ca.pem",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := queryOverTLS(test.url, test.opts...)
+			if test.wantErr && err == nil {
+				t.Errorf("expected error, got nil")
+			}
+			if !test.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestTLSClientCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+	srv := newTLSServer(t, ca, clientCAs)
+
+	dir := t.TempDir()
+	caFile := writeFile(t, dir, "ca.pem", ca.pem)
+	certPEM, keyPEM := ca.issue(t, 3, x509.ExtKeyUsageClientAuth, nil, nil)
+	certFile := writeFile(t, dir, "client.pem", certPEM)
+	keyFile := writeFile(t, dir, "client-key.pem", keyPEM)
+
+	u, _ := url.Parse(srv.URL)
+	base := "https://" + u.Host + "?tlsServerName=rqlite.example.com&tlsCACert=" + url.QueryEscape(caFile)
+
+	t.Run("without client certificate", func(t *testing.T) {
+		if err := queryOverTLS(base); err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+
+	t.Run("client certificate in URL", func(t *testing.T) {
+		connURL := base + "&tlsCert=" + url.QueryEscape(certFile) + "&tlsKey=" + url.QueryEscape(keyFile)
+		if err := queryOverTLS(connURL); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("client certificate as option", func(t *testing.T) {
+		if err := queryOverTLS(base, gorqlite.WithTLSClientCert(certFile, keyFile)); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("client certificate without key", func(t *testing.T) {
+		if err := queryOverTLS(base + "&tlsCert=" + url.QueryEscape(certFile)); err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+
+	t.Run("on top of a TLS config", func(t *testing.T) {
+		config := &tls.Config{ServerName: "rqlite.example.com"}
+		connURL := "https://" + u.Host + "?tlsCACert=" + url.QueryEscape(caFile)
+		err := queryOverTLS(connURL, gorqlite.WithTLSConfig(config), gorqlite.WithTLSClientCert(certFile, keyFile))
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if config.RootCAs != nil || config.Certificates != nil {
+			t.Errorf("the TLS config given was modified")
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package gorqlite
+
+/*
+	this file contains the interceptors of a connection, run around
+	every attempt of a request to a peer
+*/
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Call is an attempt of a request to a peer, as seen by interceptors.
+type Call struct {
+	// Op is the API operation: "query", "write", "request", "status",
+	// "nodes", "backup", "load" or "readyz".
+	Op string
+	// Statements are the statements sent, nil for the operations
+	// without any.
+	Statements []ParameterizedStatement
+	// ConsistencyLevel is the consistency level of the request.
+	ConsistencyLevel consistencyLevel
+	// Peer is the host:port of the peer asked.
+	Peer string
+	// Retry is the pass over the peer list, 0 for the first, see
+	// WithRetry.
+	Retry int
+	// Request is the HTTP request to send. Interceptors may change it,
+	// or replace it, before calling the next one.
+	Request *http.Request
+}
+
+// Invoker sends the request of a call, and returns the response.
+type Invoker func(call *Call) (*http.Response, error)
+
+// Interceptor runs around the sending of the request of a call, within
+// the failover over the peers: a failure, be it an error or a status
+// other than 200 OK, makes the request go on to the next peer. It calls
+// next to go on, or returns a response or error of its own instead.
+//
+// For example, to send a header with every request:
+//
+//	func(call *gorqlite.Call, next gorqlite.Invoker) (*http.Response, error) {
+//		call.Request.Header.Set("X-Request-Source", "billing")
+//		return next(call)
+//	}
+type Interceptor func(call *Call, next Invoker) (*http.Response, error)
+
+// WithInterceptors adds interceptors to the connection, run in the
+// order given, the first one running outermost. Options given more than
+// once add to each other.
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(conn *Connection) error {
+		for _, interceptor := range interceptors {
+			if interceptor == nil {
+				return errors.New("interceptor is nil")
+			}
+		}
+		conn.interceptors = append(conn.interceptors, interceptors...)
+		return nil
+	}
+}
+
+// invoke sends the request of the call through the interceptors, then
+// the HTTP client
+func (conn *Connection) invoke(call *Call) (*http.Response, error) {
+	response, err := conn.invoker(0)(call)
+	if err != nil {
+		return nil, err
+	}
+	if response == nil {
+		return nil, errors.New("interceptor returned neither a response nor an error")
+	}
+	if response.Body == nil {
+		response.Body = http.NoBody
+	}
+	return response, nil
+}
+
+// invoker returns the invoker running the interceptors from the i-th
+func (conn *Connection) invoker(i int) Invoker {
+	if i == len(conn.interceptors) {
+		return func(call *Call) (*http.Response, error) {
+			return conn.do(call.Request)
+		}
+	}
+	return func(call *Call) (*http.Response, error) {
+		return conn.interceptors[i](call, conn.invoker(i+1))
+	}
+}
@@ -0,0 +1,76 @@
+package gorqlite
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithInterceptors(t *testing.T) {
+	var headers []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header.Get("X-Request-Source"))
+		w.Write([]byte(`{"results":[{"rows_affected":1}]}`))
+	}))
+	defer srv.Close()
+
+	var order []string
+	var audited []Call
+	audit := func(call *Call, next Invoker) (*http.Response, error) {
+		order = append(order, "audit")
+		audited = append(audited, *call)
+		return next(call)
+	}
+	header := func(call *Call, next Invoker) (*http.Response, error) {
+		order = append(order, "header")
+		call.Request.Header.Set("X-Request-Source", "billing")
+		return next(call)
+	}
+	// fails the first pass over the peers, without reaching rqlite
+	fault := func(call *Call, next Invoker) (*http.Response, error) {
+		order = append(order, "fault")
+		if call.Retry == 0 {
+			return &http.Response{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable", Body: io.NopCloser(strings.NewReader("injected"))}, nil
+		}
+		return next(call)
+	}
+
+	conn, err := OpenWithOptions(srv.URL+"?level=strong", WithClusterDiscovery(false), WithRetry(2, 0),
+		WithInterceptors(audit, header), WithInterceptors(fault))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	statements := []ParameterizedStatement{{Query: "INSERT INTO foo VALUES (?)", Arguments: []interface{}{1}}}
+	if _, err := conn.WriteParameterized(statements); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := "audit header fault audit header fault"; strings.Join(order, " ") != want {
+		t.Errorf("got order %v, want %s", order, want)
+	}
+	if len(headers) != 1 || headers[0] != "billing" {
+		t.Errorf("got headers %v, want one billing", headers)
+	}
+	call := audited[1]
+	if call.Op != "write" || call.Retry != 1 || call.ConsistencyLevel != ConsistencyLevelStrong ||
+		call.Peer != strings.TrimPrefix(srv.URL, "http://") || len(call.Statements) != 1 || call.Statements[0].Query != statements[0].Query {
+		t.Errorf("unexpected call: %+v", call)
+	}
+
+	// a short-circuit failing every time
+	failing, err := OpenWithOptions(srv.URL, WithClusterDiscovery(false), WithInterceptors(func(call *Call, next Invoker) (*http.Response, error) {
+		return nil, nil
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := failing.Status(); err == nil || !strings.Contains(err.Error(), "interceptor returned neither") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if _, err := OpenWithOptions(srv.URL, WithInterceptors(nil)); err == nil {
+		t.Errorf("expected error for a nil interceptor, got nil")
+	}
+}
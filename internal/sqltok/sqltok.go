@@ -0,0 +1,309 @@
+// Package sqltok is a lexer for the SQL dialect of SQLite, good enough
+// to split scripts into statements and to find their parameters,
+// without parsing them.
+package sqltok
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Kind is the kind of a token.
+type Kind int
+
+const (
+	// Whitespace is a run of spaces, tabs and newlines.
+	Whitespace Kind = iota
+	// Comment is a -- line comment, or a /* block comment */.
+	Comment
+	// Word is a keyword or a bare identifier.
+	Word
+	// QuotedIdent is an identifier quoted with "", `` or [].
+	QuotedIdent
+	// String is a 'string literal'.
+	String
+	// Blob is an X'hex' blob literal.
+	Blob
+	// Number is a numeric literal.
+	Number
+	// Param is a parameter: ?, ?NNN, :name, @name or $name.
+	Param
+	// Semicolon ends a statement.
+	Semicolon
+	// Punct is any other character, or an operator.
+	Punct
+)
+
+// Token is a token of an SQL text.
+type Token struct {
+	Kind Kind
+	// Text is the text of the token, quotes included.
+	Text string
+	// Pos is the byte offset of the token in the SQL text.
+	Pos int
+}
+
+// Is tells whether the token is the given keyword, ignoring case.
+func (t Token) Is(keyword string) bool {
+	return t.Kind == Word && strings.EqualFold(t.Text, keyword)
+}
+
+// Ident returns the name of an identifier token, unquoted, or the text
+// of a string token, since SQLite accepts 'strings' as identifiers.
+func (t Token) Ident() string {
+	switch t.Kind {
+	case QuotedIdent:
+		if t.Text[0] == '[' {
+			return strings.TrimSuffix(t.Text[1:], "]")
+		}
+		return unquote(t.Text)
+	case String:
+		return unquote(t.Text)
+	default:
+		return t.Text
+	}
+}
+
+// unquote removes the quotes around s, and undoubles the inner ones
+func unquote(s string) string {
+	q := s[:1]
+	s = s[1:]
+	if strings.HasSuffix(s, q) {
+		s = s[:len(s)-1]
+	}
+	return strings.ReplaceAll(s, q+q, q)
+}
+
+// Significant tells whether the token is neither whitespace nor a comment.
+func (t Token) Significant() bool {
+	return t.Kind != Whitespace && t.Kind != Comment
+}
+
+// Tokenize splits an SQL text into tokens. It never fails: an
+// unterminated string, identifier or comment runs to the end.
+func Tokenize(sql string) []Token {
+	var tokens []Token
+	for pos := 0; pos < len(sql); {
+		kind, end := next(sql, pos)
+		tokens = append(tokens, Token{Kind: kind, Text: sql[pos:end], Pos: pos})
+		pos = end
+	}
+	return tokens
+}
+
+// next returns the kind and end of the token starting at pos
+func next(sql string, pos int) (Kind, int) {
+	c := sql[pos]
+	switch {
+	case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v':
+		end := pos + 1
+		for end < len(sql) && strings.IndexByte(" \t\n\r\f\v", sql[end]) >= 0 {
+			end++
+		}
+		return Whitespace, end
+	case c == '-' && strings.HasPrefix(sql[pos:], "--"):
+		end := strings.IndexByte(sql[pos:], '\n')
+		if end < 0 {
+			return Comment, len(sql)
+		}
+		return Comment, pos + end + 1
+	case c == '/' && strings.HasPrefix(sql[pos:], "/*"):
+		end := strings.Index(sql[pos+2:], "*/")
+		if end < 0 {
+			return Comment, len(sql)
+		}
+		return Comment, pos + 2 + end + 2
+	case c == '\'':
+		return String, quoted(sql, pos, '\'')
+	case c == '"':
+		return QuotedIdent, quoted(sql, pos, '"')
+	case c == '`':
+		return QuotedIdent, quoted(sql, pos, '`')
+	case c == '[':
+		end := strings.IndexByte(sql[pos:], ']')
+		if end < 0 {
+			return QuotedIdent, len(sql)
+		}
+		return QuotedIdent, pos + end + 1
+	case (c == 'x' || c == 'X') && pos+1 < len(sql) && sql[pos+1] == '\'':
+		return Blob, quoted(sql, pos+1, '\'')
+	case c >= '0' && c <= '9', c == '.' && pos+1 < len(sql) && sql[pos+1] >= '0' && sql[pos+1] <= '9':
+		return Number, number(sql, pos)
+	case c == '?':
+		end := pos + 1
+		for end < len(sql) && sql[end] >= '0' && sql[end] <= '9' {
+			end++
+		}
+		return Param, end
+	case c == ':' || c == '@' || c == '$':
+		end := word(sql, pos+1)
+		if end == pos+1 {
+			return Punct, end
+		}
+		return Param, end
+	case c == ';':
+		return Semicolon, pos + 1
+	case isWordStart(sql, pos):
+		return Word, word(sql, pos)
+	default:
+		return Punct, operator(sql, pos)
+	}
+}
+
+// quoted returns the end of a token quoted with q, where doubled
+// quotes stand for a single one
+func quoted(sql string, pos int, q byte) int {
+	for end := pos + 1; end < len(sql); end++ {
+		if sql[end] == q {
+			if end+1 < len(sql) && sql[end+1] == q {
+				end++
+				continue
+			}
+			return end + 1
+		}
+	}
+	return len(sql)
+}
+
+func number(sql string, pos int) int {
+	end := pos
+	if strings.HasPrefix(sql[pos:], "0x") || strings.HasPrefix(sql[pos:], "0X") {
+		end += 2
+		for end < len(sql) && strings.IndexByte("0123456789abcdefABCDEF", sql[end]) >= 0 {
+			end++
+		}
+		return end
+	}
+	for end < len(sql) && (sql[end] >= '0' && sql[end] <= '9' || sql[end] == '.' || sql[end] == '_') {
+		end++
+	}
+	if end < len(sql) && (sql[end] == 'e' || sql[end] == 'E') {
+		exp := end + 1
+		if exp < len(sql) && (sql[exp] == '+' || sql[exp] == '-') {
+			exp++
+		}
+		if exp < len(sql) && sql[exp] >= '0' && sql[exp] <= '9' {
+			end = exp
+			for end < len(sql) && sql[end] >= '0' && sql[end] <= '9' {
+				end++
+			}
+		}
+	}
+	return end
+}
+
+func isWordStart(sql string, pos int) bool {
+	r, _ := utf8.DecodeRuneInString(sql[pos:])
+	return r == '_' || unicode.IsLetter(r) || r >= utf8.RuneSelf
+}
+
+// word returns the end of an identifier starting at pos
+func word(sql string, pos int) int {
+	end := pos
+	for end < len(sql) {
+		r, size := utf8.DecodeRuneInString(sql[end:])
+		if r != '_' && r != '$' && !unicode.IsLetter(r) && !unicode.IsDigit(r) && r < utf8.RuneSelf {
+			break
+		}
+		end += size
+	}
+	return end
+}
+
+// operators are the operators of more than one character
+var operators = []string{"||", "->>", "->", "<<", ">>", "<=", ">=", "==", "!=", "<>"}
+
+func operator(sql string, pos int) int {
+	for _, op := range operators {
+		if strings.HasPrefix(sql[pos:], op) {
+			return pos + len(op)
+		}
+	}
+	_, size := utf8.DecodeRuneInString(sql[pos:])
+	return pos + size
+}
+
+// Statement is a statement of an SQL script.
+type Statement struct {
+	// Text is the text of the statement, without the leading whitespace
+	// and comments, nor the final semicolon.
+	Text string
+	// Tokens are the tokens of Text.
+	Tokens []Token
+}
+
+// Split splits an SQL script into its statements, dropping the empty
+// ones. Semicolons within the BEGIN ... END body of a CREATE TRIGGER
+// statement don't end it.
+func Split(sql string) []Statement {
+	var statements []Statement
+	var current []Token
+	depth := 0
+	trigger := false
+
+	flush := func() {
+		// trim the whitespace and comments around the statement
+		start, end := 0, len(current)
+		for start < end && !current[start].Significant() {
+			start++
+		}
+		for end > start && !current[end-1].Significant() {
+			end--
+		}
+		if start < end {
+			tokens := current[start:end]
+			first, last := tokens[0], tokens[len(tokens)-1]
+			statements = append(statements, Statement{
+				Text:   sql[first.Pos : last.Pos+len(last.Text)],
+				Tokens: tokens,
+			})
+		}
+		current = nil
+		depth = 0
+		trigger = false
+	}
+
+	for _, t := range Tokenize(sql) {
+		if t.Kind == Semicolon && depth == 0 {
+			flush()
+			continue
+		}
+		current = append(current, t)
+		if t.Kind != Word {
+			continue
+		}
+
+		switch {
+		case t.Is("TRIGGER") && isCreate(current):
+			trigger = true
+		case trigger && (t.Is("BEGIN") || t.Is("CASE")):
+			depth++
+		case trigger && t.Is("END") && depth > 0:
+			depth--
+		}
+	}
+	flush()
+	return statements
+}
+
+// isCreate tells whether the statement so far starts with CREATE
+func isCreate(tokens []Token) bool {
+	for _, t := range tokens {
+		if t.Significant() {
+			return t.Is("CREATE")
+		}
+	}
+	return false
+}
+
+// Params returns the parameter tokens of a statement, in order.
+func Params(tokens []Token) []Token {
+	var params []Token
+	for _, t := range tokens {
+		if t.Kind == Param {
+			params = append(params, t)
+		}
+	}
+	return params
+}
@@ -0,0 +1,111 @@
+package sqltok
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	sql := `SELECT "a""b", [c d], 'it''s', x'0A', 1.5e3, ?, ?12, :name, @n, $v -- note
+/* block */ FROM t WHERE a->>'$.x' <> 0;`
+
+	var got []Token
+	for _, tok := range Tokenize(sql) {
+		if tok.Kind != Whitespace {
+			got = append(got, Token{Kind: tok.Kind, Text: tok.Text})
+		}
+	}
+	want := []Token{
+		{Word, "SELECT", 0}, {QuotedIdent, `"a""b"`, 0}, {Punct, ",", 0},
+		{QuotedIdent, "[c d]", 0}, {Punct, ",", 0},
+		{String, "'it''s'", 0}, {Punct, ",", 0},
+		{Blob, "x'0A'", 0}, {Punct, ",", 0},
+		{Number, "1.5e3", 0}, {Punct, ",", 0},
+		{Param, "?", 0}, {Punct, ",", 0},
+		{Param, "?12", 0}, {Punct, ",", 0},
+		{Param, ":name", 0}, {Punct, ",", 0},
+		{Param, "@n", 0}, {Punct, ",", 0},
+		{Param, "$v", 0},
+		{Comment, "-- note\n", 0},
+		{Comment, "/* block */", 0},
+		{Word, "FROM", 0}, {Word, "t", 0}, {Word, "WHERE", 0},
+		{Word, "a", 0}, {Punct, "->>", 0}, {String, "'$.x'", 0},
+		{Punct, "<>", 0}, {Number, "0", 0},
+		{Semicolon, ";", 0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %v\nwant %v", got, want)
+	}
+}
+
+func TestTokenizeUnterminated(t *testing.T) {
+	for _, sql := range []string{"SELECT 'abc", `SELECT "abc`, "SELECT [abc", "SELECT /* abc", "SELECT -- abc"} {
+		tokens := Tokenize(sql)
+		last := tokens[len(tokens)-1]
+		if last.Pos+len(last.Text) != len(sql) {
+			t.Errorf("%q: last token %q does not run to the end", sql, last.Text)
+		}
+	}
+}
+
+func TestIdent(t *testing.T) {
+	tests := map[string]string{
+		`"a""b"`: `a"b`,
+		"`a``b`": "a`b",
+		"[a b]":  "a b",
+		"'a''b'": "a'b",
+		"abc":    "abc",
+	}
+	for text, want := range tests {
+		tok := Tokenize(text)[0]
+		if got := tok.Ident(); got != want {
+			t.Errorf("%s: got %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	sql := `-- create the tables
+CREATE TABLE a (id INTEGER, note TEXT DEFAULT ';');
+CREATE TABLE b (id INTEGER); ;
+
+CREATE TRIGGER a_insert AFTER INSERT ON a
+WHEN new.id > 0
+BEGIN
+  INSERT INTO b VALUES (CASE WHEN new.id > 10 THEN 1 ELSE 0 END);
+  UPDATE a SET note = 'x;y' WHERE id = new.id;
+END;
+BEGIN;
+INSERT INTO a VALUES (1, 'a') /* trailing comment */
+`
+	var got []string
+	for _, stmt := range Split(sql) {
+		got = append(got, stmt.Text)
+	}
+	want := []string{
+		"CREATE TABLE a (id INTEGER, note TEXT DEFAULT ';')",
+		"CREATE TABLE b (id INTEGER)",
+		`CREATE TRIGGER a_insert AFTER INSERT ON a
+WHEN new.id > 0
+BEGIN
+  INSERT INTO b VALUES (CASE WHEN new.id > 10 THEN 1 ELSE 0 END);
+  UPDATE a SET note = 'x;y' WHERE id = new.id;
+END`,
+		"BEGIN",
+		"INSERT INTO a VALUES (1, 'a')",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestParams(t *testing.T) {
+	stmts := Split("SELECT * FROM t WHERE a = ? AND b = :b AND c = '?' -- ?")
+	var got []string
+	for _, p := range Params(stmts[0].Tokens) {
+		got = append(got, p.Text)
+	}
+	if !reflect.DeepEqual(got, []string{"?", ":b"}) {
+		t.Errorf("got %v", got)
+	}
+}
@@ -0,0 +1,64 @@
+// Package sqltype classifies the types declared for SQLite columns: by
+// the type affinity SQLite derives from them, and by whether gorqlite
+// reads their values as times. gorqlite, its database/sql driver and
+// gorqlite-gen all share it, so that a declared type means the same
+// everywhere.
+package sqltype
+
+import "strings"
+
+// Affinity is the type affinity of a column, see
+// https://www.sqlite.org/datatype3.html#determination_of_column_affinity
+type Affinity int
+
+const (
+	// Blob columns store values as given. Columns without a declared
+	// type, such as expressions, have this affinity.
+	Blob Affinity = iota
+	// Text columns store numbers as text.
+	Text
+	// Numeric columns store text as a number when it is one. Numeric,
+	// Integer and Real are the numeric affinities, and the only ones at
+	// or above Numeric.
+	Numeric
+	// Integer columns are numeric columns storing integral reals as
+	// integers.
+	Integer
+	// Real columns store numbers as reals.
+	Real
+)
+
+// Name returns the declared type without its size, in upper case:
+// VARCHAR for "varchar(255)"
+func Name(declared string) string {
+	if i := strings.IndexByte(declared, '('); i >= 0 {
+		declared = declared[:i]
+	}
+	return strings.ToUpper(strings.TrimSpace(declared))
+}
+
+// AffinityOf returns the affinity of a declared type, following the
+// rules of SQLite, in order.
+func AffinityOf(declared string) Affinity {
+	name := Name(declared)
+	switch {
+	case strings.Contains(name, "INT"):
+		return Integer
+	case strings.Contains(name, "CHAR"), strings.Contains(name, "CLOB"), strings.Contains(name, "TEXT"):
+		return Text
+	case name == "", strings.Contains(name, "BLOB"):
+		return Blob
+	case strings.Contains(name, "REAL"), strings.Contains(name, "FLOA"), strings.Contains(name, "DOUB"):
+		return Real
+	}
+	return Numeric
+}
+
+// IsTime reports whether the values of columns of the declared type are
+// read as time.Time by gorqlite: those of date and datetime columns,
+// whatever the case of their declared type. SQLite itself has no time
+// type, and gives them the numeric affinity.
+func IsTime(declared string) bool {
+	name := Name(declared)
+	return name == "DATE" || name == "DATETIME"
+}
@@ -0,0 +1,53 @@
+package sqltype
+
+import "testing"
+
+func TestAffinityOf(t *testing.T) {
+	tests := map[string]Affinity{
+		"INTEGER":          Integer,
+		"bigint":           Integer,
+		"UNSIGNED BIG INT": Integer,
+		"varchar(255)":     Text,
+		"NCHAR(55)":        Text,
+		"clob":             Text,
+		"TEXT":             Text,
+		"BLOB":             Blob,
+		"":                 Blob,
+		"REAL":             Real,
+		"double precision": Real,
+		"FLOAT":            Real,
+		"NUMERIC":          Numeric,
+		"DECIMAL(10,5)":    Numeric,
+		"BOOLEAN":          Numeric,
+		"datetime":         Numeric,
+		// the rules apply in order: INT comes before the others
+		"FLOATING POINT": Integer,
+		"CHARINT":        Integer,
+	}
+	for declared, want := range tests {
+		if got := AffinityOf(declared); got != want {
+			t.Errorf("AffinityOf(%q) = %d, want %d", declared, got, want)
+		}
+	}
+}
+
+func TestIsTime(t *testing.T) {
+	for declared, want := range map[string]bool{
+		"DATE": true, "datetime": true, " DateTime ": true,
+		"TIMESTAMP": false, "TEXT": false, "": false,
+	} {
+		if got := IsTime(declared); got != want {
+			t.Errorf("IsTime(%q) = %v, want %v", declared, got, want)
+		}
+	}
+}
+
+func TestName(t *testing.T) {
+	for declared, want := range map[string]string{
+		"varchar(255)": "VARCHAR", " Decimal (10, 5)": "DECIMAL", "int": "INT", "": "",
+	} {
+		if got := Name(declared); got != want {
+			t.Errorf("Name(%q) = %q, want %q", declared, got, want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package gorqlite
+
+/*
+	this file contains the Logger of a connection, receiving leveled and
+	structured messages, and a text Logger writing them to an io.Writer
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogLevel is the level of a message given to a Logger. The levels have
+// the values of those of log/slog, so that slog.Level(level) converts
+// them.
+type LogLevel int
+
+const (
+	// LogLevelDebug is for every request made to rqlite.
+	LogLevelDebug LogLevel = -4
+	// LogLevelInfo is for the opening of connections and retries.
+	LogLevelInfo LogLevel = 0
+	// LogLevelWarn is for a peer failing to answer.
+	LogLevelWarn LogLevel = 4
+	// LogLevelError is for all the peers failing to answer.
+	LogLevelError LogLevel = 8
+)
+
+// String returns the name of the level, in lower case.
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelDebug:
+		return "debug"
+	case LogLevelInfo:
+		return "info"
+	case LogLevelWarn:
+		return "warn"
+	case LogLevelError:
+		return "error"
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(l))
+}
+
+// Logger receives the messages of a connection, set by WithLogger. The
+// fields of a message are given as alternating keys and values, as
+// log/slog does: they include "conn", the ID of the connection, and
+// depending on the message "peer", "op", "duration", "status" and
+// "error". Credentials are redacted from them.
+//
+// A Logger must be safe for concurrent use. With log/slog:
+//
+//	gorqlite.WithLogger(gorqlite.LoggerFunc(func(ctx context.Context, level gorqlite.LogLevel, msg string, keyvals ...interface{}) {
+//		slog.Log(ctx, slog.Level(level), msg, keyvals...)
+//	}))
+type Logger interface {
+	Log(ctx context.Context, level LogLevel, msg string, keyvals ...interface{})
+}
+
+// LoggerFunc makes a function a Logger.
+type LoggerFunc func(ctx context.Context, level LogLevel, msg string, keyvals ...interface{})
+
+// Log calls f.
+func (f LoggerFunc) Log(ctx context.Context, level LogLevel, msg string, keyvals ...interface{}) {
+	f(ctx, level, msg, keyvals...)
+}
+
+// WithLogger sets the Logger receiving the messages of the connection.
+// Unlike TraceOn, which traces every connection, it is set per
+// connection. Defaults to none.
+func WithLogger(logger Logger) Option {
+	return func(conn *Connection) error {
+		if logger == nil {
+			return errors.New("logger is nil")
+		}
+		conn.logger = logger
+		return nil
+	}
+}
+
+// log gives a message to the Logger of the connection, if any, with the
+// connection ID and the credentials redacted
+func (conn *Connection) log(ctx context.Context, level LogLevel, msg string, keyvals ...interface{}) {
+	if conn.logger == nil {
+		return
+	}
+	fields := make([]interface{}, 0, len(keyvals)+2)
+	fields = append(fields, "conn", conn.ID)
+	for _, v := range keyvals {
+		fields = append(fields, conn.redact(v))
+	}
+	conn.logger.Log(ctx, level, msg, fields...)
+}
+
+// redact replaces the password of the connection in strings and errors,
+// should one ever make it there
+func (conn *Connection) redact(v interface{}) interface{} {
+	if conn.password == "" {
+		return v
+	}
+	switch v := v.(type) {
+	case string:
+		return strings.ReplaceAll(v, conn.password, "xxxxx")
+	case error:
+		if strings.Contains(v.Error(), conn.password) {
+			return errors.New(strings.ReplaceAll(v.Error(), conn.password, "xxxxx"))
+		}
+	}
+	return v
+}
+
+// textLogger writes messages as lines of key=value pairs
+type textLogger struct {
+	mu       sync.Mutex
+	w        io.Writer
+	minLevel LogLevel
+	buf      []byte
+}
+
+// NewTextLogger returns a Logger writing the messages of minLevel and
+// above to w, one per line, as key=value pairs:
+//
+//	time=2024-01-02T17:00:00.000Z level=debug msg=request conn=8E1F... op=query peer=localhost:4001 status=200 duration=1.2ms
+func NewTextLogger(w io.Writer, minLevel LogLevel) Logger {
+	return &textLogger{w: w, minLevel: minLevel}
+}
+
+func (l *textLogger) Log(ctx context.Context, level LogLevel, msg string, keyvals ...interface{}) {
+	if level < l.minLevel {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.buf = l.buf[:0]
+	l.buf = append(l.buf, "time="...)
+	l.buf = time.Now().UTC().AppendFormat(l.buf, "2006-01-02T15:04:05.000Z")
+	l.buf = append(l.buf, " level="...)
+	l.buf = append(l.buf, level.String()...)
+	l.buf = append(l.buf, " msg="...)
+	l.buf = appendLogValue(l.buf, msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		l.buf = append(l.buf, ' ')
+		l.buf = append(l.buf, fmt.Sprint(keyvals[i])...)
+		l.buf = append(l.buf, '=')
+		if i+1 < len(keyvals) {
+			l.buf = appendLogValue(l.buf, fmt.Sprint(keyvals[i+1]))
+		}
+	}
+	l.buf = append(l.buf, '\n')
+	l.w.Write(l.buf)
+}
+
+// appendLogValue appends s, quoted if needed to keep the line parsable
+func appendLogValue(buf []byte, s string) []byte {
+	if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+		return strconv.AppendQuote(buf, s)
+	}
+	return append(buf, s...)
+}
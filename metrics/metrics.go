@@ -0,0 +1,298 @@
+// Package metrics collects the requests made by gorqlite connections as
+// Prometheus-style counters and histograms, exposed in the Prometheus
+// text format without depending on the Prometheus client:
+//
+//	collector := metrics.New()
+//	conn, err := gorqlite.OpenWithOptions(connURL, gorqlite.WithObserver(collector))
+//	http.Handle("/metrics", collector)
+//
+// The metrics are:
+//
+//	gorqlite_requests_total{op,peer,code}           attempts of requests to peers
+//	gorqlite_request_duration_seconds{op}           histogram of their durations
+//	gorqlite_request_sent_bytes_total{op}           bytes of the request bodies
+//	gorqlite_request_received_bytes_total{op}       bytes of the response bodies
+//	gorqlite_retries_total{op}                      passes over the peer list again
+//	gorqlite_failovers_total{op}                    requests going on to the next peer
+//	gorqlite_rqlite_duration_seconds{op}            histogram of the times reported by rqlite
+//	gorqlite_circuit_breaker_state{peer,state}      1 for the state of the breaker of a peer, 0 for the others
+//	gorqlite_circuit_breaker_changes_total{peer,to} changes of state of the breakers
+//
+// The breaker metrics are only there with gorqlite.WithCircuitBreaker.
+//
+// The code label is the HTTP status code, "none" when there was no
+// response.
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// DefaultBuckets are the upper bounds of the histogram buckets, in
+// seconds, those of the Prometheus client.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// these aren't checked automatically anywhere else, so we check them here
+var _ gorqlite.BreakerObserver = (*Collector)(nil)
+var _ http.Handler = (*Collector)(nil)
+
+// Collector is a gorqlite.Observer keeping the metrics of the requests
+// of any number of connections. It is safe for concurrent use.
+type Collector struct {
+	mu      sync.Mutex
+	buckets []float64
+
+	requests      map[string]float64 // by op, peer, code
+	durations     map[string]*histogram
+	sentBytes     map[string]float64
+	receivedBytes map[string]float64
+	retries       map[string]float64
+	failovers     map[string]float64
+	rqliteTimes   map[string]*histogram
+	breakers      map[string]string // state by peer
+	breakerMoves  map[string]float64
+}
+
+// New returns a Collector whose histograms have the buckets given, in
+// seconds, or DefaultBuckets if none.
+func New(buckets ...float64) *Collector {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &Collector{
+		buckets:       sorted,
+		requests:      make(map[string]float64),
+		durations:     make(map[string]*histogram),
+		sentBytes:     make(map[string]float64),
+		receivedBytes: make(map[string]float64),
+		retries:       make(map[string]float64),
+		failovers:     make(map[string]float64),
+		rqliteTimes:   make(map[string]*histogram),
+		breakers:      make(map[string]string),
+		breakerMoves:  make(map[string]float64),
+	}
+}
+
+// Request counts an attempt of a request, its duration and bytes.
+func (c *Collector) Request(ctx context.Context, e gorqlite.RequestEvent) {
+	code := "none"
+	if e.Status != 0 {
+		code = strconv.Itoa(e.Status)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests[labels("op", e.Op, "peer", e.Peer, "code", code)]++
+	op := labels("op", e.Op)
+	c.histogram(c.durations, op).observe(e.Duration.Seconds())
+	c.sentBytes[op] += float64(e.BytesSent)
+	c.receivedBytes[op] += float64(e.BytesReceived)
+}
+
+// Failover counts a request going on to the next peer.
+func (c *Collector) Failover(ctx context.Context, e gorqlite.FailoverEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failovers[labels("op", e.Op)]++
+}
+
+// Retry counts a request going over the peer list again.
+func (c *Collector) Retry(ctx context.Context, e gorqlite.RetryEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.retries[labels("op", e.Op)]++
+}
+
+// Timing observes the time rqlite reports for a request.
+func (c *Collector) Timing(ctx context.Context, op string, seconds float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.histogram(c.rqliteTimes, labels("op", op)).observe(seconds)
+}
+
+// Breaker keeps the state of the circuit breaker of a peer, and counts
+// its changes.
+func (c *Collector) Breaker(ctx context.Context, e gorqlite.BreakerEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.breakers[e.Peer] = e.To.String()
+	c.breakerMoves[labels("peer", e.Peer, "to", e.To.String())]++
+}
+
+// histogram returns the histogram with the labels, creating it
+func (c *Collector) histogram(byLabels map[string]*histogram, l string) *histogram {
+	h, ok := byLabels[l]
+	if !ok {
+		h = &histogram{bounds: c.buckets, counts: make([]uint64, len(c.buckets))}
+		byLabels[l] = h
+	}
+	return h
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text format, the series
+// of each metric sorted by labels.
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	writeCounter(cw, "gorqlite_requests_total", "Attempts of requests to rqlite peers.", c.requests)
+	c.writeHistogram(cw, "gorqlite_request_duration_seconds", "Durations of the attempts of requests to rqlite peers.", c.durations)
+	writeCounter(cw, "gorqlite_request_sent_bytes_total", "Bytes of the bodies of the requests to rqlite.", c.sentBytes)
+	writeCounter(cw, "gorqlite_request_received_bytes_total", "Bytes of the bodies of the responses of rqlite.", c.receivedBytes)
+	writeCounter(cw, "gorqlite_retries_total", "Requests going over the peer list again.", c.retries)
+	writeCounter(cw, "gorqlite_failovers_total", "Requests going on to the next peer.", c.failovers)
+	c.writeHistogram(cw, "gorqlite_rqlite_duration_seconds", "Times reported by rqlite for the requests.", c.rqliteTimes)
+	writeGauge(cw, "gorqlite_circuit_breaker_state", "States of the circuit breakers of rqlite peers.", c.breakerStates())
+	writeCounter(cw, "gorqlite_circuit_breaker_changes_total", "Changes of state of the circuit breakers of rqlite peers.", c.breakerMoves)
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+func writeCounter(w *countingWriter, name, help string, series map[string]float64) {
+	if len(series) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	for _, l := range sortedKeys(series) {
+		fmt.Fprintf(w, "%s{%s} %s\n", name, l, formatFloat(series[l]))
+	}
+}
+
+func writeGauge(w *countingWriter, name, help string, series map[string]float64) {
+	if len(series) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	for _, l := range sortedKeys(series) {
+		fmt.Fprintf(w, "%s{%s} %s\n", name, l, formatFloat(series[l]))
+	}
+}
+
+// breakerStates has a series per peer and state, 1 for the current one
+func (c *Collector) breakerStates() map[string]float64 {
+	series := make(map[string]float64)
+	for p, current := range c.breakers {
+		for _, state := range []string{gorqlite.BreakerClosed.String(), gorqlite.BreakerHalfOpen.String(), gorqlite.BreakerOpen.String()} {
+			v := 0.0
+			if state == current {
+				v = 1
+			}
+			series[labels("peer", p, "state", state)] = v
+		}
+	}
+	return series
+}
+
+func (c *Collector) writeHistogram(w *countingWriter, name, help string, series map[string]*histogram) {
+	if len(series) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	keys := make([]string, 0, len(series))
+	for l := range series {
+		keys = append(keys, l)
+	}
+	sort.Strings(keys)
+	for _, l := range keys {
+		h := series[l]
+		var cumulative uint64
+		for i, bound := range c.buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, l, formatFloat(bound), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, l, h.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", name, l, formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, l, h.count)
+	}
+}
+
+// histogram counts the observations by bucket, each only in the first
+// bucket it fits, made cumulative when written
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(v float64) {
+	h.count++
+	h.sum += v
+	for i, bound := range h.bounds {
+		if v <= bound {
+			h.counts[i]++
+			return
+		}
+	}
+}
+
+// labels formats label pairs, their values escaped
+func labels(pairs ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(pairs[i+1]))
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func sortedKeys(series map[string]float64) []string {
+	keys := make([]string, 0, len(series))
+	for l := range series {
+		keys = append(keys, l)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, +1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// countingWriter counts the bytes written, and keeps the first error
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
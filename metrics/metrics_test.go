@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+)
+
+func TestCollector(t *testing.T) {
+	ctx := context.Background()
+	c := New(0.1, 0.01)
+	c.Request(ctx, gorqlite.RequestEvent{Op: "query", Peer: "a:4001", Status: 200, BytesSent: 10, BytesReceived: 100, Duration: 5 * time.Millisecond})
+	c.Request(ctx, gorqlite.RequestEvent{Op: "query", Peer: "b:4001", Duration: 50 * time.Millisecond, Err: errors.New("refused")})
+	c.Request(ctx, gorqlite.RequestEvent{Op: "query", Peer: "a:4001", Status: 200, Duration: time.Second})
+	c.Failover(ctx, gorqlite.FailoverEvent{Op: "query", From: "b:4001", To: "a:4001"})
+	c.Retry(ctx, gorqlite.RetryEvent{Op: "write", Retry: 1})
+	c.Timing(ctx, "query", 0.002)
+	c.Breaker(ctx, gorqlite.BreakerEvent{Peer: "b:4001", From: gorqlite.BreakerClosed, To: gorqlite.BreakerOpen})
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	got := rec.Body.String()
+
+	for _, want := range []string{
+		"# TYPE gorqlite_requests_total counter\n",
+		`gorqlite_requests_total{op="query",peer="a:4001",code="200"} 2` + "\n",
+		`gorqlite_requests_total{op="query",peer="b:4001",code="none"} 1` + "\n",
+		"# TYPE gorqlite_request_duration_seconds histogram\n",
+		`gorqlite_request_duration_seconds_bucket{op="query",le="0.01"} 1` + "\n",
+		`gorqlite_request_duration_seconds_bucket{op="query",le="0.1"} 2` + "\n",
+		`gorqlite_request_duration_seconds_bucket{op="query",le="+Inf"} 3` + "\n",
+		`gorqlite_request_duration_seconds_sum{op="query"} 1.055` + "\n",
+		`gorqlite_request_duration_seconds_count{op="query"} 3` + "\n",
+		`gorqlite_request_sent_bytes_total{op="query"} 10` + "\n",
+		`gorqlite_request_received_bytes_total{op="query"} 100` + "\n",
+		`gorqlite_retries_total{op="write"} 1` + "\n",
+		`gorqlite_failovers_total{op="query"} 1` + "\n",
+		`gorqlite_rqlite_duration_seconds_bucket{op="query",le="0.01"} 1` + "\n",
+		"# TYPE gorqlite_circuit_breaker_state gauge\n",
+		`gorqlite_circuit_breaker_state{peer="b:4001",state="closed"} 0` + "\n",
+		`gorqlite_circuit_breaker_state{peer="b:4001",state="open"} 1` + "\n",
+		`gorqlite_circuit_breaker_changes_total{peer="b:4001",to="open"} 1` + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("got content type %q", ct)
+	}
+
+	if l := labels("peer", "a\"b\\c\nd"); l != `peer="a\"b\\c\nd"` {
+		t.Errorf("got labels %s", l)
+	}
+}
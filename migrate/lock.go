@@ -0,0 +1,89 @@
+package migrate
+
+/*
+	this file contains the lock row guarding against concurrent Migrators
+*/
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// lockPollInterval is the time between two attempts at taking the lock
+var lockPollInterval = 500 * time.Millisecond
+
+// ErrLocked is returned when another Migrator holds the lock.
+var ErrLocked = errors.New("migrate: locked by another migrator")
+
+// lock takes the lock row, waiting up to LockWait for it to be released
+func (m *Migrator) lock(ctx context.Context) error {
+	deadline := time.Now().Add(m.config.LockWait)
+	for {
+		err := m.tryLock(ctx)
+		if err != ErrLocked || !time.Now().Before(deadline) {
+			return err
+		}
+
+		timer := time.NewTimer(lockPollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// tryLock takes the lock row, taking over an expired one, in a single
+// transaction even if the connection runs its writes without
+func (m *Migrator) tryLock(ctx context.Context) error {
+	now := time.Now()
+	ctx = gorqlite.WithRequestOptions(ctx, gorqlite.RequestTransaction(true))
+	results, err := m.conn.WriteParameterizedContext(ctx, []gorqlite.ParameterizedStatement{
+		{
+			Query:     "DELETE FROM " + quote(m.config.LockTable) + " WHERE id = 1 AND expires_at < ?",
+			Arguments: []interface{}{now.Unix()},
+		},
+		{
+			Query:     "INSERT INTO " + quote(m.config.LockTable) + " (id, owner, acquired_at, expires_at) VALUES (1, ?, ?, ?)",
+			Arguments: []interface{}{m.config.Owner, now.UTC().Format(time.RFC3339Nano), now.Add(m.config.LockTTL).Unix()},
+		},
+	})
+	if err != nil {
+		if len(results) == 2 && results[1].Err != nil && strings.Contains(results[1].Err.Error(), "constraint failed") {
+			return ErrLocked
+		}
+		return err
+	}
+	return nil
+}
+
+// renewLock pushes the expiry of the lock back, failing if it was lost
+func (m *Migrator) renewLock(ctx context.Context) error {
+	wr, err := m.conn.WriteOneParameterizedContext(ctx, gorqlite.ParameterizedStatement{
+		Query:     "UPDATE " + quote(m.config.LockTable) + " SET expires_at = ? WHERE id = 1 AND owner = ?",
+		Arguments: []interface{}{time.Now().Add(m.config.LockTTL).Unix(), m.config.Owner},
+	})
+	if err != nil {
+		return err
+	}
+	if wr.RowsAffected != 1 {
+		return errors.New("migrate: lost the lock")
+	}
+	return nil
+}
+
+// unlock releases the lock row, if still held
+func (m *Migrator) unlock() {
+	// release the lock even if the context of the run is done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	m.conn.WriteOneParameterizedContext(ctx, gorqlite.ParameterizedStatement{
+		Query:     "DELETE FROM " + quote(m.config.LockTable) + " WHERE id = 1 AND owner = ?",
+		Arguments: []interface{}{m.config.Owner},
+	})
+}
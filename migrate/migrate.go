@@ -0,0 +1,410 @@
+// Package migrate applies SQL schema migrations to rqlite.
+//
+// Migrations are read from an fs.FS, see Load, and the versions applied
+// are tracked in a table of the database, schema_migrations by default.
+// Each migration is applied, or rolled back, as a single transaction
+// along with its tracking row, so it is applied entirely or not at all.
+//
+// Only one Migrator at a time changes the schema: the others wait for,
+// or fail on, a lock row held in a second table.
+//
+//	//go:embed migrations/*.sql
+//	var migrations embed.FS
+//
+//	fsys, _ := fs.Sub(migrations, "migrations")
+//	m, err := migrate.New(conn, fsys, migrate.Config{})
+//	applied, err := m.Up(ctx)
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+	"github.com/rqlite/gorqlite/internal/sqltok"
+)
+
+const (
+	defaultTable   = "schema_migrations"
+	defaultLockTTL = 15 * time.Minute
+)
+
+// Config configures a Migrator. Zero values get the defaults.
+type Config struct {
+	// Table tracks the migrations applied. Defaults to schema_migrations.
+	Table string
+	// LockTable holds the lock row. Defaults to Table followed by _lock.
+	LockTable string
+	// Owner identifies the Migrator in the lock row. Defaults to the
+	// host name and process ID.
+	Owner string
+	// LockWait is how long to wait for the lock held by another Migrator,
+	// zero meaning to fail with ErrLocked right away.
+	LockWait time.Duration
+	// LockTTL is how long the lock is held, after which it is considered
+	// abandoned and may be taken over. It is renewed before each migration.
+	// Defaults to 15 minutes.
+	LockTTL time.Duration
+	// DryRun makes Up and Down return the migrations they would apply or
+	// roll back, without changing anything, nor taking the lock.
+	DryRun bool
+	// AllowDrift lets Up and Down run even though applied migrations were
+	// modified or removed since. See Verify.
+	AllowDrift bool
+}
+
+// Migrator applies migrations to the database of a Connection.
+type Migrator struct {
+	conn       *gorqlite.Connection
+	migrations []Migration
+	config     Config
+}
+
+// AppliedMigration is a migration as tracked in the database.
+type AppliedMigration struct {
+	Version   int64
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// Status is the status of a migration.
+type Status struct {
+	Migration
+	// Applied tells whether the migration has been applied.
+	Applied bool
+	// AppliedAt is when the migration was applied.
+	AppliedAt time.Time
+	// Drifted tells that the migration was modified after being applied.
+	Drifted bool
+	// Missing tells that the migration was applied, but its files are
+	// gone. Only Version and Name are known then.
+	Missing bool
+}
+
+// DriftError reports an applied migration that was modified or removed.
+type DriftError struct {
+	Version int64
+	Name    string
+	// Missing tells whether the migration was removed, rather than modified.
+	Missing bool
+}
+
+// Error returns a string representation of the drift.
+func (e *DriftError) Error() string {
+	if e.Missing {
+		return fmt.Sprintf("applied migration %d_%s is missing", e.Version, e.Name)
+	}
+	return fmt.Sprintf("applied migration %d_%s was modified since", e.Version, e.Name)
+}
+
+// New returns a Migrator applying the migrations of fsys, see Load.
+func New(conn *gorqlite.Connection, fsys fs.FS, config Config) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithMigrations(conn, migrations, config)
+}
+
+// NewWithMigrations returns a Migrator applying the given migrations,
+// which need not be ordered.
+func NewWithMigrations(conn *gorqlite.Connection, migrations []Migration, config Config) (*Migrator, error) {
+	if conn == nil {
+		return nil, errors.New("connection is nil")
+	}
+
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+	for i := range sorted {
+		if i > 0 && sorted[i].Version == sorted[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d", sorted[i].Version)
+		}
+		if sorted[i].Checksum == "" {
+			sorted[i].Checksum = checksum(sorted[i].Up)
+		}
+	}
+
+	if config.Table == "" {
+		config.Table = defaultTable
+	}
+	if config.LockTable == "" {
+		config.LockTable = config.Table + "_lock"
+	}
+	if config.Owner == "" {
+		host, _ := os.Hostname()
+		config.Owner = fmt.Sprintf("%s:%d", host, os.Getpid())
+	}
+	if config.LockTTL <= 0 {
+		config.LockTTL = defaultLockTTL
+	}
+	if config.LockWait < 0 {
+		return nil, fmt.Errorf("invalid lock wait: %s", config.LockWait)
+	}
+
+	return &Migrator{conn: conn, migrations: sorted, config: config}, nil
+}
+
+// Migrations returns the migrations of the Migrator, ordered by version.
+func (m *Migrator) Migrations() []Migration {
+	return append([]Migration(nil), m.migrations...)
+}
+
+// quote quotes an SQL identifier
+func quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// strongContext makes the reads of ctx see the latest writes
+func strongContext(ctx context.Context) context.Context {
+	return gorqlite.WithRequestOptions(ctx, gorqlite.RequestConsistencyLevel(gorqlite.ConsistencyLevelStrong))
+}
+
+// ensureTables creates the tracking and lock tables
+func (m *Migrator) ensureTables(ctx context.Context) error {
+	_, err := m.conn.WriteParameterizedContext(ctx, []gorqlite.ParameterizedStatement{
+		{Query: "CREATE TABLE IF NOT EXISTS " + quote(m.config.Table) + " (version INTEGER PRIMARY KEY, name TEXT NOT NULL, checksum TEXT NOT NULL, applied_at TEXT NOT NULL)"},
+		{Query: "CREATE TABLE IF NOT EXISTS " + quote(m.config.LockTable) + " (id INTEGER PRIMARY KEY CHECK (id = 1), owner TEXT NOT NULL, acquired_at TEXT NOT NULL, expires_at INTEGER NOT NULL)"},
+	})
+	return err
+}
+
+// Applied returns the migrations applied to the database, ordered by
+// version.
+func (m *Migrator) Applied(ctx context.Context) ([]AppliedMigration, error) {
+	qr, err := m.conn.QueryOneParameterizedContext(strongContext(ctx), gorqlite.ParameterizedStatement{
+		Query: "SELECT version, name, checksum, applied_at FROM " + quote(m.config.Table) + " ORDER BY version",
+	})
+	if err != nil {
+		// nothing was applied yet
+		if strings.Contains(err.Error(), "no such table") {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var applied []AppliedMigration
+	for qr.Next() {
+		var am AppliedMigration
+		var appliedAt string
+		if err := qr.Scan(&am.Version, &am.Name, &am.Checksum, &appliedAt); err != nil {
+			return nil, err
+		}
+		am.AppliedAt, _ = time.Parse(time.RFC3339Nano, appliedAt)
+		applied = append(applied, am)
+	}
+	return applied, nil
+}
+
+// Status returns the status of every migration, known or applied,
+// ordered by version.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]AppliedMigration, len(applied))
+	for _, am := range applied {
+		byVersion[am.Version] = am
+	}
+
+	var statuses []Status
+	known := make(map[int64]bool, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = true
+		s := Status{Migration: migration}
+		if am, ok := byVersion[migration.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = am.AppliedAt
+			s.Drifted = am.Checksum != migration.Checksum
+		}
+		statuses = append(statuses, s)
+	}
+	for _, am := range applied {
+		if !known[am.Version] {
+			statuses = append(statuses, Status{
+				Migration: Migration{Version: am.Version, Name: am.Name, Checksum: am.Checksum},
+				Applied:   true,
+				AppliedAt: am.AppliedAt,
+				Missing:   true,
+			})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses, nil
+}
+
+// Verify checks that the migrations applied were neither modified nor
+// removed since, returning a *DriftError for the first one that was.
+// Only their Up SQL is compared, see Migration.Checksum.
+func (m *Migrator) Verify(ctx context.Context) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	return drift(statuses)
+}
+
+func drift(statuses []Status) error {
+	for _, s := range statuses {
+		if s.Drifted || s.Missing {
+			return &DriftError{Version: s.Version, Name: s.Name, Missing: s.Missing}
+		}
+	}
+	return nil
+}
+
+// Up applies all the migrations not applied yet, in order. It returns
+// the migrations applied, or that would be with DryRun.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	return m.UpTo(ctx, -1)
+}
+
+// UpTo applies the migrations not applied yet, up to the given version
+// included, in order. A negative version means all of them. It returns
+// the migrations applied, or that would be with DryRun.
+//
+// A migration fails entirely: the ones before it stay applied, the
+// error tells which one failed.
+func (m *Migrator) UpTo(ctx context.Context, version int64) ([]Migration, error) {
+	return m.run(ctx, func(statuses []Status) ([]Migration, error) {
+		var pending []Migration
+		for _, s := range statuses {
+			if !s.Applied && (version < 0 || s.Version <= version) {
+				pending = append(pending, s.Migration)
+			}
+		}
+		return pending, nil
+	}, m.apply)
+}
+
+// Down rolls back the last steps migrations applied, latest first. It
+// returns the migrations rolled back, or that would be with DryRun.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if steps < 0 {
+		return nil, fmt.Errorf("invalid number of steps: %d", steps)
+	}
+	return m.run(ctx, func(statuses []Status) ([]Migration, error) {
+		rollback, err := appliedLatestFirst(statuses, func(s Status) bool { return true })
+		if len(rollback) > steps {
+			rollback = rollback[:steps]
+		}
+		return rollback, err
+	}, m.rollback)
+}
+
+// DownTo rolls back the migrations applied after the given version,
+// latest first. It returns the migrations rolled back, or that would
+// be with DryRun.
+func (m *Migrator) DownTo(ctx context.Context, version int64) ([]Migration, error) {
+	return m.run(ctx, func(statuses []Status) ([]Migration, error) {
+		return appliedLatestFirst(statuses, func(s Status) bool { return s.Version > version })
+	}, m.rollback)
+}
+
+// appliedLatestFirst returns the applied migrations selected, latest
+// first, failing on those that can't be rolled back
+func appliedLatestFirst(statuses []Status, selected func(Status) bool) ([]Migration, error) {
+	var migrations []Migration
+	for i := len(statuses) - 1; i >= 0; i-- {
+		s := statuses[i]
+		if !s.Applied || !selected(s) {
+			continue
+		}
+		if s.Missing {
+			return nil, &DriftError{Version: s.Version, Name: s.Name, Missing: true}
+		}
+		migrations = append(migrations, s.Migration)
+	}
+	return migrations, nil
+}
+
+// run plans the migrations to apply or roll back, then does it under
+// the lock, unless in dry run
+func (m *Migrator) run(ctx context.Context, plan func([]Status) ([]Migration, error), do func(context.Context, Migration) error) ([]Migration, error) {
+	if !m.config.DryRun {
+		if err := m.ensureTables(ctx); err != nil {
+			return nil, err
+		}
+		if err := m.lock(ctx); err != nil {
+			return nil, err
+		}
+		defer m.unlock()
+	}
+
+	// plan once the lock is held, for the status not to change meanwhile
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !m.config.AllowDrift {
+		if err := drift(statuses); err != nil {
+			return nil, err
+		}
+	}
+	migrations, err := plan(statuses)
+	if err != nil || m.config.DryRun {
+		return migrations, err
+	}
+
+	var done []Migration
+	for _, migration := range migrations {
+		if err := m.renewLock(ctx); err != nil {
+			return done, err
+		}
+		if err := do(ctx, migration); err != nil {
+			return done, fmt.Errorf("migration %s: %w", migration, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// statements splits the SQL of a migration in statements
+func statements(sql string) []gorqlite.ParameterizedStatement {
+	var stmts []gorqlite.ParameterizedStatement
+	for _, stmt := range sqltok.Split(sql) {
+		stmts = append(stmts, gorqlite.ParameterizedStatement{Query: stmt.Text})
+	}
+	return stmts
+}
+
+// execute runs the statements of a migration as a single transaction
+func (m *Migrator) execute(ctx context.Context, stmts []gorqlite.ParameterizedStatement) error {
+	ctx = gorqlite.WithRequestOptions(ctx, gorqlite.RequestTransaction(true))
+	_, err := m.conn.WriteParameterizedContext(ctx, stmts)
+	return err
+}
+
+// apply applies a migration, and tracks it
+func (m *Migrator) apply(ctx context.Context, migration Migration) error {
+	stmts := statements(migration.Up)
+	stmts = append(stmts, gorqlite.ParameterizedStatement{
+		Query:     "INSERT INTO " + quote(m.config.Table) + " (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)",
+		Arguments: []interface{}{migration.Version, migration.Name, migration.Checksum, time.Now().UTC().Format(time.RFC3339Nano)},
+	})
+	return m.execute(ctx, stmts)
+}
+
+// rollback rolls a migration back, and stops tracking it
+func (m *Migrator) rollback(ctx context.Context, migration Migration) error {
+	if strings.TrimSpace(migration.Down) == "" {
+		return errors.New("no down migration")
+	}
+	stmts := statements(migration.Down)
+	stmts = append(stmts, gorqlite.ParameterizedStatement{
+		Query:     "DELETE FROM " + quote(m.config.Table) + " WHERE version = ?",
+		Arguments: []interface{}{migration.Version},
+	})
+	return m.execute(ctx, stmts)
+}
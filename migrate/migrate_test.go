@@ -0,0 +1,387 @@
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"002_add_email.up.sql":   {Data: []byte("ALTER TABLE users ADD COLUMN email TEXT;")},
+		"002_add_email.down.sql": {Data: []byte("ALTER TABLE users DROP COLUMN email;")},
+		"001_create_users.sql":   {Data: []byte("CREATE TABLE users (id INTEGER PRIMARY KEY);")},
+		"010_index.up.sql":       {Data: []byte("CREATE INDEX users_email ON users (email);")},
+		"README.md":              {Data: []byte("not a migration")},
+		"old/000_ignored.sql":    {Data: []byte("not read")},
+	}
+	migrations, err := Load(fsys)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got []string
+	for _, m := range migrations {
+		got = append(got, m.String())
+	}
+	if want := []string{"1_create_users", "2_add_email", "10_index"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if migrations[1].Down == "" || migrations[0].Down != "" {
+		t.Errorf("unexpected down migrations: %+v", migrations)
+	}
+	if migrations[0].Checksum != checksum(migrations[0].Up) {
+		t.Errorf("unexpected checksum %s", migrations[0].Checksum)
+	}
+
+	for name, fsys := range map[string]fstest.MapFS{
+		"bad name":     {"create_users.sql": {Data: []byte("SELECT 1")}},
+		"bad version":  {"v1_create_users.sql": {Data: []byte("SELECT 1")}},
+		"no up":        {"001_create_users.down.sql": {Data: []byte("SELECT 1")}},
+		"two ups":      {"001_a.sql": {Data: []byte("SELECT 1")}, "001_a.up.sql": {Data: []byte("SELECT 2")}},
+		"two names":    {"001_a.sql": {Data: []byte("SELECT 1")}, "001_b.down.sql": {Data: []byte("SELECT 2")}},
+		"missing name": {"001_.sql": {Data: []byte("SELECT 1")}},
+	} {
+		if _, err := Load(fsys); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+	}
+}
+
+// fakeDB is a fake rqlite, understanding just the statements of a Migrator
+type fakeDB struct {
+	mu sync.Mutex
+	fakeState
+	// lockTransactions tells whether each attempt to take the lock was
+	// a transaction
+	lockTransactions []bool
+}
+
+type fakeState struct {
+	tables   map[string]bool
+	applied  map[int64][]interface{}
+	lock     []interface{} // owner, expires_at
+	executed []string
+}
+
+func (db *fakeDB) snapshot() fakeState {
+	s := fakeState{tables: map[string]bool{}, applied: map[int64][]interface{}{}, lock: db.lock}
+	for k, v := range db.tables {
+		s.tables[k] = v
+	}
+	for k, v := range db.applied {
+		s.applied[k] = v
+	}
+	s.executed = append(s.executed, db.executed...)
+	return s
+}
+
+func (db *fakeDB) restore(s fakeState) {
+	db.fakeState = s
+}
+
+// exec runs a statement, returning its result
+func (db *fakeDB) exec(query string, args []interface{}) map[string]interface{} {
+	switch {
+	case strings.Contains(query, "FAIL"):
+		return map[string]interface{}{"error": "near \"FAIL\": syntax error"}
+	case strings.HasPrefix(query, `CREATE TABLE IF NOT EXISTS "schema_migrations`):
+		db.tables[strings.Fields(query)[5]] = true
+	case strings.HasPrefix(query, `DELETE FROM "schema_migrations_lock" WHERE id = 1 AND expires_at`):
+		if db.lock != nil && db.lock[1].(float64) < args[0].(float64) {
+			db.lock = nil
+			return map[string]interface{}{"rows_affected": 1}
+		}
+	case strings.HasPrefix(query, `INSERT INTO "schema_migrations_lock"`):
+		if db.lock != nil {
+			return map[string]interface{}{"error": "UNIQUE constraint failed: schema_migrations_lock.id"}
+		}
+		db.lock = []interface{}{args[0], args[2]}
+	case strings.HasPrefix(query, `UPDATE "schema_migrations_lock"`):
+		if db.lock != nil && db.lock[0] == args[1] {
+			db.lock = []interface{}{args[1], args[0]}
+			return map[string]interface{}{"rows_affected": 1}
+		}
+	case strings.HasPrefix(query, `DELETE FROM "schema_migrations_lock" WHERE id = 1 AND owner`):
+		if db.lock != nil && db.lock[0] == args[0] {
+			db.lock = nil
+			return map[string]interface{}{"rows_affected": 1}
+		}
+	case strings.HasPrefix(query, `INSERT INTO "schema_migrations"`):
+		db.applied[int64(args[0].(float64))] = args
+	case strings.HasPrefix(query, `DELETE FROM "schema_migrations"`):
+		delete(db.applied, int64(args[0].(float64)))
+	case strings.HasPrefix(query, "SELECT version"):
+		if !db.tables[`"schema_migrations"`] {
+			return map[string]interface{}{"error": "no such table: schema_migrations"}
+		}
+		values := [][]interface{}{}
+		for version := int64(0); version < 100; version++ {
+			if row, ok := db.applied[version]; ok {
+				values = append(values, row)
+			}
+		}
+		return map[string]interface{}{
+			"columns": []string{"version", "name", "checksum", "applied_at"},
+			"types":   []string{"integer", "text", "text", "text"},
+			"values":  values,
+		}
+	default:
+		db.executed = append(db.executed, query)
+	}
+	return map[string]interface{}{"rows_affected": 0}
+}
+
+func (db *fakeDB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var stmts [][]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&stmts); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	_, transaction := r.URL.Query()["transaction"]
+	if len(stmts) > 0 && strings.HasPrefix(stmts[0][0].(string), `DELETE FROM "schema_migrations_lock" WHERE id = 1 AND expires_at`) {
+		db.lockTransactions = append(db.lockTransactions, transaction)
+	}
+	before := db.snapshot()
+	var results []map[string]interface{}
+	for _, stmt := range stmts {
+		result := db.exec(stmt[0].(string), stmt[1:])
+		results = append(results, result)
+		if _, failed := result["error"]; failed && transaction {
+			db.restore(before)
+			break
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+}
+
+func newTestMigrator(t *testing.T, db *fakeDB, migrations []Migration, config Config) *Migrator {
+	t.Helper()
+	srv := httptest.NewServer(db)
+	t.Cleanup(srv.Close)
+
+	conn, err := gorqlite.OpenWithOptions(srv.URL, gorqlite.WithClusterDiscovery(false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m, err := NewWithMigrations(conn, migrations, config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return m
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{fakeState: fakeState{tables: map[string]bool{}, applied: map[int64][]interface{}{}}}
+}
+
+var testMigrations = []Migration{
+	{Version: 2, Name: "add_email", Up: "ALTER TABLE users ADD COLUMN email TEXT", Down: "ALTER TABLE users DROP COLUMN email"},
+	{Version: 1, Name: "create_users", Up: "CREATE TABLE users (id INTEGER);\nCREATE TABLE teams (id INTEGER);", Down: "DROP TABLE teams; DROP TABLE users;"},
+}
+
+func names(migrations []Migration) []string {
+	var names []string
+	for _, m := range migrations {
+		names = append(names, m.String())
+	}
+	return names
+}
+
+func TestUpDown(t *testing.T) {
+	ctx := context.Background()
+	db := newFakeDB()
+	m := newTestMigrator(t, db, testMigrations, Config{})
+
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := names(applied); !reflect.DeepEqual(got, []string{"1_create_users", "2_add_email"}) {
+		t.Fatalf("unexpected migrations applied: %v", got)
+	}
+	want := []string{"CREATE TABLE users (id INTEGER)", "CREATE TABLE teams (id INTEGER)", "ALTER TABLE users ADD COLUMN email TEXT"}
+	if !reflect.DeepEqual(db.executed, want) {
+		t.Errorf("got statements %q, want %q", db.executed, want)
+	}
+	if db.lock != nil {
+		t.Errorf("lock not released: %v", db.lock)
+	}
+
+	applied, err = m.Up(ctx)
+	if err != nil || len(applied) != 0 {
+		t.Fatalf("got %v, %v, want nothing applied", names(applied), err)
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(statuses) != 2 || !statuses[0].Applied || !statuses[1].Applied || statuses[0].AppliedAt.IsZero() {
+		t.Errorf("unexpected statuses: %+v", statuses)
+	}
+
+	rolledBack, err := m.Down(ctx, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := names(rolledBack); !reflect.DeepEqual(got, []string{"2_add_email"}) {
+		t.Errorf("unexpected migrations rolled back: %v", got)
+	}
+	if _, ok := db.applied[2]; ok {
+		t.Errorf("migration 2 still tracked")
+	}
+
+	rolledBack, err = m.DownTo(ctx, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := names(rolledBack); !reflect.DeepEqual(got, []string{"1_create_users"}) {
+		t.Errorf("unexpected migrations rolled back: %v", got)
+	}
+
+	applied, err = m.UpTo(ctx, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := names(applied); !reflect.DeepEqual(got, []string{"1_create_users"}) {
+		t.Errorf("unexpected migrations applied: %v", got)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	db := newFakeDB()
+	m := newTestMigrator(t, db, testMigrations, Config{DryRun: true})
+
+	applied, err := m.Up(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(applied) != 2 {
+		t.Errorf("got %v, want both migrations", names(applied))
+	}
+	if len(db.tables) != 0 || len(db.executed) != 0 || len(db.applied) != 0 {
+		t.Errorf("dry run changed the database: %+v", db)
+	}
+}
+
+func TestFailedMigration(t *testing.T) {
+	db := newFakeDB()
+	migrations := append([]Migration{
+		{Version: 3, Name: "broken", Up: "CREATE TABLE ok (id INTEGER); FAIL"},
+	}, testMigrations...)
+	m := newTestMigrator(t, db, migrations, Config{})
+
+	applied, err := m.Up(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "3_broken") {
+		t.Fatalf("got %v, want migration 3 to fail", err)
+	}
+	if len(applied) != 2 {
+		t.Errorf("got %v, want the first two applied", names(applied))
+	}
+	if _, ok := db.applied[3]; ok {
+		t.Errorf("failed migration tracked")
+	}
+	for _, stmt := range db.executed {
+		if strings.Contains(stmt, "ok") {
+			t.Errorf("failed migration partly applied: %s", stmt)
+		}
+	}
+	if db.lock != nil {
+		t.Errorf("lock not released: %v", db.lock)
+	}
+}
+
+func TestDrift(t *testing.T) {
+	ctx := context.Background()
+	db := newFakeDB()
+	if _, err := newTestMigrator(t, db, testMigrations, Config{}).Up(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rollback := []Migration{testMigrations[0], testMigrations[1]}
+	rollback[1].Down += " -- changed"
+	if err := newTestMigrator(t, db, rollback, Config{}).Verify(ctx); err != nil {
+		t.Fatalf("got %v for a changed down, want no drift", err)
+	}
+
+	modified := []Migration{testMigrations[0], testMigrations[1], {Version: 3, Name: "new", Up: "CREATE TABLE new (id INTEGER)"}}
+	modified[1].Up += " -- changed"
+	m := newTestMigrator(t, db, modified, Config{})
+	var drift *DriftError
+	if err := m.Verify(ctx); !errors.As(err, &drift) || drift.Version != 1 || drift.Missing {
+		t.Fatalf("got %v, want migration 1 drifted", err)
+	}
+	if _, err := m.Up(ctx); !errors.As(err, &drift) {
+		t.Fatalf("got %v, want a DriftError", err)
+	}
+
+	m = newTestMigrator(t, db, modified, Config{AllowDrift: true})
+	applied, err := m.Up(ctx)
+	if err != nil || len(applied) != 1 {
+		t.Fatalf("got %v, %v, want migration 3 applied", names(applied), err)
+	}
+
+	m = newTestMigrator(t, db, testMigrations[1:], Config{})
+	if err := m.Verify(ctx); !errors.As(err, &drift) || drift.Version != 2 || !drift.Missing {
+		t.Fatalf("got %v, want migration 2 missing", err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	defer func(interval time.Duration) { lockPollInterval = interval }(lockPollInterval)
+	lockPollInterval = 10 * time.Millisecond
+
+	ctx := context.Background()
+	db := newFakeDB()
+	db.lock = []interface{}{"other", float64(time.Now().Add(time.Hour).Unix())}
+
+	m := newTestMigrator(t, db, testMigrations, Config{Owner: "me", LockWait: 50 * time.Millisecond})
+	if _, err := m.Up(ctx); err != ErrLocked {
+		t.Fatalf("got %v, want ErrLocked", err)
+	}
+	if len(db.applied) != 0 {
+		t.Errorf("migrations applied without the lock")
+	}
+
+	// the lock is released while waiting for it
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		db.mu.Lock()
+		db.lock = nil
+		db.mu.Unlock()
+	}()
+	m = newTestMigrator(t, db, testMigrations, Config{Owner: "me", LockWait: time.Second})
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// an expired lock is taken over, in a transaction even if the
+	// connection runs its writes without
+	db.lock = []interface{}{"other", float64(time.Now().Add(-time.Minute).Unix())}
+	m.conn.SetExecutionWithTransaction(false)
+	if _, err := m.Down(ctx, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if db.lock != nil {
+		t.Errorf("lock not released: %v", db.lock)
+	}
+	for i, transaction := range db.lockTransactions {
+		if !transaction {
+			t.Errorf("attempt %d to take the lock not in a transaction", i)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package migrate
+
+/*
+	this file contains the loading of the migrations from an fs.FS
+*/
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Migration is a migration, read from its files.
+type Migration struct {
+	// Version orders the migrations. It is the number the file names
+	// start with.
+	Version int64
+	// Name is the rest of the file names, without the extensions.
+	Name string
+	// Up is the SQL applying the migration.
+	Up string
+	// Down is the SQL rolling the migration back, empty if there is none.
+	Down string
+	// Checksum is the SHA-256 of Up, in hex, to detect the migrations
+	// modified after being applied. Down is left out on purpose: it
+	// changes nothing until it is run, and adding or fixing the rollback
+	// of an applied migration is not a drift of the schema.
+	Checksum string
+}
+
+// String returns the file name of the migration, without the extensions.
+func (m Migration) String() string {
+	return fmt.Sprintf("%d_%s", m.Version, m.Name)
+}
+
+// checksum returns the checksum of the SQL of a migration
+func checksum(sql string) string {
+	sum := sha256.Sum256([]byte(sql))
+	return hex.EncodeToString(sum[:])
+}
+
+// Load reads the migrations in the root directory of fsys, ordered by
+// version.
+//
+// Migrations are files named VERSION_NAME.up.sql, with an optional
+// VERSION_NAME.down.sql rolling them back, VERSION being a number.
+// VERSION_NAME.sql is the same as VERSION_NAME.up.sql. Other files
+// are ignored. Use fs.Sub to read a subdirectory.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+
+		version, name, direction, err := parseFileName(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, name)
+		}
+
+		switch direction {
+		case "up":
+			if m.Up != "" {
+				return nil, fmt.Errorf("migration %d has two up files", version)
+			}
+			m.Up = string(content)
+			m.Checksum = checksum(m.Up)
+		case "down":
+			if m.Down != "" {
+				return nil, fmt.Errorf("migration %d has two down files", version)
+			}
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %s has no up file", m)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// parseFileName splits a migration file name in its parts
+func parseFileName(fileName string) (int64, string, string, error) {
+	base := strings.TrimSuffix(fileName, ".sql")
+	direction := "up"
+	switch {
+	case strings.HasSuffix(base, ".up"):
+		base = strings.TrimSuffix(base, ".up")
+	case strings.HasSuffix(base, ".down"):
+		base = strings.TrimSuffix(base, ".down")
+		direction = "down"
+	}
+
+	i := strings.IndexByte(base, '_')
+	if i <= 0 || i == len(base)-1 {
+		return 0, "", "", fmt.Errorf("invalid migration file name %s, want VERSION_NAME.up.sql", fileName)
+	}
+	version, err := strconv.ParseInt(base[:i], 10, 64)
+	if err != nil || version < 0 {
+		return 0, "", "", fmt.Errorf("invalid version in migration file name %s", fileName)
+	}
+	return version, base[i+1:], direction, nil
+}
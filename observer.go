@@ -0,0 +1,107 @@
+package gorqlite
+
+/*
+	this file contains the Observer of a connection, told about every
+	attempt of a request to a peer, the retries and failovers, and the
+	timings reported by rqlite
+*/
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RequestEvent is an attempt of a request to one peer.
+type RequestEvent struct {
+	// Op is the API operation: "query", "write", "request", "status",
+	// "nodes", "backup", "load" or "readyz".
+	Op string
+	// Peer is the host:port of the peer asked.
+	Peer string
+	// Retry is the pass over the peer list, 0 for the first, see
+	// WithRetry.
+	Retry int
+	// Status is the HTTP status code of the response, 0 without one.
+	Status int
+	// BytesSent and BytesReceived are the sizes of the request and
+	// response bodies.
+	BytesSent     int
+	BytesReceived int
+	// Duration is how long the attempt took.
+	Duration time.Duration
+	// Err is why the attempt failed, nil if it succeeded.
+	Err error
+}
+
+// FailoverEvent is a request going on to the next peer after one
+// failed to answer.
+type FailoverEvent struct {
+	Op   string
+	From string
+	To   string
+	Err  error
+}
+
+// RetryEvent is a request going over the peer list again, after all the
+// peers failed to answer.
+type RetryEvent struct {
+	Op      string
+	Retry   int
+	Backoff time.Duration
+}
+
+// Observer is told about the requests made by a connection, set by
+// WithObserver, for example to collect metrics as package metrics does.
+// Its methods are called synchronously, from the goroutine making the
+// request, and must be safe for concurrent use.
+type Observer interface {
+	// Request is called after every attempt of a request to a peer.
+	Request(ctx context.Context, e RequestEvent)
+	// Failover is called when a request goes on to the next peer.
+	Failover(ctx context.Context, e FailoverEvent)
+	// Retry is called when a request goes over the peer list again.
+	Retry(ctx context.Context, e RetryEvent)
+	// Timing is called with the time rqlite reports having spent on
+	// the statements of a query, write or request, in seconds.
+	Timing(ctx context.Context, op string, seconds float64)
+}
+
+// WithObserver sets the Observer told about the requests of the
+// connection. Defaults to none.
+func WithObserver(observer Observer) Option {
+	return func(conn *Connection) error {
+		if observer == nil {
+			return errors.New("observer is nil")
+		}
+		conn.observer = observer
+		return nil
+	}
+}
+
+// attemptDone logs and observes an attempt of a request, and the
+// failover to the next peer, if any, when it failed
+func (conn *Connection) attemptDone(ctx context.Context, e RequestEvent, next string) {
+	if e.Err == nil {
+		conn.log(ctx, LogLevelDebug, "request", "op", e.Op, "peer", e.Peer, "status", e.Status, "duration", e.Duration)
+	} else {
+		conn.log(ctx, LogLevelWarn, "request failed", "op", e.Op, "peer", e.Peer, "status", e.Status, "duration", e.Duration, "error", e.Err)
+	}
+	if conn.observer == nil {
+		return
+	}
+	conn.observer.Request(ctx, e)
+	if e.Err != nil && next != "" {
+		conn.observer.Failover(ctx, FailoverEvent{Op: e.Op, From: e.Peer, To: next, Err: e.Err})
+	}
+}
+
+// observeTiming tells the observer about the time section of a response
+func (conn *Connection) observeTiming(ctx context.Context, apiOp apiOperation, sections map[string]interface{}) {
+	if conn.observer == nil {
+		return
+	}
+	if seconds, ok := sections["time"].(float64); ok {
+		conn.observer.Timing(ctx, apiOp.String(), seconds)
+	}
+}
@@ -0,0 +1,102 @@
+package gorqlite
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type recordingObserver struct {
+	mu        sync.Mutex
+	requests  []RequestEvent
+	failovers []FailoverEvent
+	retries   []RetryEvent
+	timings   []float64
+}
+
+func (o *recordingObserver) Request(ctx context.Context, e RequestEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.requests = append(o.requests, e)
+}
+
+func (o *recordingObserver) Failover(ctx context.Context, e FailoverEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.failovers = append(o.failovers, e)
+}
+
+func (o *recordingObserver) Retry(ctx context.Context, e RetryEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.retries = append(o.retries, e)
+}
+
+func (o *recordingObserver) Timing(ctx context.Context, op string, seconds float64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.timings = append(o.timings, seconds)
+}
+
+func TestWithObserver(t *testing.T) {
+	var failing bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"results":[{"rows_affected":1,"time":0.001}],"time":0.25}`))
+	}))
+	defer srv.Close()
+
+	observer := &recordingObserver{}
+	conn, err := OpenWithOptions(srv.URL, WithClusterDiscovery(false), WithObserver(observer), WithRetry(2, 0))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// a dead leader, failing over to the test server
+	alive := conn.cluster.leader
+	conn.cluster.peerList = []peer{"127.0.0.1:1", alive}
+
+	if _, err := conn.WriteOne("INSERT INTO foo VALUES (1)"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(observer.requests) != 2 {
+		t.Fatalf("got %d requests, want 2: %v", len(observer.requests), observer.requests)
+	}
+	dead, ok := observer.requests[0], observer.requests[1]
+	if dead.Peer != "127.0.0.1:1" || dead.Err == nil || dead.Status != 0 || dead.Op != "write" {
+		t.Errorf("unexpected failed attempt: %+v", dead)
+	}
+	if ok.Peer != string(alive) || ok.Err != nil || ok.Status != http.StatusOK || ok.BytesSent == 0 || ok.BytesReceived == 0 || ok.Duration <= 0 {
+		t.Errorf("unexpected attempt: %+v", ok)
+	}
+	if len(observer.failovers) != 1 || observer.failovers[0].From != "127.0.0.1:1" || observer.failovers[0].To != string(alive) {
+		t.Errorf("unexpected failovers: %v", observer.failovers)
+	}
+	if len(observer.timings) != 1 || observer.timings[0] != 0.25 {
+		t.Errorf("unexpected timings: %v", observer.timings)
+	}
+
+	failing = true
+	observer.requests = nil
+	if _, err := conn.Status(); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if len(observer.requests) != 4 || observer.requests[3].Retry != 1 || observer.requests[3].Status != http.StatusServiceUnavailable {
+		t.Errorf("unexpected requests: %v", observer.requests)
+	}
+	if len(observer.retries) != 1 || observer.retries[0].Op != "status" || observer.retries[0].Retry != 1 {
+		t.Errorf("unexpected retries: %v", observer.retries)
+	}
+	if len(observer.failovers) != 3 || !strings.Contains(observer.failovers[2].From, "127.0.0.1:1") {
+		t.Errorf("unexpected failovers: %v", observer.failovers)
+	}
+
+	if _, err := OpenWithOptions(srv.URL, WithObserver(nil)); err == nil {
+		t.Errorf("expected error for a nil observer, got nil")
+	}
+}
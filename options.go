@@ -0,0 +1,189 @@
+package gorqlite
+
+/*
+	this file contains the functional options for OpenWithOptions()
+*/
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Option configures a Connection opened by OpenWithOptions.
+//
+// Options are applied in the order given, after the connection URL
+// has been parsed, so they take precedence over the URL query params.
+type Option func(conn *Connection) error
+
+// WithHTTPClient sets the HTTP client used for all communication with
+// rqlite. The client is not modified: if a timeout or TLS config is
+// also requested, a copy of the client is used instead.
+func WithHTTPClient(client *http.Client) Option {
+	return func(conn *Connection) error {
+		if client == nil {
+			return errors.New("http client is nil")
+		}
+		conn.client = client
+		return nil
+	}
+}
+
+// WithTimeout sets the timeout of every HTTP request made to rqlite.
+// It overrides the timeout URL query param, and the timeout of the
+// client given by WithHTTPClient.
+func WithTimeout(timeout time.Duration) Option {
+	return func(conn *Connection) error {
+		if timeout <= 0 {
+			return fmt.Errorf("invalid timeout: %s", timeout)
+		}
+		conn.timeout = timeout
+		return nil
+	}
+}
+
+// WithConsistencyLevel sets the consistency level of the connection,
+// as SetConsistencyLevel would. It overrides the level URL query param.
+func WithConsistencyLevel(level consistencyLevel) Option {
+	return func(conn *Connection) error {
+		if level < ConsistencyLevelNone || level > ConsistencyLevelStrong {
+			return fmt.Errorf("unknown consistency level: %d", level)
+		}
+		conn.consistencyLevel = level
+		return nil
+	}
+}
+
+// WithFreshness bounds how stale reads at consistency level none may be,
+// as SetFreshness would. It overrides the freshness and freshnessStrict
+// URL query params.
+func WithFreshness(freshness time.Duration, strict bool) Option {
+	return func(conn *Connection) error {
+		if freshness < 0 {
+			return fmt.Errorf("invalid freshness: %s", freshness)
+		}
+		conn.freshness = freshness
+		conn.freshnessStrict = strict
+		return nil
+	}
+}
+
+// WithTransactions sets whether statements are executed within a
+// transaction, as SetExecutionWithTransaction would. Defaults to true.
+func WithTransactions(state bool) Option {
+	return func(conn *Connection) error {
+		conn.wantsTransactions = state
+		return nil
+	}
+}
+
+// WithClusterDiscovery enables or disables Cluster Discovery. It
+// overrides the disableClusterDiscovery URL query param.
+func WithClusterDiscovery(enabled bool) Option {
+	return func(conn *Connection) error {
+		conn.disableClusterDiscovery = !enabled
+		return nil
+	}
+}
+
+// WithDiscoveryMode sets how the host of the connection URL is turned
+// into peers. It overrides the URL scheme and the discovery URL query
+// param.
+func WithDiscoveryMode(mode discoveryMode) Option {
+	return func(conn *Connection) error {
+		if mode < DiscoveryModeNone || mode > DiscoveryModeSRV {
+			return fmt.Errorf("unknown discovery mode: %d", mode)
+		}
+		conn.discoveryMode = mode
+		return nil
+	}
+}
+
+// WithResolver sets the resolver used for DNS based discovery.
+// Defaults to net.DefaultResolver.
+func WithResolver(resolver Resolver) Option {
+	return func(conn *Connection) error {
+		if resolver == nil {
+			return errors.New("resolver is nil")
+		}
+		conn.resolver = resolver
+		return nil
+	}
+}
+
+// WithRetry makes every API call go over the peer list up to attempts
+// times before giving up. The wait between two passes starts at
+// backoff and doubles after each pass. Defaults to a single pass.
+func WithRetry(attempts int, backoff time.Duration) Option {
+	return func(conn *Connection) error {
+		if attempts < 1 {
+			return fmt.Errorf("invalid number of attempts: %d", attempts)
+		}
+		if backoff < 0 {
+			return fmt.Errorf("invalid backoff: %s", backoff)
+		}
+		conn.retryAttempts = attempts
+		conn.retryBackoff = backoff
+		return nil
+	}
+}
+
+// WithTLSConfig sets the TLS config used to talk to rqlite. It is set
+// on a copy of the transport of the HTTP client, which therefore has to
+// be nil or an *http.Transport.
+//
+// The other WithTLS* options and the tls* URL query params are applied
+// on top of a copy of config.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(conn *Connection) error {
+		if config == nil {
+			return errors.New("tls config is nil")
+		}
+		conn.tlsConfig = config
+		return nil
+	}
+}
+
+// WithTLSCACert makes the connection trust the CAs in the PEM bundle at
+// path, instead of the system ones. It overrides the tlsCACert URL
+// query param.
+func WithTLSCACert(path string) Option {
+	return func(conn *Connection) error {
+		conn.tls.caCertFile = path
+		return nil
+	}
+}
+
+// WithTLSClientCert makes the connection present the PEM certificate
+// and key at the given paths, for mutual TLS. It overrides the tlsCert
+// and tlsKey URL query params.
+func WithTLSClientCert(certPath, keyPath string) Option {
+	return func(conn *Connection) error {
+		conn.tls.certFile = certPath
+		conn.tls.keyFile = keyPath
+		return nil
+	}
+}
+
+// WithTLSServerName sets the name the server certificates are verified
+// against, for when nodes are reached by an address not in their
+// certificate. It overrides the tlsServerName URL query param.
+func WithTLSServerName(name string) Option {
+	return func(conn *Connection) error {
+		conn.tls.serverName = name
+		return nil
+	}
+}
+
+// WithTLSInsecureSkipVerify disables the verification of the server
+// certificates, or enables it if false. It overrides the
+// tlsInsecureSkipVerify URL query param, and the InsecureSkipVerify of
+// the config given by WithTLSConfig.
+func WithTLSInsecureSkipVerify(skip bool) Option {
+	return func(conn *Connection) error {
+		conn.tls.insecureSkipVerify = &skip
+		return nil
+	}
+}
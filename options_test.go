@@ -0,0 +1,185 @@
+package gorqlite
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOpenWithOptions(t *testing.T) {
+	t.Run("URL values", func(t *testing.T) {
+		conn, err := OpenWithOptions("http://localhost:4001?level=none&timeout=30", WithClusterDiscovery(false))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if conn.consistencyLevel != ConsistencyLevelNone {
+			t.Errorf("got level %s, want none", conn.consistencyLevel)
+		}
+		if conn.client.Timeout != 30*time.Second {
+			t.Errorf("got timeout %s, want 30s", conn.client.Timeout)
+		}
+		if !conn.wantsTransactions {
+			t.Errorf("expected transactions to be on by default")
+		}
+	})
+
+	t.Run("options win over URL values", func(t *testing.T) {
+		conn, err := OpenWithOptions("http://localhost:4001?level=none&timeout=30&disableClusterDiscovery=false",
+			WithConsistencyLevel(ConsistencyLevelStrong),
+			WithTimeout(5*time.Second),
+			WithTransactions(false),
+			WithClusterDiscovery(false),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if conn.consistencyLevel != ConsistencyLevelStrong {
+			t.Errorf("got level %s, want strong", conn.consistencyLevel)
+		}
+		if conn.client.Timeout != 5*time.Second {
+			t.Errorf("got timeout %s, want 5s", conn.client.Timeout)
+		}
+		if conn.wantsTransactions {
+			t.Errorf("expected transactions to be off")
+		}
+		if !conn.disableClusterDiscovery {
+			t.Errorf("expected cluster discovery to be disabled")
+		}
+	})
+
+	t.Run("timeout applies to the client given", func(t *testing.T) {
+		client := &http.Client{Timeout: time.Minute}
+		conn, err := OpenWithOptions("http://localhost:4001?timeout=3", WithHTTPClient(client), WithClusterDiscovery(false))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if conn.client.Timeout != 3*time.Second {
+			t.Errorf("got timeout %s, want 3s", conn.client.Timeout)
+		}
+		if client.Timeout != time.Minute {
+			t.Errorf("the client given was modified")
+		}
+	})
+
+	t.Run("client given is used as is", func(t *testing.T) {
+		client := &http.Client{Timeout: time.Minute}
+		conn, err := OpenWithOptions("http://localhost:4001", WithHTTPClient(client), WithClusterDiscovery(false))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if conn.client != client {
+			t.Errorf("expected the client given to be used")
+		}
+	})
+
+	t.Run("TLS config", func(t *testing.T) {
+		config := &tls.Config{ServerName: "rqlite.example.com"}
+		conn, err := OpenWithOptions("https://localhost:4001", WithTLSConfig(config), WithClusterDiscovery(false))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		transport, ok := conn.client.Transport.(*http.Transport)
+		if !ok {
+			t.Fatalf("got transport %T, want *http.Transport", conn.client.Transport)
+		}
+		if transport.TLSClientConfig != config {
+			t.Errorf("expected the TLS config given to be used")
+		}
+	})
+
+	t.Run("TLS verification enabled over the config", func(t *testing.T) {
+		config := &tls.Config{InsecureSkipVerify: true}
+		conn, err := OpenWithOptions("https://localhost:4001", WithTLSConfig(config), WithTLSInsecureSkipVerify(false), WithClusterDiscovery(false))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		transport := conn.client.Transport.(*http.Transport)
+		if transport.TLSClientConfig.InsecureSkipVerify {
+			t.Errorf("expected the server certificates to be verified")
+		}
+		if !config.InsecureSkipVerify {
+			t.Errorf("the TLS config given was modified")
+		}
+	})
+
+	t.Run("TLS settings over the config of the client", func(t *testing.T) {
+		pool := x509.NewCertPool()
+		config := &tls.Config{RootCAs: pool}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+		conn, err := OpenWithOptions("https://localhost:4001?tlsServerName=foo", WithHTTPClient(client), WithClusterDiscovery(false))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got := conn.client.Transport.(*http.Transport).TLSClientConfig
+		if got.RootCAs != pool || got.ServerName != "foo" {
+			t.Errorf("got RootCAs %p and server name %q, want %p and foo", got.RootCAs, got.ServerName, pool)
+		}
+		if config.ServerName != "" {
+			t.Errorf("the TLS config of the client was modified")
+		}
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		opts := []Option{
+			WithHTTPClient(nil),
+			WithTimeout(0),
+			WithConsistencyLevel(100),
+			WithDiscoveryMode(100),
+			WithResolver(nil),
+			WithRetry(0, 0),
+			WithTLSConfig(nil),
+		}
+		for _, opt := range opts {
+			if _, err := OpenWithOptions("http://localhost:4001", opt, WithClusterDiscovery(false)); err == nil {
+				t.Errorf("expected error, got nil")
+			}
+		}
+	})
+}
+
+func TestWithRetry(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"results":[{"rows_affected":1}]}`))
+	}))
+	defer srv.Close()
+
+	t.Run("gives up after a single pass by default", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		conn, err := OpenWithOptions(srv.URL, WithClusterDiscovery(false))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_, err = conn.WriteOne("INSERT INTO foo VALUES (1)")
+		if err == nil || !strings.Contains(err.Error(), "503") {
+			t.Errorf("expected a 503 error, got %v", err)
+		}
+	})
+
+	t.Run("retries", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		conn, err := OpenWithOptions(srv.URL, WithClusterDiscovery(false), WithRetry(3, time.Millisecond))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		wr, err := conn.WriteOne("INSERT INTO foo VALUES (1)")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if wr.RowsAffected != 1 {
+			t.Errorf("got %d rows affected, want 1", wr.RowsAffected)
+		}
+		if n := atomic.LoadInt32(&calls); n != 3 {
+			t.Errorf("got %d calls, want 3", n)
+		}
+	})
+}
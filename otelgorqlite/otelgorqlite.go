@@ -0,0 +1,114 @@
+// Package otelgorqlite adapts OpenTelemetry tracing to gorqlite, the
+// spans of gorqlite becoming OpenTelemetry client spans:
+//
+//	conn, err := gorqlite.OpenWithOptions(connURL,
+//		gorqlite.WithTracer(otelgorqlite.NewTracer()),
+//	)
+//
+// It is a module of its own, so that gorqlite itself doesn't depend on
+// OpenTelemetry.
+package otelgorqlite
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rqlite/gorqlite"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer of gorqlite spans
+const instrumentationName = "github.com/rqlite/gorqlite/otelgorqlite"
+
+// these aren't checked automatically anywhere else, so we check them here
+var _ gorqlite.Tracer = (*Tracer)(nil)
+var _ gorqlite.Span = (*span)(nil)
+
+// Tracer starts OpenTelemetry spans for gorqlite.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// Option configures a Tracer.
+type Option func(*Tracer)
+
+// WithTracerProvider sets the provider of the tracer. Defaults to the
+// global one, otel.GetTracerProvider().
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(t *Tracer) {
+		t.tracer = provider.Tracer(instrumentationName)
+	}
+}
+
+// NewTracer returns a Tracer for gorqlite.WithTracer.
+func NewTracer(opts ...Option) *Tracer {
+	t := &Tracer{}
+	for _, opt := range opts {
+		opt(t)
+	}
+	if t.tracer == nil {
+		t.tracer = otel.GetTracerProvider().Tracer(instrumentationName)
+	}
+	return t
+}
+
+// Start starts a client span as a child of the span of ctx, if any.
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...gorqlite.Attribute) (context.Context, gorqlite.Span) {
+	ctx, s := t.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(convert(attrs)...),
+	)
+	return ctx, &span{span: s}
+}
+
+type span struct {
+	span trace.Span
+}
+
+func (s *span) SetAttributes(attrs ...gorqlite.Attribute) {
+	s.span.SetAttributes(convert(attrs)...)
+}
+
+// TraceParent returns the W3C traceparent of the span, "" if it isn't
+// valid, as with a no-op tracer provider.
+func (s *span) TraceParent() string {
+	sc := s.span.SpanContext()
+	if !sc.IsValid() {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID(), sc.SpanID(), sc.TraceFlags())
+}
+
+// End records err, if any, as the error status of the span, and ends it.
+func (s *span) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
+
+// convert makes the attributes of gorqlite OpenTelemetry ones
+func convert(attrs []gorqlite.Attribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		switch v := attr.Value.(type) {
+		case string:
+			kvs = append(kvs, attribute.String(attr.Key, v))
+		case int:
+			kvs = append(kvs, attribute.Int(attr.Key, v))
+		case int64:
+			kvs = append(kvs, attribute.Int64(attr.Key, v))
+		case float64:
+			kvs = append(kvs, attribute.Float64(attr.Key, v))
+		case bool:
+			kvs = append(kvs, attribute.Bool(attr.Key, v))
+		default:
+			kvs = append(kvs, attribute.String(attr.Key, fmt.Sprint(v)))
+		}
+	}
+	return kvs
+}
@@ -0,0 +1,62 @@
+package otelgorqlite
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rqlite/gorqlite"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracer(t *testing.T) {
+	var traceParent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceParent = r.Header.Get("traceparent")
+		w.Write([]byte(`{"results":[{"rows_affected":1}]}`))
+	}))
+	defer srv.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	conn, err := gorqlite.OpenWithOptions(srv.URL, gorqlite.WithClusterDiscovery(false),
+		gorqlite.WithTracer(NewTracer(WithTracerProvider(provider))))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := conn.WriteOne("INSERT INTO foo VALUES (1)"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	attempt, write := spans[0], spans[1]
+	if write.Name() != "gorqlite.write" || attempt.Parent().SpanID() != write.SpanContext().SpanID() {
+		t.Errorf("attempt span %s not a child of %s", attempt.Name(), write.Name())
+	}
+	if want := "00-" + attempt.SpanContext().TraceID().String() + "-" + attempt.SpanContext().SpanID().String() + "-01"; traceParent != want {
+		t.Errorf("got traceparent %q, want %q", traceParent, want)
+	}
+	found := false
+	for _, kv := range write.Attributes() {
+		if kv == attribute.String("db.statement", "INSERT INTO foo VALUES (?)") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("db.statement missing from %v", write.Attributes())
+	}
+
+	_, s := NewTracer(WithTracerProvider(provider)).Start(context.Background(), "failing")
+	s.End(errors.New("boom"))
+	if failed := recorder.Ended()[2]; failed.Status().Code != codes.Error || failed.Status().Description != "boom" {
+		t.Errorf("unexpected status: %v", failed.Status())
+	}
+}
@@ -2,10 +2,12 @@ package gorqlite
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -254,6 +256,58 @@ func (conn *Connection) QueryParameterizedContext(ctx context.Context, sqlStatem
 
 	trace("%s: Query() for %d statements", conn.ID, len(sqlStatements))
 
+	ctx, span := conn.startSpan(ctx, "query", sqlStatements)
+	defer func() { span.End(err) }()
+
+	var key string
+	ro := requestOptionsFromContext(ctx)
+	rs := conn.requestSettings(ro)
+	if conn.queryCache != nil || conn.queryFlights != nil {
+		key, err = queryKey(rs, sqlStatements)
+		if err != nil {
+			var errResult QueryResult
+			errResult.Err = err
+			results = append(results, errResult)
+			return results, err
+		}
+	}
+
+	if conn.queryCache != nil {
+		if cached, ok := conn.queryCache.get(key); ok {
+			trace("%s: query cache hit", conn.ID)
+			span.SetAttributes(Attribute{"db.rqlite.cached", true})
+			for i := range cached {
+				cached[i].conn = conn
+			}
+			return cached, nil
+		}
+	}
+
+	if conn.queryFlights != nil {
+		var shared bool
+		results, shared, err = conn.queryFlights.do(ctx, flightKey(key, rs, ro), func(ctx context.Context) ([]QueryResult, error) {
+			return conn.query(ctx, key, sqlStatements)
+		})
+		if shared {
+			trace("%s: query shared with a concurrent identical one", conn.ID)
+			span.SetAttributes(Attribute{"db.rqlite.shared", true})
+		}
+		return results, err
+	}
+
+	return conn.query(ctx, key, sqlStatements)
+}
+
+// query sends the statements to rqlite and parses the results, caching
+// them under key if there is a cache
+func (conn *Connection) query(ctx context.Context, key string, sqlStatements []ParameterizedStatement) (results []QueryResult, err error) {
+	results = make([]QueryResult, 0)
+
+	var cacheGeneration uint64
+	if conn.queryCache != nil {
+		cacheGeneration = conn.queryCache.currentGeneration()
+	}
+
 	// if we get an error POSTing, that's a showstopper
 	response, err := conn.rqliteApiPost(ctx, api_QUERY, sqlStatements)
 	if err != nil {
@@ -275,18 +329,22 @@ func (conn *Connection) QueryParameterizedContext(ctx context.Context, sqlStatem
 		results = append(results, errResult)
 		return results, err
 	}
+	conn.observeTiming(ctx, api_QUERY, sections)
+
+	// reads rejected as stale get an error of their own
+	rs := conn.requestSettings(requestOptionsFromContext(ctx))
 
 	// if we got an error from the api, that's a showstopper
 	if errMsg, ok := sections["error"].(string); ok && errMsg != "" {
 		trace("%s: api ERROR: %s", conn.ID, errMsg)
 		var errResult QueryResult
-		errResult.Err = fmt.Errorf("%s", errMsg)
+		errResult.Err = checkStaleRead(fmt.Errorf("%s", errMsg), rs)
 		results = append(results, errResult)
 		return results, errResult.Err
 	}
 
 	// at this point, we have a "results" section and
-	// a "time" section.  we can ignore the latter.
+	// a "time" section, only observed.
 
 	resultsArray := sections["results"].([]interface{})
 	trace("%s: I have %d result(s) to parse", conn.ID, len(resultsArray))
@@ -296,6 +354,7 @@ func (conn *Connection) QueryParameterizedContext(ctx context.Context, sqlStatem
 		trace("%s: parsing result %d", conn.ID, n)
 		qr := conn.parseQueryResult(r.(map[string]interface{}))
 		qr.conn = conn
+		qr.Err = checkStaleRead(qr.Err, rs)
 		results = append(results, qr)
 		if qr.Err != nil {
 			errs = append(errs, qr.Err)
@@ -304,6 +363,10 @@ func (conn *Connection) QueryParameterizedContext(ctx context.Context, sqlStatem
 
 	trace("%s: finished parsing, returning %d results", conn.ID, len(results))
 
+	if conn.queryCache != nil && len(errs) == 0 {
+		conn.queryCache.put(key, cacheGeneration, sqlStatements, results)
+	}
+
 	return results, joinErrors(errs...)
 }
 
@@ -330,6 +393,7 @@ type QueryResult struct {
 	Timing    float64
 	values    []interface{}
 	rowNumber int64
+	cached    bool
 }
 
 // these are done as getters rather than as public
@@ -503,6 +567,11 @@ func toTime(src interface{}) (time.Time, error) {
 //
 // booleans, JSON arrays, and JSON objects are not supported,
 // since sqlite does not support them.
+//
+// The values of BLOB columns, which rqlite sends as base64 strings, are
+// decoded when scanned into a *[]byte, and NULL is scanned into it as a
+// nil slice, so that a variable reused across rows doesn't keep the
+// bytes of the previous one.
 func (qr *QueryResult) Scan(dest ...interface{}) error {
 	trace("%s: Scan() called for %d vars", qr.conn.ID, len(dest))
 
@@ -622,7 +691,17 @@ func (qr *QueryResult) Scan(dest ...interface{}) error {
 			case []byte:
 				*d = src
 			case string:
-				*d = []byte(src)
+				if !strings.Contains(strings.ToUpper(qr.types[n]), "BLOB") {
+					*d = []byte(src)
+					break
+				}
+				b, err := base64.StdEncoding.DecodeString(src)
+				if err != nil {
+					return fmt.Errorf("invalid blob col:%d val:%v: %w", n, src, err)
+				}
+				*d = b
+			case nil:
+				*d = nil
 			default:
 				return fmt.Errorf("invalid []byte col:%d type:%T val:%v", n, src, src)
 			}
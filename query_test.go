@@ -3,6 +3,8 @@ package gorqlite_test
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -567,3 +569,58 @@ func TestScanNullableTypes(t *testing.T) {
 		t.Errorf("nullTime should be valid and set to '%v' but it's '%v'", meeting, nullTime.Time)
 	}
 }
+
+func TestBlobColumns(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results":[{"columns":["data","note"],"types":["BLOB","text"],"values":[["AP8=","AP8="]]}]}`))
+	}))
+	defer srv.Close()
+
+	conn, err := gorqlite.OpenWithOptions(srv.URL, gorqlite.WithClusterDiscovery(false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	qr, err := conn.QueryOne("SELECT data, note FROM blobs")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	qr.Next()
+	var data, note []byte
+	if err := qr.Scan(&data, &note); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(data) != "\x00\xff" {
+		t.Errorf("got blob %q, want the decoded bytes", data)
+	}
+	if string(note) != "AP8=" {
+		t.Errorf("got text %q, want it as is", note)
+	}
+}
+
+func TestScanNullBytes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results":[{"columns":["data"],"types":["blob"],"values":[["AP8="],[null]]}]}`))
+	}))
+	defer srv.Close()
+
+	conn, err := gorqlite.OpenWithOptions(srv.URL, gorqlite.WithClusterDiscovery(false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	qr, err := conn.QueryOne("SELECT data FROM blobs")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var data []byte
+	qr.Next()
+	if err := qr.Scan(&data); err != nil || len(data) != 2 {
+		t.Fatalf("got %q, %v", data, err)
+	}
+	qr.Next()
+	if err := qr.Scan(&data); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data != nil {
+		t.Errorf("got %q for NULL, want nil", data)
+	}
+}
@@ -0,0 +1,380 @@
+package gorqlite
+
+/*
+	this file contains the cache of query results, opted in with
+	WithQueryCache, and its invalidation by the writes of the connection
+	to the tables read
+*/
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rqlite/gorqlite/internal/sqltok"
+)
+
+// WithQueryCache caches the results of QueryParameterizedContext, and of
+// the calls made through it, such as Query and QueryOne. Results are
+// keyed by their statements, arguments and consistency level, and kept
+// for ttl at most, maxEntries of them at most, the least recently used
+// being evicted first. Results with errors aren't cached.
+//
+// The writes made through the connection invalidate the results read
+// from the tables they write to, a statement writing to tables that
+// can't be told invalidating every result. Queued writes invalidate
+// when queued, not when applied, unless waited for. Writes made
+// otherwise, or to the tables under a view or through triggers, are not
+// seen: use InvalidateQueryCache, and keep the ttl short enough.
+func WithQueryCache(maxEntries int, ttl time.Duration) Option {
+	return func(conn *Connection) error {
+		if maxEntries < 1 {
+			return fmt.Errorf("invalid query cache size: %d", maxEntries)
+		}
+		if ttl <= 0 {
+			return fmt.Errorf("invalid query cache ttl: %s", ttl)
+		}
+		conn.queryCache = newQueryCache(maxEntries, ttl)
+		return nil
+	}
+}
+
+// InvalidateQueryCache drops the cached results read from any of the
+// tables given, or every cached result if none is given. It does nothing
+// without WithQueryCache.
+func (conn *Connection) InvalidateQueryCache(tables ...string) {
+	if conn.queryCache == nil {
+		return
+	}
+	if len(tables) == 0 {
+		conn.queryCache.clear()
+		return
+	}
+	conn.queryCache.invalidate(tables, false)
+}
+
+// Cached tells whether the result comes from the query cache, see
+// WithQueryCache.
+func (qr *QueryResult) Cached() bool {
+	return qr.cached
+}
+
+// queryCache is safe for concurrent use
+type queryCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	ttl        time.Duration
+	// order has the *cachedQuery, the most recently used first
+	order *list.List
+	byKey map[string]*list.Element
+	// generation changes with every invalidation, so that results read
+	// while a write was made are not cached
+	generation uint64
+	now        func() time.Time
+}
+
+type cachedQuery struct {
+	key     string
+	tables  []string
+	results []QueryResult
+	expires time.Time
+}
+
+func newQueryCache(maxEntries int, ttl time.Duration) *queryCache {
+	return &queryCache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		order:      list.New(),
+		byKey:      make(map[string]*list.Element),
+		now:        time.Now,
+	}
+}
+
+// queryKey keys statements read with the settings of a request, for
+// the cache and single flights
+func queryKey(rs requestSettings, statements []ParameterizedStatement) (string, error) {
+	formatted := make([][]interface{}, len(statements))
+	for i, statement := range statements {
+		formatted[i] = formatStatement(statement)
+	}
+	body, err := json.Marshal(formatted)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s\x00%s\x00%t\x00%s", consistencyLevelToString[rs.consistencyLevel], rs.freshness, rs.freshnessStrict, body), nil
+}
+
+// get returns copies of the results cached, ready to be read
+func (c *queryCache) get(key string) ([]QueryResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.byKey[key]
+	if !ok {
+		return nil, false
+	}
+	cq := e.Value.(*cachedQuery)
+	if c.now().After(cq.expires) {
+		c.remove(e)
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+
+	results := make([]QueryResult, len(cq.results))
+	for i, qr := range cq.results {
+		qr.rowNumber = -1
+		qr.cached = true
+		results[i] = qr
+	}
+	return results, true
+}
+
+// currentGeneration is taken before reading, to be given to put
+func (c *queryCache) currentGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// put caches the results, unless an invalidation happened since
+// generation was taken
+func (c *queryCache) put(key string, generation uint64, statements []ParameterizedStatement, results []QueryResult) {
+	var tables []string
+	for _, statement := range statements {
+		tables = append(tables, readTables(statement.Query)...)
+	}
+	kept := make([]QueryResult, len(results))
+	copy(kept, results)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	if e, ok := c.byKey[key]; ok {
+		c.remove(e)
+	}
+	c.byKey[key] = c.order.PushFront(&cachedQuery{key: key, tables: tables, results: kept, expires: c.now().Add(c.ttl)})
+	for c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *queryCache) remove(e *list.Element) {
+	c.order.Remove(e)
+	delete(c.byKey, e.Value.(*cachedQuery).key)
+}
+
+// invalidate drops the results read from any of the tables, or all of
+// them
+func (c *queryCache) invalidate(tables []string, all bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for e := c.order.Front(); e != nil; {
+		next := e.Next()
+		if all || sharesTable(e.Value.(*cachedQuery).tables, tables) {
+			c.remove(e)
+		}
+		e = next
+	}
+}
+
+func (c *queryCache) clear() {
+	c.invalidate(nil, true)
+}
+
+// invalidateStatements drops the results read from the tables the
+// statements write to
+func (c *queryCache) invalidateStatements(statements []ParameterizedStatement) {
+	var tables []string
+	for _, statement := range statements {
+		written, all := writtenTables(statement.Query)
+		if all {
+			c.clear()
+			return
+		}
+		tables = append(tables, written...)
+	}
+	if len(tables) > 0 {
+		c.invalidate(tables, false)
+	}
+}
+
+func sharesTable(read, written []string) bool {
+	for _, r := range read {
+		for _, w := range written {
+			if strings.EqualFold(r, w) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// clauseKeywords end the table list of a FROM clause, and aren't aliases
+var clauseKeywords = map[string]bool{
+	"WHERE": true, "JOIN": true, "LEFT": true, "RIGHT": true, "FULL": true,
+	"INNER": true, "OUTER": true, "CROSS": true, "NATURAL": true, "ON": true,
+	"USING": true, "GROUP": true, "ORDER": true, "LIMIT": true, "HAVING": true,
+	"WINDOW": true, "UNION": true, "EXCEPT": true, "INTERSECT": true,
+	"INDEXED": true, "NOT": true, "RETURNING": true, "AS": true,
+}
+
+// readTables returns the tables, views and table-valued functions named
+// after FROM and JOIN in a statement, subqueries included, in lower
+// case. Naming more than read only makes invalidation more eager.
+func readTables(sql string) []string {
+	tokens := significant(sqltok.Tokenize(sql))
+	var tables []string
+	for i := 0; i < len(tokens); i++ {
+		if !tokens[i].Is("FROM") && !tokens[i].Is("JOIN") {
+			continue
+		}
+		j := i + 1
+		for {
+			name, next, ok := tableName(tokens, j)
+			if !ok {
+				break
+			}
+			tables = append(tables, name)
+			j = next
+			// an alias, with or without AS
+			if j < len(tokens) && tokens[j].Is("AS") {
+				j++
+			}
+			if j < len(tokens) && (tokens[j].Kind == sqltok.Word && !clauseKeywords[strings.ToUpper(tokens[j].Text)] || tokens[j].Kind == sqltok.QuotedIdent) {
+				j++
+			}
+			// FROM a, b
+			if j >= len(tokens) || tokens[j].Text != "," {
+				break
+			}
+			j++
+		}
+		// the token after, such as a JOIN, is looked at next
+		i = j - 1
+	}
+	return tables
+}
+
+// noWriteKeywords start statements writing to no table
+var noWriteKeywords = map[string]bool{
+	"SELECT": true, "VALUES": true, "EXPLAIN": true, "PRAGMA": true,
+	"CREATE": true, "BEGIN": true, "COMMIT": true, "END": true,
+	"ROLLBACK": true, "SAVEPOINT": true, "RELEASE": true, "ANALYZE": true,
+	"REINDEX": true, "VACUUM": true,
+}
+
+// writtenTables returns the tables a statement writes to, in lower
+// case, all being true when they can't be told
+func writtenTables(sql string) (tables []string, all bool) {
+	tokens := significant(sqltok.Tokenize(sql))
+	if len(tokens) == 0 {
+		return nil, false
+	}
+	first := strings.ToUpper(tokens[0].Text)
+	if tokens[0].Kind != sqltok.Word {
+		return nil, true
+	}
+	if noWriteKeywords[first] {
+		return nil, false
+	}
+
+	start := 0
+	if first == "WITH" {
+		// the statement after the common table expressions
+		start = -1
+		depth := 0
+		for i, tok := range tokens {
+			switch {
+			case tok.Text == "(":
+				depth++
+			case tok.Text == ")":
+				depth--
+			case depth == 0 && (tok.Is("INSERT") || tok.Is("REPLACE") || tok.Is("UPDATE") || tok.Is("DELETE")):
+				start = i
+			case depth == 0 && tok.Is("SELECT"):
+				return nil, false
+			}
+			if start >= 0 {
+				break
+			}
+		}
+		if start < 0 {
+			return nil, true
+		}
+	}
+
+	var at int
+	switch {
+	case tokens[start].Is("INSERT"), tokens[start].Is("REPLACE"):
+		at = indexOf(tokens, start, "INTO") + 1
+	case tokens[start].Is("UPDATE"):
+		at = start + 1
+		if at < len(tokens) && tokens[at].Is("OR") {
+			at += 2
+		}
+	case tokens[start].Is("DELETE"):
+		at = indexOf(tokens, start, "FROM") + 1
+	case tokens[start].Is("DROP"), tokens[start].Is("ALTER"):
+		if start+1 < len(tokens) && !tokens[start+1].Is("TABLE") && !tokens[start+1].Is("VIEW") {
+			// indexes and triggers
+			return nil, false
+		}
+		at = start + 2
+		if at+1 < len(tokens) && tokens[at].Is("IF") && tokens[at+1].Is("EXISTS") {
+			at += 2
+		}
+	default:
+		return nil, true
+	}
+	if at <= 0 {
+		return nil, true
+	}
+	name, _, ok := tableName(tokens, at)
+	if !ok {
+		return nil, true
+	}
+	return []string{name}, false
+}
+
+// tableName reads a table name at i, with its schema if any, and
+// returns it in lower case with the index after it
+func tableName(tokens []sqltok.Token, i int) (string, int, bool) {
+	if i >= len(tokens) {
+		return "", i, false
+	}
+	tok := tokens[i]
+	if tok.Kind == sqltok.Word && clauseKeywords[strings.ToUpper(tok.Text)] || tok.Kind != sqltok.Word && tok.Kind != sqltok.QuotedIdent && tok.Kind != sqltok.String {
+		return "", i, false
+	}
+	name := tok.Ident()
+	i++
+	if i+1 < len(tokens) && tokens[i].Text == "." {
+		name = tokens[i+1].Ident()
+		i += 2
+	}
+	return strings.ToLower(name), i, true
+}
+
+func indexOf(tokens []sqltok.Token, from int, keyword string) int {
+	for i := from; i < len(tokens); i++ {
+		if tokens[i].Is(keyword) {
+			return i
+		}
+	}
+	return -1
+}
+
+func significant(tokens []sqltok.Token) []sqltok.Token {
+	kept := tokens[:0]
+	for _, tok := range tokens {
+		if tok.Significant() {
+			kept = append(kept, tok)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,154 @@
+package gorqlite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWithQueryCache(t *testing.T) {
+	queries := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/db/query" {
+			queries++
+			w.Write([]byte(`{"results":[{"columns":["id"],"types":["integer"],"values":[[1],[2]]}]}`))
+			return
+		}
+		w.Write([]byte(`{"results":[{"rows_affected":1}]}`))
+	}))
+	defer srv.Close()
+
+	conn, err := OpenWithOptions(srv.URL, WithClusterDiscovery(false), WithQueryCache(2, time.Minute))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now := time.Now()
+	conn.queryCache.now = func() time.Time { return now }
+
+	query := func(sql string, args ...interface{}) *QueryResult {
+		t.Helper()
+		qr, err := conn.QueryOneParameterized(ParameterizedStatement{Query: sql, Arguments: args})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return &qr
+	}
+
+	if qr := query("SELECT id FROM foo WHERE id > ?", 0); qr.Cached() {
+		t.Errorf("first query cached")
+	}
+	qr := query("SELECT id FROM foo WHERE id > ?", 0)
+	if !qr.Cached() || queries != 1 {
+		t.Errorf("got cached %v after %d queries, want a hit after 1", qr.Cached(), queries)
+	}
+	var ids []int64
+	for qr.Next() {
+		var id int64
+		if err := qr.Scan(&id); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if !reflect.DeepEqual(ids, []int64{1, 2}) {
+		t.Errorf("got ids %v, want [1 2]", ids)
+	}
+	// reading a hit doesn't move the rows of the next one
+	if qr := query("SELECT id FROM foo WHERE id > ?", 0); !qr.Cached() || !qr.Next() || qr.RowNumber() != 0 {
+		t.Errorf("unexpected hit: %+v", qr)
+	}
+
+	// other arguments and consistency levels are other entries
+	query("SELECT id FROM foo WHERE id > ?", 1)
+	conn.SetConsistencyLevel(ConsistencyLevelStrong)
+	query("SELECT id FROM foo WHERE id > ?", 1)
+	if queries != 3 {
+		t.Errorf("got %d queries, want 3", queries)
+	}
+	// and evicted the least recently used
+	if query("SELECT id FROM foo WHERE id > ?", 0).Cached() {
+		t.Errorf("least recently used entry not evicted")
+	}
+	if queries != 4 {
+		t.Errorf("got %d queries, want 4", queries)
+	}
+
+	now = now.Add(time.Minute + time.Second)
+	if query("SELECT id FROM foo WHERE id > ?", 0).Cached() {
+		t.Errorf("expired entry hit")
+	}
+
+	// writes to other tables leave the entry, writes to foo drop it
+	conn.WriteOne("INSERT INTO bar VALUES (1)")
+	if !query("SELECT id FROM foo WHERE id > ?", 0).Cached() {
+		t.Errorf("entry dropped by a write to another table")
+	}
+	conn.WriteOne("UPDATE Main.FOO SET id = 3")
+	if query("SELECT id FROM foo WHERE id > ?", 0).Cached() {
+		t.Errorf("entry not dropped by a write to its table")
+	}
+
+	conn.InvalidateQueryCache("baz")
+	if !query("SELECT id FROM foo WHERE id > ?", 0).Cached() {
+		t.Errorf("entry dropped by invalidating another table")
+	}
+	conn.InvalidateQueryCache()
+	if query("SELECT id FROM foo WHERE id > ?", 0).Cached() {
+		t.Errorf("entry not dropped by invalidating everything")
+	}
+
+	// results read while invalidating aren't cached
+	generation := conn.queryCache.currentGeneration()
+	conn.InvalidateQueryCache("bar")
+	conn.queryCache.put("stale", generation, nil, nil)
+	if _, ok := conn.queryCache.get("stale"); ok {
+		t.Errorf("stale results cached")
+	}
+
+	if _, err := OpenWithOptions(srv.URL, WithQueryCache(0, time.Minute)); err == nil {
+		t.Errorf("expected error for an empty cache, got nil")
+	}
+	if _, err := OpenWithOptions(srv.URL, WithQueryCache(1, 0)); err == nil {
+		t.Errorf("expected error for a zero ttl, got nil")
+	}
+}
+
+func TestReadTables(t *testing.T) {
+	for sql, want := range map[string][]string{
+		"SELECT * FROM foo": {"foo"},
+		"SELECT * FROM main.foo AS f, \"Bar\" b WHERE f.id = b.id":            {"foo", "bar"},
+		"SELECT * FROM foo LEFT JOIN bar ON foo.id = bar.id":                  {"foo", "bar"},
+		"SELECT * FROM foo f JOIN bar USING (id) JOIN baz":                    {"foo", "bar", "baz"},
+		"SELECT * FROM (SELECT id FROM foo) WHERE id IN (SELECT id FROM bar)": {"foo", "bar"},
+		"SELECT 1": nil,
+	} {
+		if got := readTables(sql); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", sql, got, want)
+		}
+	}
+}
+
+func TestWrittenTables(t *testing.T) {
+	for sql, want := range map[string][]string{
+		"INSERT INTO foo VALUES (1)":                           {"foo"},
+		"INSERT OR REPLACE INTO main.Foo VALUES (1)":           {"foo"},
+		"REPLACE INTO foo VALUES (1)":                          {"foo"},
+		"UPDATE OR IGNORE foo SET id = 1":                      {"foo"},
+		"DELETE FROM [foo] WHERE id = 1":                       {"foo"},
+		"DROP TABLE IF EXISTS foo":                             {"foo"},
+		"ALTER TABLE foo ADD COLUMN bar":                       {"foo"},
+		"WITH x AS (SELECT 1) INSERT INTO foo SELECT * FROM x": {"foo"},
+		"CREATE TABLE foo (id)":                                nil,
+		"DROP INDEX foo_id":                                    nil,
+		"WITH x AS (SELECT 1) SELECT * FROM x":                 nil,
+	} {
+		got, all := writtenTables(sql)
+		if all || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v (all %v), want %v", sql, got, all, want)
+		}
+	}
+	if _, all := writtenTables("UPSERT foo"); !all {
+		t.Errorf("unknown statement doesn't invalidate everything")
+	}
+}
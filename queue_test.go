@@ -0,0 +1,119 @@
+package gorqlite
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// queueServer mimics the queue of a rqlite node: writes get increasing
+// sequence numbers, and a flush (wait) reports the last one
+type queueServer struct {
+	mu     sync.Mutex
+	seq    int64
+	urls   []string
+	bodies []string
+	fail   string
+}
+
+func (qs *queueServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	qs.urls = append(qs.urls, r.URL.String())
+	qs.bodies = append(qs.bodies, string(body))
+
+	if string(body) != "[]" {
+		qs.seq++
+	}
+	if _, wait := r.URL.Query()["wait"]; wait && qs.fail != "" {
+		w.Write([]byte(`{"error":"` + qs.fail + `"}`))
+		return
+	}
+	w.Write([]byte(`{"results":[],"sequence_number":` + strconv.FormatInt(qs.seq, 10) + `}`))
+}
+
+func TestQueueAndWait(t *testing.T) {
+	qs := &queueServer{}
+	srv := httptest.NewServer(qs)
+	defer srv.Close()
+
+	conn, err := OpenWithOptions(srv.URL, WithClusterDiscovery(false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	t.Run("queue without waiting", func(t *testing.T) {
+		seq, err := conn.QueueOne("INSERT INTO foo VALUES (1)")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if seq != 1 {
+			t.Errorf("got sequence number %d, want 1", seq)
+		}
+		if got := qs.urls[len(qs.urls)-1]; got != "/db/execute?timings&level=weak&transaction&queue" {
+			t.Errorf("unexpected URL: %s", got)
+		}
+	})
+
+	t.Run("queue and wait", func(t *testing.T) {
+		seq, err := conn.QueueAndWaitContext(context.Background(), []string{"INSERT INTO foo VALUES (2)"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if seq != 2 {
+			t.Errorf("got sequence number %d, want 2", seq)
+		}
+		if got := qs.urls[len(qs.urls)-1]; got != "/db/execute?timings&level=weak&transaction&queue&wait" {
+			t.Errorf("unexpected URL: %s", got)
+		}
+	})
+
+	t.Run("flush", func(t *testing.T) {
+		seq, err := conn.Flush()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if seq != 2 {
+			t.Errorf("got sequence number %d, want 2", seq)
+		}
+		if got := qs.bodies[len(qs.bodies)-1]; got != "[]" {
+			t.Errorf("unexpected body: %s", got)
+		}
+	})
+
+	t.Run("wait for sequence", func(t *testing.T) {
+		seq, err := conn.QueueOne("INSERT INTO foo VALUES (3)")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := conn.WaitForSequence(context.Background(), seq); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("wait for a sequence never reached", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+		defer cancel()
+		if err := conn.WaitForSequence(ctx, 100); err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+
+	t.Run("failed flush", func(t *testing.T) {
+		qs.mu.Lock()
+		qs.fail = "table foo does not exist"
+		qs.mu.Unlock()
+
+		_, err := conn.QueueParameterizedAndWait([]ParameterizedStatement{{Query: "INSERT INTO foo VALUES (?)", Arguments: []interface{}{4}}})
+		if err == nil || err.Error() != "table foo does not exist" {
+			t.Errorf("expected the flush error, got %v", err)
+		}
+	})
+}
@@ -79,6 +79,9 @@ func (conn *Connection) RequestParameterizedContext(ctx context.Context, sqlStat
 
 	trace("%s: Request() for %d statements", conn.ID, len(sqlStatements))
 
+	ctx, span := conn.startSpan(ctx, "request", sqlStatements)
+	defer func() { span.End(err) }()
+
 	before := time.Now()
 	// if we get an error POSTing, that's a showstopper
 	response, err := conn.rqliteApiPost(ctx, api_REQUEST, sqlStatements)
@@ -102,18 +105,22 @@ func (conn *Connection) RequestParameterizedContext(ctx context.Context, sqlStat
 		results = append(results, errResult)
 		return results, err
 	}
+	conn.observeTiming(ctx, api_REQUEST, sections)
+
+	// reads rejected as stale get an error of their own
+	rs := conn.requestSettings(requestOptionsFromContext(ctx))
 
 	// if we got an error from the api, that's a showstopper
 	if errMsg, ok := sections["error"].(string); ok && errMsg != "" {
 		trace("%s: api ERROR: %s", conn.ID, errMsg)
 		var errResult RequestResult
-		errResult.Err = fmt.Errorf("%s", errMsg)
+		errResult.Err = checkStaleRead(fmt.Errorf("%s", errMsg), rs)
 		results = append(results, errResult)
 		return results, errResult.Err
 	}
 
 	// at this point, we have a "results" section and
-	// a "time" section.  we can ignore the latter.
+	// a "time" section, only observed.
 
 	resultsArray, ok := sections["results"].([]interface{})
 	if !ok {
@@ -137,7 +144,7 @@ func (conn *Connection) RequestParameterizedContext(ctx context.Context, sqlStat
 		_, ok := thisResult["error"]
 		if ok {
 			trace("%s: have an error on this result: %s", conn.ID, thisResult["error"].(string))
-			thisR.Err = errors.New(thisResult["error"].(string))
+			thisR.Err = checkStaleRead(errors.New(thisResult["error"].(string)), rs)
 			results = append(results, thisR)
 			errs = append(errs, thisR.Err)
 			continue
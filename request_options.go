@@ -0,0 +1,200 @@
+package gorqlite
+
+/*
+	this file contains the per-call request options, carried in the
+	context given to the *Context methods
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RequestOption overrides a setting of the Connection for the calls
+// made with a context returned by WithRequestOptions.
+type RequestOption func(opts *requestOptions)
+
+// requestOptions holds the per-call overrides, nil meaning that
+// the Connection setting applies
+type requestOptions struct {
+	consistencyLevel *consistencyLevel
+	freshness        *time.Duration
+	freshnessStrict  *bool
+	transaction      *bool
+	queue            *bool
+	queueWait        *bool
+	redirect         *bool
+	backupFormat     *backupFormat
+	timeout          time.Duration
+}
+
+type requestOptionsKey struct{}
+
+// WithRequestOptions returns a copy of ctx carrying the given request
+// options. Any call made with the returned context uses them instead
+// of the Connection settings, which are left untouched. This is safe
+// to use from several goroutines at once, unlike SetConsistencyLevel.
+//
+// Options already carried by ctx are kept, unless overridden.
+//
+//	ctx := gorqlite.WithRequestOptions(context.Background(),
+//		gorqlite.RequestConsistencyLevel(gorqlite.ConsistencyLevelLinearizable),
+//		gorqlite.RequestTimeout(time.Second),
+//	)
+//	qr, err := conn.QueryOneContext(ctx, "SELECT balance FROM accounts WHERE id = 1")
+func WithRequestOptions(ctx context.Context, opts ...RequestOption) context.Context {
+	ro := requestOptionsFromContext(ctx)
+	for _, opt := range opts {
+		opt(&ro)
+	}
+	return context.WithValue(ctx, requestOptionsKey{}, ro)
+}
+
+// requestOptionsFromContext returns a copy of the request options
+// carried by ctx, if any
+func requestOptionsFromContext(ctx context.Context) requestOptions {
+	ro, _ := ctx.Value(requestOptionsKey{}).(requestOptions)
+	return ro
+}
+
+// RequestConsistencyLevel sets the consistency level of the request.
+func RequestConsistencyLevel(level consistencyLevel) RequestOption {
+	return func(opts *requestOptions) {
+		opts.consistencyLevel = &level
+	}
+}
+
+// RequestFreshness bounds how stale a read at consistency level none
+// may be: the node answering must have heard from the leader within d.
+// It is ignored at the other levels. A read that can't meet the bound
+// fails with a *StaleReadError. Zero means no bound.
+func RequestFreshness(d time.Duration) RequestOption {
+	return func(opts *requestOptions) {
+		opts.freshness = &d
+	}
+}
+
+// RequestFreshnessStrict makes the freshness bound apply to the last
+// write applied by the node answering, instead of the last contact
+// with the leader. It only matters with RequestFreshness.
+func RequestFreshnessStrict(strict bool) RequestOption {
+	return func(opts *requestOptions) {
+		opts.freshnessStrict = &strict
+	}
+}
+
+// RequestTransaction sets whether the statements of the request are
+// executed within a transaction.
+func RequestTransaction(state bool) RequestOption {
+	return func(opts *requestOptions) {
+		opts.transaction = &state
+	}
+}
+
+// RequestQueue sets whether a write is queued. A queued write returns
+// a sequence number rather than results, so it should only be used with
+// the Queue* methods, which turn it on by themselves.
+func RequestQueue(state bool) RequestOption {
+	return func(opts *requestOptions) {
+		opts.queue = &state
+	}
+}
+
+// requestQueueWait makes a queued write wait for the queue to be flushed,
+// see QueueAndWait
+func requestQueueWait(state bool) RequestOption {
+	return func(opts *requestOptions) {
+		opts.queueWait = &state
+	}
+}
+
+// requestBackupFormat sets the format of a backup, see Backup
+func requestBackupFormat(format backupFormat) RequestOption {
+	return func(opts *requestOptions) {
+		opts.backupFormat = &format
+	}
+}
+
+// RequestRedirect makes a node that isn't the leader answer with a
+// redirect to the leader, instead of forwarding the request itself. The
+// redirect is followed with the same method, body and credentials,
+// whatever the CheckRedirect of the HTTP client.
+func RequestRedirect(state bool) RequestOption {
+	return func(opts *requestOptions) {
+		opts.redirect = &state
+	}
+}
+
+// RequestTimeout bounds the whole call, all peers and retries included.
+func RequestTimeout(timeout time.Duration) RequestOption {
+	return func(opts *requestOptions) {
+		opts.timeout = timeout
+	}
+}
+
+// validate checks the request options, since RequestOption cannot
+// report errors by itself
+func (ro requestOptions) validate() error {
+	if ro.consistencyLevel != nil {
+		if *ro.consistencyLevel < ConsistencyLevelNone || *ro.consistencyLevel > ConsistencyLevelStrong {
+			return fmt.Errorf("unknown consistency level: %d", *ro.consistencyLevel)
+		}
+	}
+	if ro.freshness != nil && *ro.freshness < 0 {
+		return fmt.Errorf("invalid freshness: %s", *ro.freshness)
+	}
+	if ro.timeout < 0 {
+		return errors.New("invalid request timeout: " + ro.timeout.String())
+	}
+	return nil
+}
+
+// requestSettings are the settings of a single request, once the
+// request options have been applied to the Connection settings
+type requestSettings struct {
+	consistencyLevel consistencyLevel
+	freshness        time.Duration
+	freshnessStrict  bool
+	transaction      bool
+	queue            bool
+	queueWait        bool
+	redirect         bool
+	backupFormat     backupFormat
+}
+
+// requestSettings applies the request options to the Connection settings
+func (conn *Connection) requestSettings(ro requestOptions) requestSettings {
+	rs := requestSettings{
+		consistencyLevel: conn.consistencyLevel,
+		freshness:        conn.freshness,
+		freshnessStrict:  conn.freshnessStrict,
+		transaction:      conn.wantsTransactions,
+	}
+	if ro.consistencyLevel != nil {
+		rs.consistencyLevel = *ro.consistencyLevel
+	}
+	if ro.freshness != nil {
+		rs.freshness = *ro.freshness
+	}
+	if ro.freshnessStrict != nil {
+		rs.freshnessStrict = *ro.freshnessStrict
+	}
+	if ro.transaction != nil {
+		rs.transaction = *ro.transaction
+	}
+	if ro.queue != nil {
+		rs.queue = *ro.queue
+	}
+	if ro.queueWait != nil {
+		rs.queueWait = *ro.queueWait
+	}
+	if ro.redirect != nil {
+		rs.redirect = *ro.redirect
+	}
+	if ro.backupFormat != nil {
+		rs.backupFormat = *ro.backupFormat
+	}
+	return rs
+}
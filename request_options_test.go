@@ -0,0 +1,205 @@
+package gorqlite
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAssembleURLWithRequestOptions(t *testing.T) {
+	conn := &Connection{}
+	if err := conn.initConnection("http://localhost:4001?level=weak"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		apiOp apiOperation
+		opts  []RequestOption
+		want  string
+	}{
+		{
+			name:  "connection settings",
+			apiOp: api_QUERY,
+			want:  "http://localhost:4001/db/query?timings&level=weak&transaction",
+		},
+		{
+			name:  "consistency level",
+			apiOp: api_QUERY,
+			opts:  []RequestOption{RequestConsistencyLevel(ConsistencyLevelLinearizable)},
+			want:  "http://localhost:4001/db/query?timings&level=linearizable&transaction",
+		},
+		{
+			name:  "freshness",
+			apiOp: api_QUERY,
+			opts:  []RequestOption{RequestConsistencyLevel(ConsistencyLevelNone), RequestFreshness(time.Second), RequestFreshnessStrict(true)},
+			want:  "http://localhost:4001/db/query?timings&level=none&freshness=1s&freshness_strict&transaction",
+		},
+		{
+			name:  "freshness ignored above none",
+			apiOp: api_QUERY,
+			opts:  []RequestOption{RequestFreshness(time.Second)},
+			want:  "http://localhost:4001/db/query?timings&level=weak&transaction",
+		},
+		{
+			name:  "no transaction",
+			apiOp: api_WRITE,
+			opts:  []RequestOption{RequestTransaction(false)},
+			want:  "http://localhost:4001/db/execute?timings&level=weak",
+		},
+		{
+			name:  "queue",
+			apiOp: api_WRITE,
+			opts:  []RequestOption{RequestQueue(true)},
+			want:  "http://localhost:4001/db/execute?timings&level=weak&transaction&queue",
+		},
+		{
+			name:  "queue ignored for queries",
+			apiOp: api_QUERY,
+			opts:  []RequestOption{RequestQueue(true)},
+			want:  "http://localhost:4001/db/query?timings&level=weak&transaction",
+		},
+		{
+			name:  "redirect",
+			apiOp: api_REQUEST,
+			opts:  []RequestOption{RequestRedirect(true)},
+			want:  "http://localhost:4001/db/request?timings&level=weak&transaction&redirect",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := WithRequestOptions(context.Background(), test.opts...)
+			rs := conn.requestSettings(requestOptionsFromContext(ctx))
+			got := conn.assembleURL(test.apiOp, "localhost:4001", rs)
+			if got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+
+	if conn.consistencyLevel != ConsistencyLevelWeak || !conn.wantsTransactions {
+		t.Errorf("connection settings were modified")
+	}
+}
+
+func TestWithRequestOptionsNesting(t *testing.T) {
+	ctx := WithRequestOptions(context.Background(), RequestConsistencyLevel(ConsistencyLevelNone), RequestTransaction(false))
+	ctx = WithRequestOptions(ctx, RequestConsistencyLevel(ConsistencyLevelStrong))
+
+	ro := requestOptionsFromContext(ctx)
+	if *ro.consistencyLevel != ConsistencyLevelStrong {
+		t.Errorf("got level %s, want strong", *ro.consistencyLevel)
+	}
+	if *ro.transaction {
+		t.Errorf("expected the transaction option to be kept")
+	}
+}
+
+func TestRequestOptionsInCalls(t *testing.T) {
+	urls := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("level") == "strong" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		urls <- r.URL.String()
+		w.Write([]byte(`{"results":[{}],"sequence_number":7}`))
+	}))
+	defer srv.Close()
+
+	conn, err := OpenWithOptions(srv.URL, WithClusterDiscovery(false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	t.Run("invalid option", func(t *testing.T) {
+		ctx := WithRequestOptions(context.Background(), RequestConsistencyLevel(100))
+		if _, err := conn.QueryContext(ctx, []string{"SELECT 1"}); err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		ctx := WithRequestOptions(context.Background(),
+			RequestConsistencyLevel(ConsistencyLevelStrong),
+			RequestTimeout(10*time.Millisecond),
+		)
+		_, err := conn.QueryContext(ctx, []string{"SELECT 1"})
+		if err == nil {
+			t.Errorf("expected error, got nil")
+		}
+		// the request may have timed out before reaching the server
+		select {
+		case <-urls:
+		case <-time.After(time.Second):
+		}
+	})
+
+	t.Run("queue", func(t *testing.T) {
+		seq, err := conn.QueueOne("INSERT INTO foo VALUES (1)")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if seq != 7 {
+			t.Errorf("got sequence number %d, want 7", seq)
+		}
+		if got := <-urls; got != "/db/execute?timings&level=weak&transaction&queue" {
+			t.Errorf("unexpected URL: %s", got)
+		}
+
+		// queueing must not leak into later writes
+		if _, err := conn.WriteOne("INSERT INTO foo VALUES (1)"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := <-urls; got != "/db/execute?timings&level=weak&transaction" {
+			t.Errorf("unexpected URL: %s", got)
+		}
+	})
+
+	t.Run("context error", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := conn.QueryContext(WithRequestOptions(ctx, RequestRedirect(true)), []string{"SELECT 1"})
+		if err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+}
+
+func TestRequestRedirect(t *testing.T) {
+	type received struct {
+		method, url, body, user, password string
+	}
+	got := make(chan received, 1)
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		user, password, _ := r.BasicAuth()
+		got <- received{r.Method, r.URL.String(), string(body), user, password}
+		w.Write([]byte(`{"results":[{"rows_affected":1}]}`))
+	}))
+	defer leader.Close()
+	follower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, leader.URL+r.URL.RequestURI(), http.StatusMovedPermanently)
+	}))
+	defer follower.Close()
+
+	connURL := strings.Replace(follower.URL, "http://", "http://mary:secret@", 1)
+	conn, err := OpenWithOptions(connURL, WithClusterDiscovery(false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := WithRequestOptions(context.Background(), RequestRedirect(true))
+	if _, err := conn.WriteOneContext(ctx, "INSERT INTO foo VALUES (1)"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	r := <-got
+	want := received{"POST", "/db/execute?timings&level=weak&transaction&redirect", `[["INSERT INTO foo VALUES (1)"]]`, "mary", "secret"}
+	if r != want {
+		t.Errorf("got %+v, want %+v", r, want)
+	}
+}
@@ -0,0 +1,203 @@
+package gorqlite
+
+/*
+	this file contains the introspection of the schema of the database:
+	its tables and views, their columns, indexes and foreign keys
+*/
+
+import (
+	"context"
+	"strings"
+)
+
+// Schema describes the tables and views of the database.
+type Schema struct {
+	// Tables are the tables and views, ordered by name. The internal
+	// sqlite_ tables are left out.
+	Tables []Table
+}
+
+// Table describes a table or a view.
+type Table struct {
+	Name string
+	// View tells whether this is a view rather than a table.
+	View bool
+	// SQL is the CREATE statement of the table or view.
+	SQL         string
+	Columns     []Column
+	Indexes     []Index
+	ForeignKeys []ForeignKey
+}
+
+// Column describes a column of a table or view.
+type Column struct {
+	Name string
+	// Type is the type declared for the column, possibly empty.
+	Type    string
+	NotNull bool
+	// Default is the SQL expression of the default value, if any.
+	Default NullString
+	// PrimaryKey is the position of the column in the primary key,
+	// starting at 1, or 0 if the column is not part of it.
+	PrimaryKey int
+}
+
+// Index describes an index of a table.
+type Index struct {
+	Name   string
+	Unique bool
+	// Origin tells how the index was created: "c" by CREATE INDEX, "u"
+	// by a UNIQUE constraint, "pk" by a PRIMARY KEY constraint.
+	Origin  string
+	Partial bool
+	// Columns are the indexed columns, in order, empty for expressions.
+	Columns []string
+	// SQL is the CREATE INDEX statement, empty for the indexes created
+	// by constraints.
+	SQL string
+}
+
+// ForeignKey describes a foreign key of a table.
+type ForeignKey struct {
+	// Table is the table referenced.
+	Table string
+	// From are the columns of the table holding the key.
+	From []string
+	// To are the columns referenced, empty when referencing the primary
+	// key of Table implicitly.
+	To       []string
+	OnUpdate string
+	OnDelete string
+	Match    string
+}
+
+// Table returns the table or view of that name, ignoring case as SQLite
+// does, or nil.
+func (s *Schema) Table(name string) *Table {
+	for i := range s.Tables {
+		if strings.EqualFold(s.Tables[i].Name, name) {
+			return &s.Tables[i]
+		}
+	}
+	return nil
+}
+
+// Column returns the column of that name, ignoring case as SQLite does,
+// or nil.
+func (t *Table) Column(name string) *Column {
+	for i := range t.Columns {
+		if strings.EqualFold(t.Columns[i].Name, name) {
+			return &t.Columns[i]
+		}
+	}
+	return nil
+}
+
+// schemaQueries read the schema, all at once for a consistent view of it
+var schemaQueries = []string{
+	`SELECT name, type, sql FROM sqlite_schema
+		WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite\_%' ESCAPE '\'
+		ORDER BY name`,
+	`SELECT m.name, p.name, p.type, p."notnull", p.dflt_value, p.pk
+		FROM sqlite_schema m JOIN pragma_table_info(m.name) p
+		WHERE m.type IN ('table', 'view') AND m.name NOT LIKE 'sqlite\_%' ESCAPE '\'
+		ORDER BY m.name, p.cid`,
+	`SELECT m.name, l.name, l."unique", l.origin, l.partial, i.name, coalesce(s.sql, '')
+		FROM sqlite_schema m JOIN pragma_index_list(m.name) l JOIN pragma_index_info(l.name) i
+		LEFT JOIN sqlite_schema s ON s.type = 'index' AND s.name = l.name
+		WHERE m.type = 'table' AND m.name NOT LIKE 'sqlite\_%' ESCAPE '\'
+		ORDER BY m.name, l.name, i.seqno`,
+	`SELECT m.name, f.id, f."table", f."from", f."to", f.on_update, f.on_delete, f.match
+		FROM sqlite_schema m JOIN pragma_foreign_key_list(m.name) f
+		WHERE m.type = 'table' AND m.name NOT LIKE 'sqlite\_%' ESCAPE '\'
+		ORDER BY m.name, f.id, f.seq`,
+}
+
+// Schema returns the schema of the database, read with a single request.
+func (conn *Connection) Schema(ctx context.Context) (*Schema, error) {
+	if conn.hasBeenClosed {
+		return nil, ErrClosed
+	}
+	trace("%s: Schema() called", conn.ID)
+
+	results, err := conn.QueryContext(ctx, schemaQueries)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := &Schema{}
+	byName := make(map[string]*Table)
+	tables := &results[0]
+	for tables.Next() {
+		var t Table
+		var kind string
+		if err := tables.Scan(&t.Name, &kind, &t.SQL); err != nil {
+			return nil, err
+		}
+		t.View = kind == "view"
+		schema.Tables = append(schema.Tables, t)
+	}
+	for i := range schema.Tables {
+		byName[schema.Tables[i].Name] = &schema.Tables[i]
+	}
+
+	columns := &results[1]
+	for columns.Next() {
+		var table string
+		var c Column
+		if err := columns.Scan(&table, &c.Name, &c.Type, &c.NotNull, &c.Default, &c.PrimaryKey); err != nil {
+			return nil, err
+		}
+		if t, ok := byName[table]; ok {
+			t.Columns = append(t.Columns, c)
+		}
+	}
+
+	indexes := &results[2]
+	for indexes.Next() {
+		var table, column string
+		var idx Index
+		if err := indexes.Scan(&table, &idx.Name, &idx.Unique, &idx.Origin, &idx.Partial, &column, &idx.SQL); err != nil {
+			return nil, err
+		}
+		t, ok := byName[table]
+		if !ok {
+			continue
+		}
+		// an index has a row per column
+		if n := len(t.Indexes); n == 0 || t.Indexes[n-1].Name != idx.Name {
+			t.Indexes = append(t.Indexes, idx)
+		}
+		if column != "" {
+			last := &t.Indexes[len(t.Indexes)-1]
+			last.Columns = append(last.Columns, column)
+		}
+	}
+
+	foreignKeys := &results[3]
+	lastID := -1
+	for foreignKeys.Next() {
+		var table, from, to string
+		var id int
+		var fk ForeignKey
+		if err := foreignKeys.Scan(&table, &id, &fk.Table, &from, &to, &fk.OnUpdate, &fk.OnDelete, &fk.Match); err != nil {
+			return nil, err
+		}
+		t, ok := byName[table]
+		if !ok {
+			continue
+		}
+		// a foreign key has a row per column
+		if len(t.ForeignKeys) == 0 || id != lastID {
+			t.ForeignKeys = append(t.ForeignKeys, fk)
+		}
+		lastID = id
+		last := &t.ForeignKeys[len(t.ForeignKeys)-1]
+		last.From = append(last.From, from)
+		if to != "" {
+			last.To = append(last.To, to)
+		}
+	}
+
+	return schema, nil
+}
@@ -0,0 +1,95 @@
+package gorqlite
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/db/query" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"results":[
+			{"columns":["name","type","sql"],"types":["text","text","text"],"values":[
+				["teams","table","CREATE TABLE teams (id INTEGER PRIMARY KEY, name TEXT UNIQUE)"],
+				["users","table","CREATE TABLE users (id INTEGER PRIMARY KEY, team_id INTEGER, email TEXT NOT NULL DEFAULT '')"],
+				["users_view","view","CREATE VIEW users_view AS SELECT id FROM users"]
+			]},
+			{"columns":["name","name","type","notnull","dflt_value","pk"],"types":["text","text","text","integer","text","integer"],"values":[
+				["teams","id","INTEGER",0,null,1],
+				["teams","name","TEXT",0,null,0],
+				["users","id","INTEGER",0,null,1],
+				["users","team_id","INTEGER",0,null,0],
+				["users","email","TEXT",1,"''",0],
+				["users_view","id","INTEGER",0,null,0]
+			]},
+			{"columns":["name","name","unique","origin","partial","name","coalesce(s.sql, '')"],"types":["text","text","integer","text","integer","text","text"],"values":[
+				["teams","sqlite_autoindex_teams_1",1,"u",0,"name",""],
+				["users","users_lower_email",0,"c",0,null,"CREATE INDEX users_lower_email ON users (lower(email))"],
+				["users","users_team_email",1,"c",1,"team_id","CREATE UNIQUE INDEX users_team_email ON users (team_id, email) WHERE team_id > 0"],
+				["users","users_team_email",1,"c",1,"email","CREATE UNIQUE INDEX users_team_email ON users (team_id, email) WHERE team_id > 0"]
+			]},
+			{"columns":["name","id","table","from","to","on_update","on_delete","match"],"types":["text","integer","text","text","text","text","text","text"],"values":[
+				["users",0,"teams","team_id",null,"NO ACTION","CASCADE","NONE"]
+			]}
+		]}`))
+	}))
+	defer srv.Close()
+
+	conn, err := OpenWithOptions(srv.URL, WithClusterDiscovery(false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	schema, err := conn.Schema(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(schema.Tables) != 3 || !schema.Tables[2].View || schema.Tables[0].View {
+		t.Fatalf("unexpected tables: %+v", schema.Tables)
+	}
+	if schema.Table("missing") != nil {
+		t.Errorf("found a missing table")
+	}
+
+	users := schema.Table("USERS")
+	if users == nil {
+		t.Fatalf("users table not found")
+	}
+	wantColumns := []Column{
+		{Name: "id", Type: "INTEGER", PrimaryKey: 1},
+		{Name: "team_id", Type: "INTEGER"},
+		{Name: "email", Type: "TEXT", NotNull: true, Default: NullString{Valid: true, String: "''"}},
+	}
+	if !reflect.DeepEqual(users.Columns, wantColumns) {
+		t.Errorf("got columns %+v\nwant %+v", users.Columns, wantColumns)
+	}
+	if c := users.Column("Email"); c == nil || c.Name != "email" {
+		t.Errorf("unexpected column: %+v", c)
+	}
+
+	if len(users.Indexes) != 2 {
+		t.Fatalf("unexpected indexes: %+v", users.Indexes)
+	}
+	if idx := users.Indexes[0]; idx.Unique || len(idx.Columns) != 0 || idx.SQL == "" {
+		t.Errorf("unexpected expression index: %+v", idx)
+	}
+	if idx := users.Indexes[1]; !idx.Unique || !idx.Partial || !reflect.DeepEqual(idx.Columns, []string{"team_id", "email"}) {
+		t.Errorf("unexpected index: %+v", idx)
+	}
+	if idx := schema.Table("teams").Indexes; len(idx) != 1 || idx[0].Origin != "u" || idx[0].SQL != "" {
+		t.Errorf("unexpected constraint index: %+v", idx)
+	}
+
+	wantForeignKeys := []ForeignKey{
+		{Table: "teams", From: []string{"team_id"}, OnUpdate: "NO ACTION", OnDelete: "CASCADE", Match: "NONE"},
+	}
+	if !reflect.DeepEqual(users.ForeignKeys, wantForeignKeys) {
+		t.Errorf("got foreign keys %+v\nwant %+v", users.ForeignKeys, wantForeignKeys)
+	}
+}
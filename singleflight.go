@@ -0,0 +1,115 @@
+package gorqlite
+
+/*
+	this file contains the single flights of queries, merging concurrent
+	identical queries into one request, opted in with WithSingleFlight
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// errQueryPanicked is the error of the callers waiting for a query whose
+// caller panicked
+var errQueryPanicked = errors.New("query panicked")
+
+// WithSingleFlight merges the concurrent calls of
+// QueryParameterizedContext, and of the calls made through it, such as
+// Query and QueryOne, that have the same statements, arguments and
+// request settings, the request options included: one request is sent
+// to rqlite, and each caller gets its own copy of the results, to read
+// at its own pace.
+//
+// A caller whose context is done stops waiting. If the context of the
+// caller sending the request is done first, the callers waiting send
+// their own.
+func WithSingleFlight() Option {
+	return func(conn *Connection) error {
+		conn.queryFlights = &queryFlights{flights: make(map[string]*queryFlight)}
+		return nil
+	}
+}
+
+// queryFlights is safe for concurrent use
+type queryFlights struct {
+	mu      sync.Mutex
+	flights map[string]*queryFlight
+	// joined, if set, is called when a caller joins a flight, for tests
+	joined func(key string)
+}
+
+// queryFlight is a request in flight, its results set once done is closed
+type queryFlight struct {
+	done    chan struct{}
+	results []QueryResult
+	err     error
+	// ctxErr is the error of the context of the request, if done
+	ctxErr error
+}
+
+// flightKey keys a flight by the key of its statements and the settings
+// of its request not in it, for the callers merged to share them all
+func flightKey(key string, rs requestSettings, ro requestOptions) string {
+	return fmt.Sprintf("%s\x00%t\x00%t\x00%s", key, rs.transaction, rs.redirect, ro.timeout)
+}
+
+// do runs fn, unless a call with the same key is in flight, whose
+// results are shared then. It returns copies of the results, and
+// whether they were shared. If fn panics, the callers waiting get
+// errQueryPanicked, and the panic goes on.
+func (g *queryFlights) do(ctx context.Context, key string, fn func(ctx context.Context) ([]QueryResult, error)) ([]QueryResult, bool, error) {
+	g.mu.Lock()
+	if f, ok := g.flights[key]; ok {
+		g.mu.Unlock()
+		if g.joined != nil {
+			g.joined(key)
+		}
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			return []QueryResult{{Err: ctx.Err()}}, false, ctx.Err()
+		}
+		if f.ctxErr != nil && ctx.Err() == nil {
+			results, err := fn(ctx)
+			return results, false, err
+		}
+		return copyResults(f.results), true, f.err
+	}
+	f := &queryFlight{done: make(chan struct{})}
+	g.flights[key] = f
+	g.mu.Unlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			f.results = []QueryResult{{Err: errQueryPanicked}}
+			f.err = errQueryPanicked
+			g.land(key, f)
+			panic(r)
+		}
+		g.land(key, f)
+	}()
+	f.results, f.err = fn(ctx)
+	f.ctxErr = ctx.Err()
+	return copyResults(f.results), false, f.err
+}
+
+// land ends the flight, letting the callers waiting read its results
+func (g *queryFlights) land(key string, f *queryFlight) {
+	g.mu.Lock()
+	delete(g.flights, key)
+	g.mu.Unlock()
+	close(f.done)
+}
+
+// copyResults copies results, their rows being shared but not read
+func copyResults(results []QueryResult) []QueryResult {
+	copied := make([]QueryResult, len(results))
+	for i, qr := range results {
+		qr.rowNumber = -1
+		copied[i] = qr
+	}
+	return copied
+}
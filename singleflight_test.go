@@ -0,0 +1,219 @@
+package gorqlite
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// joinedFlights makes the callers joining a flight of g signal it
+func joinedFlights(g *queryFlights) <-chan string {
+	joined := make(chan string, 100)
+	g.joined = func(key string) { joined <- key }
+	return joined
+}
+
+func TestWithSingleFlight(t *testing.T) {
+	var requests int32
+	arrived := make(chan struct{}, 10)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		arrived <- struct{}{}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		w.Write([]byte(`{"results":[{"columns":["id"],"types":["integer"],"values":[[1],[2]]}]}`))
+	}))
+	defer srv.Close()
+
+	conn, err := OpenWithOptions(srv.URL, WithClusterDiscovery(false), WithSingleFlight())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	joined := joinedFlights(conn.queryFlights)
+	statement := ParameterizedStatement{Query: "SELECT id FROM foo WHERE id > ?", Arguments: []interface{}{0}}
+
+	const callers = 20
+	var wg sync.WaitGroup
+	rows := make([]int, callers)
+	errs := make([]error, callers)
+	read := func(i int) {
+		defer wg.Done()
+		qr, err := conn.QueryOneParameterized(statement)
+		if err != nil {
+			errs[i] = err
+			return
+		}
+		for qr.Next() {
+			rows[i]++
+		}
+	}
+	wg.Add(1)
+	go read(0)
+	<-arrived
+	for i := 1; i < callers; i++ {
+		wg.Add(1)
+		go read(i)
+	}
+	// the others join the flight before it lands
+	for i := 1; i < callers; i++ {
+		<-joined
+	}
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("got %d requests, want 1", n)
+	}
+	for i := range rows {
+		if errs[i] != nil || rows[i] != 2 {
+			t.Errorf("caller %d: got %d rows and error %v, want 2 rows", i, rows[i], errs[i])
+		}
+	}
+}
+
+func TestSingleFlightCanceled(t *testing.T) {
+	var requests int32
+	arrived := make(chan struct{}, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			// the server sees the client go away once the body is read
+			io.Copy(io.Discard, r.Body)
+			arrived <- struct{}{}
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte(`{"results":[{"columns":["id"],"types":["integer"],"values":[[1]]}]}`))
+	}))
+	defer srv.Close()
+
+	conn, err := OpenWithOptions(srv.URL, WithClusterDiscovery(false), WithSingleFlight())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	joined := joinedFlights(conn.queryFlights)
+
+	// the caller sending the request gives up, the one waiting sends its own
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error)
+	go func() {
+		_, err := conn.QueryOneContext(ctx, "SELECT id FROM foo")
+		leader <- err
+	}()
+	<-arrived
+	follower := make(chan error)
+	go func() {
+		qr, err := conn.QueryOne("SELECT id FROM foo")
+		if err == nil && qr.NumRows() != 1 {
+			t.Errorf("got %d rows, want 1", qr.NumRows())
+		}
+		follower <- err
+	}()
+	<-joined
+	cancel()
+
+	if err := <-leader; err == nil {
+		t.Errorf("expected error for the canceled caller, got nil")
+	}
+	if err := <-follower; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("got %d requests, want 2", n)
+	}
+}
+
+func TestSingleFlightPanic(t *testing.T) {
+	g := &queryFlights{flights: make(map[string]*queryFlight)}
+	joined := joinedFlights(g)
+	release := make(chan struct{})
+	panicked := make(chan interface{})
+	go func() {
+		defer func() { panicked <- recover() }()
+		g.do(context.Background(), "k", func(ctx context.Context) ([]QueryResult, error) {
+			<-release
+			panic("boom")
+		})
+	}()
+	for {
+		g.mu.Lock()
+		_, ok := g.flights["k"]
+		g.mu.Unlock()
+		if ok {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	follower := make(chan error)
+	go func() {
+		results, shared, err := g.do(context.Background(), "k", func(ctx context.Context) ([]QueryResult, error) {
+			t.Errorf("the follower sent its own request")
+			return nil, nil
+		})
+		if !shared || len(results) != 1 || results[0].Err != errQueryPanicked {
+			t.Errorf("got results %+v, shared %t", results, shared)
+		}
+		follower <- err
+	}()
+	<-joined
+	close(release)
+
+	if r := <-panicked; r != "boom" {
+		t.Errorf("got panic %v, want boom", r)
+	}
+	if err := <-follower; err != errQueryPanicked {
+		t.Errorf("got error %v, want %v", err, errQueryPanicked)
+	}
+	if len(g.flights) != 0 {
+		t.Errorf("flight still in the air")
+	}
+}
+
+func TestSingleFlightRequestOptions(t *testing.T) {
+	var requests int32
+	arrived := make(chan struct{}, 2)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		arrived <- struct{}{}
+		<-release
+		w.Write([]byte(`{"results":[{"columns":["id"],"types":["integer"],"values":[[1]]}]}`))
+	}))
+	defer srv.Close()
+
+	conn, err := OpenWithOptions(srv.URL, WithClusterDiscovery(false), WithSingleFlight())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// callers with other timeouts don't share the request
+	errs := make(chan error, 2)
+	for _, timeout := range []time.Duration{time.Minute, 2 * time.Minute} {
+		ctx := WithRequestOptions(context.Background(), RequestTimeout(timeout))
+		go func() {
+			_, err := conn.QueryOneContext(ctx, "SELECT id FROM foo")
+			errs <- err
+		}()
+	}
+	<-arrived
+	<-arrived
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("got %d requests, want 2", n)
+	}
+}
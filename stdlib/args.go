@@ -0,0 +1,119 @@
+package stdlib
+
+/*
+	this file contains the arguments of the statements: their conversion
+	to the values sent to rqlite, and their binding to the statements,
+	by position or by name
+*/
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// these aren't checked automatically anywhere else, so we check them here
+var _ driver.ExecerContext = (*Conn)(nil)
+var _ driver.QueryerContext = (*Conn)(nil)
+var _ driver.NamedValueChecker = (*Conn)(nil)
+
+// CheckNamedValue converts an argument to a value sent to rqlite, once
+// for all the ways of executing a statement. Valuers are asked for their
+// value, and the values are those of driver.DefaultParameterConverter,
+// except that times are sent as RFC 3339 text in UTC, which SQLite date
+// functions understand, booleans as the integers 1 and 0, and byte
+// slices as arrays of their bytes, which rqlite binds as blobs, JSON
+// encoding them as base64 text otherwise.
+func (c *Conn) CheckNamedValue(nv *driver.NamedValue) error {
+	v, err := driver.DefaultParameterConverter.ConvertValue(nv.Value)
+	if err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case time.Time:
+		nv.Value = v.UTC().Format(time.RFC3339Nano)
+	case bool:
+		if v {
+			nv.Value = int64(1)
+		} else {
+			nv.Value = int64(0)
+		}
+	case []byte:
+		bytes := make([]int, len(v))
+		for i, b := range v {
+			bytes[i] = int(b)
+		}
+		nv.Value = bytes
+	default:
+		nv.Value = v
+	}
+	return nil
+}
+
+// statements returns the statements to send with their arguments, the
+// statements of a batch taking theirs in turn. The arguments are either
+// all positional, or all named and then sent by name.
+func (p *parsedStmt) statements(args []driver.NamedValue) ([]gorqlite.ParameterizedStatement, error) {
+	parts := p.parts
+	if parts == nil {
+		parts = []*parsedStmt{p}
+	}
+	statements := make([]gorqlite.ParameterizedStatement, len(parts))
+
+	named := 0
+	for _, arg := range args {
+		if arg.Name != "" {
+			named++
+		}
+	}
+	if named == 0 {
+		if len(args) != p.numInput {
+			return nil, fmt.Errorf("rqlite: statement %q takes %d arguments, got %d", p.query, p.numInput, len(args))
+		}
+		positional := make([]interface{}, len(args))
+		for _, arg := range args {
+			positional[arg.Ordinal-1] = arg.Value
+		}
+		for i, part := range parts {
+			n := part.numInput
+			statements[i] = gorqlite.ParameterizedStatement{Query: part.query, Arguments: positional[:n:n]}
+			positional = positional[n:]
+		}
+		return statements, nil
+	}
+	if named < len(args) {
+		return nil, fmt.Errorf("rqlite: statement %q got both named and positional arguments", p.query)
+	}
+
+	byName := make(map[string]interface{}, len(args))
+	for _, arg := range args {
+		byName[arg.Name] = arg.Value
+	}
+	for i, part := range parts {
+		values := make(map[string]interface{})
+		for _, name := range part.names {
+			if v, ok := byName[name]; ok && name != "" {
+				values[name] = v
+			}
+		}
+		statements[i] = gorqlite.ParameterizedStatement{Query: part.query, Arguments: []interface{}{values}}
+	}
+	for name := range byName {
+		if !p.hasName(name) {
+			return nil, fmt.Errorf("rqlite: statement %q has no parameter named %q", p.query, name)
+		}
+	}
+	return statements, nil
+}
+
+// hasName tells whether the statement has the named parameter
+func (p *parsedStmt) hasName(name string) bool {
+	for _, n := range p.names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
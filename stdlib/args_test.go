@@ -0,0 +1,106 @@
+package stdlib
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+)
+
+type celsius float64
+
+func (c celsius) Value() (driver.Value, error) {
+	return float64(c), nil
+}
+
+func TestCheckNamedValue(t *testing.T) {
+	at := time.Date(2424, 1, 2, 17, 0, 0, 500, time.FixedZone("", 3600))
+	tests := []struct {
+		in   interface{}
+		want driver.Value
+	}{
+		{at, "2424-01-02T16:00:00.0000005Z"},
+		{true, int64(1)},
+		{false, int64(0)},
+		{int32(3), int64(3)},
+		{[]byte("ab"), []int{'a', 'b'}},
+		{[]byte{}, []int{}},
+		{celsius(21.5), 21.5},
+		{sql.NullString{}, nil},
+		{nil, nil},
+	}
+	c := &Conn{}
+	for _, test := range tests {
+		nv := driver.NamedValue{Ordinal: 1, Value: test.in}
+		if err := c.CheckNamedValue(&nv); err != nil {
+			t.Errorf("%#v: unexpected error: %v", test.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(nv.Value, test.want) {
+			t.Errorf("%#v: got %#v, want %#v", test.in, nv.Value, test.want)
+		}
+	}
+	if err := c.CheckNamedValue(&driver.NamedValue{Value: struct{}{}}); err == nil {
+		t.Errorf("expected error for a struct, got nil")
+	}
+}
+
+func TestArguments(t *testing.T) {
+	var statements [][]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		statements = nil
+		json.NewDecoder(r.Body).Decode(&statements)
+		switch r.URL.Path {
+		case "/db/execute":
+			w.Write([]byte(`{"results":[{"rows_affected":1},{"rows_affected":1}]}`))
+		case "/db/query":
+			w.Write([]byte(`{"results":[{"columns":["id"],"types":["integer"],"values":[[1]]}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	db := sql.OpenDB(NewConnector(srv.URL, gorqlite.WithClusterDiscovery(false)))
+	defer db.Close()
+
+	if _, err := db.Exec("UPDATE t SET a = ?, b = ?, c = ?", true, time.Unix(0, 0), []byte{0, 255}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := [][]interface{}{{"UPDATE t SET a = ?, b = ?, c = ?", 1.0, "1970-01-01T00:00:00Z", []interface{}{0.0, 255.0}}}
+	if !reflect.DeepEqual(statements, want) {
+		t.Errorf("got %v, want %v", statements, want)
+	}
+
+	if _, err := db.Exec("INSERT INTO t VALUES (:a); UPDATE u SET b = :b WHERE a = :a", sql.Named("a", 1), sql.Named("b", "x")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want = [][]interface{}{
+		{"INSERT INTO t VALUES (:a)", map[string]interface{}{"a": 1.0}},
+		{"UPDATE u SET b = :b WHERE a = :a", map[string]interface{}{"a": 1.0, "b": "x"}},
+	}
+	if !reflect.DeepEqual(statements, want) {
+		t.Errorf("got %v, want %v", statements, want)
+	}
+
+	var id int64
+	if err := db.QueryRow("SELECT id FROM t WHERE a = $a", sql.Named("a", 2)).Scan(&id); err != nil || id != 1 {
+		t.Errorf("got %d, %v", id, err)
+	}
+
+	for _, args := range [][]interface{}{
+		{1, 2},
+		{sql.Named("a", 1), 2},
+		{sql.Named("c", 1)},
+	} {
+		if _, err := db.Exec("SELECT :a", args...); err == nil {
+			t.Errorf("%v: expected error, got nil", args)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package stdlib
+
+/*
+	this file contains the column type metadata of Rows, read from the
+	types declared for the columns, as reported by rqlite
+*/
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rqlite/gorqlite/internal/sqltype"
+)
+
+// these aren't checked automatically anywhere else, so we check them here
+var _ driver.RowsColumnTypeDatabaseTypeName = (*Rows)(nil)
+var _ driver.RowsColumnTypeScanType = (*Rows)(nil)
+var _ driver.RowsColumnTypeNullable = (*Rows)(nil)
+var _ driver.RowsColumnTypeLength = (*Rows)(nil)
+
+var (
+	scanTypeInt64     = reflect.TypeOf(int64(0))
+	scanTypeString    = reflect.TypeOf("")
+	scanTypeFloat64   = reflect.TypeOf(float64(0))
+	scanTypeTime      = reflect.TypeOf(time.Time{})
+	scanTypeInterface = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+// columnType returns the declared type of the column at index, empty
+// for expressions and when unknown
+func (r *Rows) columnType(index int) string {
+	types := r.QueryResult.Types()
+	if index < 0 || index >= len(types) {
+		return ""
+	}
+	return types[index]
+}
+
+// ColumnTypeDatabaseTypeName returns the type declared for the column,
+// in upper case and without its size, such as "INTEGER" or "VARCHAR". It
+// is empty for expressions.
+func (r *Rows) ColumnTypeDatabaseTypeName(index int) string {
+	return sqltype.Name(r.columnType(index))
+}
+
+// ColumnTypeScanType returns the type of the values of the column,
+// following the affinity of its declared type: int64, string, float64 or
+// time.Time. Columns without a definite type, such as expressions, blob
+// and numeric columns, hold whatever JSON values rqlite sends, and
+// interface{} is returned for them.
+func (r *Rows) ColumnTypeScanType(index int) reflect.Type {
+	declared := r.columnType(index)
+	if sqltype.IsTime(declared) {
+		return scanTypeTime
+	}
+	switch sqltype.AffinityOf(declared) {
+	case sqltype.Integer:
+		return scanTypeInt64
+	case sqltype.Text:
+		return scanTypeString
+	case sqltype.Real:
+		return scanTypeFloat64
+	}
+	return scanTypeInterface
+}
+
+// ColumnTypeNullable never knows whether the column may be NULL, as
+// rqlite does not report the constraints of the columns of a result.
+func (r *Rows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	return false, false
+}
+
+// ColumnTypeLength returns the size declared for character columns, such
+// as 255 for VARCHAR(255), and math.MaxInt64 for text and blob columns
+// without a size. Note that SQLite does not enforce sizes.
+func (r *Rows) ColumnTypeLength(index int) (length int64, ok bool) {
+	declared := r.columnType(index)
+	switch sqltype.AffinityOf(declared) {
+	case sqltype.Text:
+		if size, ok := typeSize(declared); ok {
+			return size, true
+		}
+		return math.MaxInt64, true
+	case sqltype.Blob:
+		if declared != "" {
+			return math.MaxInt64, true
+		}
+	}
+	return 0, false
+}
+
+// typeSize returns the first number between the parentheses of a
+// declared type
+func typeSize(declared string) (int64, bool) {
+	start := strings.IndexByte(declared, '(')
+	end := strings.IndexByte(declared, ')')
+	if start < 0 || end < start {
+		return 0, false
+	}
+	size := strings.TrimSpace(strings.SplitN(declared[start+1:end], ",", 2)[0])
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// convertValue converts the JSON value of a column to its scan type: the
+// numbers of integer columns, decoded as float64, are made int64, and
+// the values of date and datetime columns, whatever the case of their
+// declared type, time.Time
+func convertValue(declared string, v interface{}) (driver.Value, error) {
+	if sqltype.IsTime(declared) {
+		switch v := v.(type) {
+		case string:
+			return parseTime(v)
+		case float64:
+			return time.Unix(int64(v), 0), nil
+		}
+		return v, nil
+	}
+	if sqltype.AffinityOf(declared) == sqltype.Integer {
+		if f, ok := v.(float64); ok && f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+			return int64(f), nil
+		}
+	}
+	return v, nil
+}
+
+// parseTime parses the time formats gorqlite reads from date and
+// datetime columns
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02 15:04:05", s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time: %q", s)
+	}
+	return t, nil
+}
@@ -0,0 +1,116 @@
+package stdlib
+
+import (
+	"database/sql"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rqlite/gorqlite"
+)
+
+func TestColumnTypes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results":[{
+			"columns":["id","name","code","wallet","payload","ts","total","flag"],
+			"types":["integer","varchar(255)","CHAR( 3 )","real","blob","datetime","","boolean"],
+			"values":[[1,"Picard","NCC",1.5,"AQI=","2424-01-02 17:00:00",2.5,1]]
+		}]}`))
+	}))
+	defer srv.Close()
+
+	db := sql.OpenDB(NewConnector(srv.URL, gorqlite.WithClusterDiscovery(false)))
+	defer db.Close()
+
+	rows, err := db.Query("SELECT * FROM foo")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer rows.Close()
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		scanType reflect.Type
+		length   int64
+		hasLen   bool
+	}{
+		{"INTEGER", scanTypeInt64, 0, false},
+		{"VARCHAR", scanTypeString, 255, true},
+		{"CHAR", scanTypeString, 3, true},
+		{"REAL", scanTypeFloat64, 0, false},
+		{"BLOB", scanTypeInterface, math.MaxInt64, true},
+		{"DATETIME", scanTypeTime, 0, false},
+		{"", scanTypeInterface, 0, false},
+		{"BOOLEAN", scanTypeInterface, 0, false},
+	}
+	for i, test := range tests {
+		ct := columnTypes[i]
+		if ct.DatabaseTypeName() != test.name {
+			t.Errorf("%s: got type name %q, want %q", ct.Name(), ct.DatabaseTypeName(), test.name)
+		}
+		if ct.ScanType() != test.scanType {
+			t.Errorf("%s: got scan type %v, want %v", ct.Name(), ct.ScanType(), test.scanType)
+		}
+		if length, ok := ct.Length(); length != test.length || ok != test.hasLen {
+			t.Errorf("%s: got length %d %t, want %d %t", ct.Name(), length, ok, test.length, test.hasLen)
+		}
+		if _, ok := ct.Nullable(); ok {
+			t.Errorf("%s: nullability reported as known", ct.Name())
+		}
+	}
+
+	if !rows.Next() {
+		t.Fatalf("no row: %v", rows.Err())
+	}
+	var id, ts, total interface{}
+	var name, code, payload, flag string
+	var wallet float64
+	if err := rows.Scan(&id, &name, &code, &wallet, &payload, &ts, &total, &flag); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != int64(1) {
+		t.Errorf("got id %#v, want int64(1)", id)
+	}
+	if _, ok := ts.(time.Time); !ok {
+		t.Errorf("got ts %#v, want a time.Time", ts)
+	}
+	if total != 2.5 {
+		t.Errorf("got total %#v, want 2.5", total)
+	}
+}
+
+func TestUpperCaseTimeColumns(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results":[{
+			"columns":["created","day","seen"],
+			"types":["DATETIME","Date","DATETIME"],
+			"values":[["2424-01-02 17:00:00","2424-01-02",null]]
+		}]}`))
+	}))
+	defer srv.Close()
+
+	db := sql.OpenDB(NewConnector(srv.URL, gorqlite.WithClusterDiscovery(false)))
+	defer db.Close()
+
+	var created, day time.Time
+	var seen sql.NullTime
+	if err := db.QueryRow("SELECT * FROM foo").Scan(&created, &day, &seen); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := time.Date(2424, 1, 2, 17, 0, 0, 0, time.UTC); !created.Equal(want) {
+		t.Errorf("got created %v, want %v", created, want)
+	}
+	if want := time.Date(2424, 1, 2, 0, 0, 0, 0, time.UTC); !day.Equal(want) {
+		t.Errorf("got day %v, want %v", day, want)
+	}
+	if seen.Valid {
+		t.Errorf("got seen %v, want NULL", seen)
+	}
+}
@@ -0,0 +1,83 @@
+package stdlib
+
+/*
+	this file contains the Connector, opening gorqlite connections
+	configured by options for database/sql
+*/
+
+import (
+	"context"
+	"database/sql/driver"
+
+	"github.com/rqlite/gorqlite"
+)
+
+// these aren't checked automatically anywhere else, so we check them here
+var _ driver.DriverContext = (*Driver)(nil)
+var _ driver.Connector = (*Connector)(nil)
+var _ driver.Pinger = (*Conn)(nil)
+var _ driver.Validator = (*Conn)(nil)
+var _ driver.SessionResetter = (*Conn)(nil)
+
+// Connector opens connections to rqlite, configured by a connection URL
+// and options, for sql.OpenDB:
+//
+//	db := sql.OpenDB(stdlib.NewConnector("https://localhost:4001?level=strong",
+//		gorqlite.WithHTTPClient(client),
+//		gorqlite.WithRetry(3, 100*time.Millisecond),
+//	))
+type Connector struct {
+	connURL string
+	opts    []gorqlite.Option
+}
+
+// NewConnector returns a Connector opening connections to connURL, with
+// the options given, as gorqlite.OpenWithOptions does.
+func NewConnector(connURL string, opts ...gorqlite.Option) *Connector {
+	return &Connector{connURL: connURL, opts: opts}
+}
+
+// Connect opens a connection, the discovery of the cluster being bounded
+// by ctx.
+func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := gorqlite.OpenWithOptionsContext(ctx, c.connURL, c.opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{Connection: conn}, nil
+}
+
+// Driver returns the rqlite driver.
+func (c *Connector) Driver() driver.Driver {
+	return &Driver{}
+}
+
+// OpenConnector returns a Connector opening connections to the
+// connection URL name, with gorqlite.DefaultHTTPClient, as Open does.
+func (d *Driver) OpenConnector(name string) (driver.Connector, error) {
+	return NewConnector(name, gorqlite.WithHTTPClient(gorqlite.DefaultHTTPClient)), nil
+}
+
+// Ping checks that a node of the cluster is ready to serve requests,
+// see gorqlite.Connection.Ready.
+func (c *Conn) Ping(ctx context.Context) error {
+	if c.closed {
+		return driver.ErrBadConn
+	}
+	return c.Connection.ReadyContext(ctx)
+}
+
+// IsValid tells whether the connection may be reused, that is whether
+// it is still open.
+func (c *Conn) IsValid() bool {
+	return !c.closed
+}
+
+// ResetSession is called before reusing the connection. There is no
+// session to reset, rqlite being stateless.
+func (c *Conn) ResetSession(ctx context.Context) error {
+	if c.closed {
+		return driver.ErrBadConn
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package stdlib
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/rqlite/gorqlite"
+)
+
+func TestConnector(t *testing.T) {
+	var ready int32 = 1
+	var writes int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/status":
+			w.Write([]byte(`{"store":{"leader":{"node_id":"1","addr":"localhost:4002"}}}`))
+		case "/nodes":
+			w.Write([]byte(`{"1":{"api_addr":"http://` + r.Host + `","reachable":true,"leader":true}}`))
+		case "/readyz":
+			if atomic.LoadInt32(&ready) == 0 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("[+]node ok"))
+		case "/db/execute":
+			atomic.AddInt32(&writes, 1)
+			w.Write([]byte(`{"results":[{"rows_affected":1}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	db := sql.OpenDB(NewConnector(srv.URL, gorqlite.WithClusterDiscovery(false)))
+	defer db.Close()
+
+	if err := db.PingContext(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	atomic.StoreInt32(&ready, 0)
+	if err := db.Ping(); err == nil {
+		t.Errorf("expected error from a node not ready, got nil")
+	}
+	atomic.StoreInt32(&ready, 1)
+
+	if _, err := db.Exec("INSERT INTO foo VALUES (?)", 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if atomic.LoadInt32(&writes) != 1 {
+		t.Errorf("got %d writes, want 1", writes)
+	}
+	if _, err := db.Exec("INSERT INTO foo VALUES (?)", 1, 2); err == nil {
+		t.Errorf("expected error for too many arguments, got nil")
+	}
+
+	// the cluster is discovered within the context of Connect
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewConnector(srv.URL).Connect(ctx); err == nil {
+		t.Errorf("expected error with a canceled context, got nil")
+	}
+
+	connector, err := (&Driver{}).OpenConnector(srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	conn, err := connector.Connect(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c := conn.(*Conn)
+	if !c.IsValid() || c.ResetSession(context.Background()) != nil {
+		t.Errorf("open connection not valid")
+	}
+	c.Close()
+	if c.IsValid() || c.ResetSession(context.Background()) != driver.ErrBadConn || c.Ping(context.Background()) != driver.ErrBadConn {
+		t.Errorf("closed connection still valid")
+	}
+}
+
+type countingTransport struct {
+	requests int32
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.requests, 1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestDriverDefaultHTTPClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[+]node ok"))
+	}))
+	defer srv.Close()
+
+	transport := &countingTransport{}
+	saved := gorqlite.DefaultHTTPClient
+	gorqlite.DefaultHTTPClient = &http.Client{Transport: transport}
+	defer func() { gorqlite.DefaultHTTPClient = saved }()
+
+	name := srv.URL + "?disableClusterDiscovery=true"
+	conn, err := (&Driver{}).Open(name)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.(*Conn).Ping(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	connector, err := (&Driver{}).OpenConnector(name)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	if err := db.Ping(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := atomic.LoadInt32(&transport.requests); n != 2 {
+		t.Errorf("got %d requests through gorqlite.DefaultHTTPClient, want 2", n)
+	}
+}
@@ -17,23 +17,29 @@ func init() {
 
 type Driver struct{}
 
+// Open opens a connection to the connection URL name, with
+// gorqlite.DefaultHTTPClient, as gorqlite.Open does.
 func (d *Driver) Open(name string) (driver.Conn, error) {
-	conn, err := gorqlite.Open(name)
-	if err != nil {
-		return nil, err
-	}
-	return &Conn{conn}, nil
+	return NewConnector(name, gorqlite.WithHTTPClient(gorqlite.DefaultHTTPClient)).Connect(context.Background())
 }
 
 type Conn struct {
 	*gorqlite.Connection
+
+	// stmts are the statements prepared last, parsed
+	stmts  *stmtCache
+	closed bool
 }
 
+// Prepare returns a statement, which is sent along with its arguments
+// when executed, since rqlite has no prepared statements. Its
+// parameters are counted, for database/sql to check the arguments.
 func (c *Conn) Prepare(query string) (driver.Stmt, error) {
-	return &Stmt{Stmt: query, Conn: c}, nil
+	return &Stmt{Stmt: query, Conn: c, parsed: c.parse(query)}, nil
 }
 
 func (c *Conn) Close() error {
+	c.closed = true
 	c.Connection.Close()
 	return nil
 }
@@ -57,6 +63,8 @@ func (tx *Tx) Rollback() error {
 type Stmt struct {
 	Stmt string
 	Conn *Conn
+
+	parsed *parsedStmt
 }
 
 // these aren't checked automatically anywhere else, so we check them here
@@ -67,66 +75,134 @@ func (s *Stmt) Close() error {
 	return nil
 }
 
+// NumInput returns the number of parameters of the statement, or -1
+// if unknown.
 func (s *Stmt) NumInput() int {
-	return -1
+	if s.parsed == nil {
+		return -1
+	}
+	return s.parsed.numInput
 }
 
 func (s *Stmt) Exec(args []driver.Value) (driver.Result, error) {
-	a := make([]interface{}, len(args))
-	for i, v := range args {
-		a[i] = v
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+// ExecContext executes the statement, see Conn.ExecContext.
+func (s *Stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.Conn.exec(ctx, s.parsedStmt(), args)
+}
+
+func (s *Stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+// QueryContext runs the query, see Conn.QueryContext.
+func (s *Stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.Conn.query(ctx, s.parsedStmt(), args)
+}
+
+// parsedStmt returns the statement parsed, parsing it if it wasn't
+// prepared
+func (s *Stmt) parsedStmt() *parsedStmt {
+	if s.parsed == nil {
+		return parseStmt(s.Stmt)
 	}
-	stmt := gorqlite.ParameterizedStatement{Query: s.Stmt, Arguments: a}
-	wr, err := s.Conn.WriteOneParameterized(stmt)
-	if err != nil {
-		return &Result{wr}, err
+	return s.parsed
+}
+
+// ExecContext executes the statement, or the statements of a batch
+// separated by semicolons in a single request, each taking its own
+// arguments in turn. The result of a batch has the rows affected by all
+// its statements, and the ID inserted last.
+func (c *Conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.exec(ctx, c.parse(query), args)
+}
+
+// QueryContext runs the query, or the statements of a batch separated by
+// semicolons in a single request to the unified endpoint, each taking
+// its own arguments in turn. Each statement of a batch has its result
+// set, empty for writes, walked with NextResultSet.
+func (c *Conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.query(ctx, c.parse(query), args)
+}
+
+// parse returns the statement parsed, from the statements parsed last
+func (c *Conn) parse(query string) *parsedStmt {
+	if c.stmts == nil {
+		c.stmts = newStmtCache(stmtCacheSize)
 	}
-	return &Result{wr}, nil
+	return c.stmts.get(query)
 }
 
-func (s *Stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
-	a := make([]interface{}, len(args))
-	for _, v := range args {
-		if v.Name != "" {
-			return nil, fmt.Errorf("rqlite: driver does not support named parameters, but got one with name %q in statement %q", v.Name, s.Stmt)
+func (c *Conn) exec(ctx context.Context, p *parsedStmt, args []driver.NamedValue) (driver.Result, error) {
+	statements, err := p.statements(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(statements) == 1 {
+		wr, err := c.WriteOneParameterizedContext(ctx, statements[0])
+		if err != nil {
+			return &Result{wr}, err
 		}
-		a[v.Ordinal-1] = v.Value
+		return &Result{wr}, nil
 	}
-	stmt := gorqlite.ParameterizedStatement{Query: s.Stmt, Arguments: a}
-	wr, err := s.Conn.WriteOneParameterizedContext(ctx, stmt)
-	if err != nil {
-		return &Result{wr}, err
+
+	wrs, err := c.WriteParameterizedContext(ctx, statements)
+	var batch gorqlite.WriteResult
+	for _, wr := range wrs {
+		batch.Timing += wr.Timing
+		batch.RowsAffected += wr.RowsAffected
+		if wr.LastInsertID != 0 {
+			batch.LastInsertID = wr.LastInsertID
+		}
 	}
-	return &Result{wr}, nil
+	batch.Err = err
+	return &Result{batch}, err
 }
 
-func (s *Stmt) Query(args []driver.Value) (driver.Rows, error) {
-	a := make([]interface{}, len(args))
-	for i, v := range args {
-		a[i] = v
-	}
-	stmt := gorqlite.ParameterizedStatement{Query: s.Stmt, Arguments: a}
-	qr, err := s.Conn.QueryOneParameterized(stmt)
+func (c *Conn) query(ctx context.Context, p *parsedStmt, args []driver.NamedValue) (driver.Rows, error) {
+	statements, err := p.statements(args)
 	if err != nil {
-		return &Rows{qr}, err
+		return nil, err
+	}
+	if len(statements) == 1 {
+		qr, err := c.QueryOneParameterizedContext(ctx, statements[0])
+		if err != nil {
+			return &Rows{QueryResult: qr}, err
+		}
+		return &Rows{QueryResult: qr}, nil
 	}
-	return &Rows{qr}, nil
-}
 
-func (s *Stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
-	a := make([]interface{}, len(args))
-	for _, v := range args {
-		if v.Name != "" {
-			return nil, fmt.Errorf("rqlite: driver does not support named parameters, but got one with name %q in statement %q", v.Name, s.Stmt)
+	rrs, err := c.RequestParameterizedContext(ctx, statements)
+	results := make([]gorqlite.QueryResult, len(rrs))
+	for i, rr := range rrs {
+		switch {
+		case rr.Query != nil:
+			results[i] = *rr.Query
+		case rr.Write != nil:
+			results[i].Err = rr.Write.Err
+		default:
+			results[i].Err = rr.Err
 		}
-		a[v.Ordinal-1] = v.Value
 	}
-	stmt := gorqlite.ParameterizedStatement{Query: s.Stmt, Arguments: a}
-	qr, err := s.Conn.QueryOneParameterizedContext(ctx, stmt)
+	rows := &Rows{}
+	if len(results) > 0 {
+		rows.QueryResult, rows.next = results[0], results[1:]
+	}
 	if err != nil {
-		return &Rows{qr}, err
+		return rows, err
+	}
+	return rows, nil
+}
+
+// namedValues gives their ordinals to the arguments of Exec and Query
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
 	}
-	return &Rows{qr}, nil
+	return named
 }
 
 type Result struct {
@@ -143,8 +219,14 @@ func (r *Result) RowsAffected() (int64, error) {
 
 type Rows struct {
 	gorqlite.QueryResult
+
+	// next are the result sets of the statements following in a batch
+	next []gorqlite.QueryResult
 }
 
+// these aren't checked automatically anywhere else, so we check them here
+var _ driver.RowsNextResultSet = (*Rows)(nil)
+
 func (r *Rows) Columns() []string {
 	return r.QueryResult.Columns()
 }
@@ -165,7 +247,24 @@ func (r *Rows) Next(dest []driver.Value) error {
 		return err
 	}
 	for i, v := range slice {
-		dest[i] = v
+		if dest[i], err = convertValue(r.columnType(i), v); err != nil {
+			return fmt.Errorf("column %d: %w", i, err)
+		}
 	}
 	return nil
 }
+
+// HasNextResultSet tells whether a statement of the batch follows.
+func (r *Rows) HasNextResultSet() bool {
+	return len(r.next) > 0
+}
+
+// NextResultSet moves to the result set of the next statement of the
+// batch, io.EOF if there is none, or the error of that statement.
+func (r *Rows) NextResultSet() error {
+	if len(r.next) == 0 {
+		return io.EOF
+	}
+	r.QueryResult, r.next = r.next[0], r.next[1:]
+	return r.Err
+}
@@ -0,0 +1,113 @@
+package stdlib
+
+/*
+	this file contains the parsing of the prepared statements, and the
+	cache of the statements parsed by a connection
+*/
+
+import (
+	"container/list"
+	"strconv"
+
+	"github.com/rqlite/gorqlite/internal/sqltok"
+)
+
+// stmtCacheSize is how many statements a connection keeps parsed
+const stmtCacheSize = 128
+
+// parsedStmt is a statement parsed by Prepare
+type parsedStmt struct {
+	query string
+	// numInput is the number of parameters, as SQLite counts them: the
+	// highest index, with ? taking the index after the highest so far,
+	// and a named parameter too when first seen
+	numInput int
+	// names are the names of the named parameters, without their prefix,
+	// by index starting at 0, empty for the others
+	names []string
+	// parts are the statements of a batch, each taking its own
+	// parameters in turn, nil for a single statement
+	parts []*parsedStmt
+}
+
+// parseStmt finds the parameters of a statement, leaving out the
+// question marks and colons of literals and comments. A batch of
+// several statements has the parameters of each in turn.
+func parseStmt(query string) *parsedStmt {
+	statements := sqltok.Split(query)
+	if len(statements) < 2 {
+		return parseTokens(query, sqltok.Tokenize(query))
+	}
+
+	p := &parsedStmt{query: query}
+	for _, statement := range statements {
+		part := parseTokens(statement.Text, statement.Tokens)
+		if len(part.names) > 0 {
+			for len(p.names) < p.numInput {
+				p.names = append(p.names, "")
+			}
+			p.names = append(p.names, part.names...)
+		}
+		p.numInput += part.numInput
+		p.parts = append(p.parts, part)
+	}
+	return p
+}
+
+// parseTokens finds the parameters of a single statement
+func parseTokens(query string, tokens []sqltok.Token) *parsedStmt {
+	p := &parsedStmt{query: query}
+	byName := make(map[string]int)
+	for _, tok := range sqltok.Params(tokens) {
+		switch {
+		case tok.Text == "?":
+			p.numInput++
+		case tok.Text[0] == '?':
+			if n, err := strconv.Atoi(tok.Text[1:]); err == nil && n > p.numInput {
+				p.numInput = n
+			}
+		default:
+			if _, ok := byName[tok.Text]; ok {
+				continue
+			}
+			p.numInput++
+			byName[tok.Text] = p.numInput
+			for len(p.names) < p.numInput {
+				p.names = append(p.names, "")
+			}
+			p.names[p.numInput-1] = tok.Text[1:]
+		}
+	}
+	return p
+}
+
+// stmtCache keeps the statements last parsed by a connection. Like the
+// connection, it is not safe for concurrent use, which database/sql
+// doesn't do.
+type stmtCache struct {
+	size int
+	// order has the *parsedStmt, the most recently used first
+	order   *list.List
+	byQuery map[string]*list.Element
+}
+
+func newStmtCache(size int) *stmtCache {
+	return &stmtCache{size: size, order: list.New(), byQuery: make(map[string]*list.Element)}
+}
+
+// get returns the parsed statement, parsing it if it isn't cached
+func (c *stmtCache) get(query string) *parsedStmt {
+	if e, ok := c.byQuery[query]; ok {
+		c.order.MoveToFront(e)
+		return e.Value.(*parsedStmt)
+	}
+
+	p := parseStmt(query)
+	c.byQuery[query] = c.order.PushFront(p)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.byQuery, oldest.Value.(*parsedStmt).query)
+	}
+	return p
+}
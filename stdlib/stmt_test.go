@@ -0,0 +1,143 @@
+package stdlib
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/rqlite/gorqlite"
+)
+
+func TestParseStmt(t *testing.T) {
+	tests := []struct {
+		query    string
+		numInput int
+		names    []string
+	}{
+		{"SELECT 1", 0, nil},
+		{"SELECT * FROM t WHERE a = ? AND b = ?", 2, nil},
+		{"SELECT * FROM t WHERE a = '?' AND b = \"?\" -- ?\n AND c = ? /* ? :x */", 1, nil},
+		{"SELECT ?2, ?1", 2, nil},
+		{"SELECT ?, ?5, ?", 6, nil},
+		{"SELECT :a, @b, :a, $c", 3, []string{"a", "b", "c"}},
+		{"SELECT ?, :a, ?", 3, []string{"", "a"}},
+		{"INSERT INTO t VALUES (?, 'it''s ?', x'3F')", 1, nil},
+		{"INSERT INTO t VALUES (?, ?); SELECT ?2", 4, nil},
+		{"SELECT ?; SELECT :a, :a; SELECT :b", 3, []string{"", "a", "b"}},
+		{"SELECT 1;;", 0, nil},
+	}
+	for _, test := range tests {
+		p := parseStmt(test.query)
+		if p.numInput != test.numInput || !reflect.DeepEqual(p.names, test.names) {
+			t.Errorf("%s: got %d %q, want %d %q", test.query, p.numInput, p.names, test.numInput, test.names)
+		}
+	}
+}
+
+func TestStmtCache(t *testing.T) {
+	c := newStmtCache(2)
+	first := c.get("SELECT ?")
+	if c.get("SELECT ?") != first {
+		t.Errorf("statement parsed again")
+	}
+	c.get("SELECT ?, ?")
+	c.get("SELECT ?")
+	c.get("SELECT ?, ?, ?")
+	if c.order.Len() != 2 || c.byQuery["SELECT ?, ?"] != nil {
+		t.Errorf("least recently used statement not evicted: %v", c.byQuery)
+	}
+	if c.get("SELECT ?") != first {
+		t.Errorf("recently used statement evicted")
+	}
+
+	for i := 0; i < 10; i++ {
+		c.get(fmt.Sprintf("SELECT %d", i))
+	}
+	if c.order.Len() != 2 || len(c.byQuery) != 2 {
+		t.Errorf("cache grew to %d, %d", c.order.Len(), len(c.byQuery))
+	}
+}
+
+func TestNumInput(t *testing.T) {
+	conn := &Conn{}
+	stmt, err := conn.Prepare("UPDATE t SET a = ? WHERE b = :b AND c = :b")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := stmt.NumInput(); n != 2 {
+		t.Errorf("got %d inputs, want 2", n)
+	}
+	if n := (&Stmt{Stmt: "SELECT ?"}).NumInput(); n != -1 {
+		t.Errorf("got %d inputs for an unparsed statement, want -1", n)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	var statements [][]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		statements = nil
+		json.NewDecoder(r.Body).Decode(&statements)
+		switch r.URL.Path {
+		case "/db/execute":
+			w.Write([]byte(`{"results":[{"rows_affected":2,"last_insert_id":7},{"rows_affected":1,"last_insert_id":9},{"rows_affected":3}]}`))
+		case "/db/request":
+			w.Write([]byte(`{"results":[
+				{"rows_affected":1,"last_insert_id":3},
+				{"columns":["id"],"types":["integer"],"values":[[1],[2]]},
+				{"columns":["name"],"types":["text"],"values":[["a"]]}
+			]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	db := sql.OpenDB(NewConnector(srv.URL, gorqlite.WithClusterDiscovery(false)))
+	defer db.Close()
+
+	res, err := db.Exec("INSERT INTO t VALUES (?, ?); INSERT INTO t VALUES (?); DELETE FROM u", 1, 2, 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := [][]interface{}{{"INSERT INTO t VALUES (?, ?)", 1.0, 2.0}, {"INSERT INTO t VALUES (?)", 3.0}, {"DELETE FROM u"}}
+	if !reflect.DeepEqual(statements, want) {
+		t.Errorf("got statements %v, want %v", statements, want)
+	}
+	if n, _ := res.RowsAffected(); n != 6 {
+		t.Errorf("got %d rows affected, want 6", n)
+	}
+	if id, _ := res.LastInsertId(); id != 9 {
+		t.Errorf("got last insert ID %d, want 9", id)
+	}
+
+	rows, err := db.Query("INSERT INTO t VALUES (?); SELECT id FROM t; SELECT name FROM u", 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer rows.Close()
+	var sets [][]string
+	for {
+		var set []string
+		for rows.Next() {
+			var v string
+			if err := rows.Scan(&v); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			set = append(set, v)
+		}
+		sets = append(sets, set)
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := [][]string{nil, {"1", "2"}, {"a"}}; !reflect.DeepEqual(sets, want) {
+		t.Errorf("got result sets %v, want %v", sets, want)
+	}
+}
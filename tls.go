@@ -0,0 +1,99 @@
+package gorqlite
+
+/*
+	this file contains the TLS configuration of a Connection, set by
+	the tls* URL query params or the WithTLS* options
+*/
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	nurl "net/url"
+)
+
+// tlsSettings holds the TLS settings given in the URL or the options.
+// They are applied on top of the config given by WithTLSConfig, or else
+// of the one of the transport of the client, if any.
+type tlsSettings struct {
+	caCertFile         string // PEM bundle of CAs to trust instead of the system ones
+	certFile           string // PEM client certificate, for mutual TLS
+	keyFile            string // PEM client key, for mutual TLS
+	serverName         string // name to verify the server certificate against
+	insecureSkipVerify *bool  // whether to skip verifying the server certificate, nil if not given
+}
+
+// isSet tells whether any TLS setting was given
+func (s tlsSettings) isSet() bool {
+	return s != tlsSettings{}
+}
+
+// parseTLSQuery reads the TLS settings from the URL query params:
+//
+//	tlsCACert              path to a PEM bundle of CAs to trust
+//	tlsCert                path to a PEM client certificate
+//	tlsKey                 path to the PEM key of the client certificate
+//	tlsServerName          name to verify the server certificate against
+//	tlsInsecureSkipVerify  true to skip verification of the server certificate
+func (s *tlsSettings) parseTLSQuery(query nurl.Values) error {
+	s.caCertFile = query.Get("tlsCACert")
+	s.certFile = query.Get("tlsCert")
+	s.keyFile = query.Get("tlsKey")
+	s.serverName = query.Get("tlsServerName")
+	if query.Get("tlsInsecureSkipVerify") != "" {
+		skip, err := strconv.ParseBool(query.Get("tlsInsecureSkipVerify"))
+		if err != nil {
+			return errors.New("invalid tlsInsecureSkipVerify value: " + err.Error())
+		}
+		s.insecureSkipVerify = &skip
+	}
+	return nil
+}
+
+// buildTLSConfig returns a copy of base, or a new config if base is nil,
+// with the settings applied.
+func (s tlsSettings) buildTLSConfig(base *tls.Config) (*tls.Config, error) {
+	var config *tls.Config
+	if base != nil {
+		config = base.Clone()
+	} else {
+		config = &tls.Config{}
+	}
+
+	if s.caCertFile != "" {
+		pem, err := os.ReadFile(s.caCertFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", s.caCertFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if s.certFile != "" || s.keyFile != "" {
+		if s.certFile == "" || s.keyFile == "" {
+			return nil, errors.New("both a client certificate and a client key are needed")
+		}
+		cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if s.serverName != "" {
+		config.ServerName = s.serverName
+	}
+
+	if s.insecureSkipVerify != nil {
+		config.InsecureSkipVerify = *s.insecureSkipVerify
+	}
+
+	return config, nil
+}
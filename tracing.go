@@ -0,0 +1,150 @@
+package gorqlite
+
+/*
+	this file contains the Tracer of a connection, starting a span per
+	query, write, request and queue call, and a span per HTTP attempt
+	within, whose W3C traceparent is sent to rqlite
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rqlite/gorqlite/internal/sqltok"
+)
+
+// Attribute is a key and value of a span. The keys follow the
+// OpenTelemetry semantic conventions where they apply:
+//
+//	db.system                    "rqlite"
+//	db.operation                 "query", "write", "request" or "queue"
+//	db.statement                 the SQL, see WithSpanSQL
+//	db.rqlite.statement_count    the number of statements
+//	db.rqlite.consistency_level  "none", "weak", "linearizable" or "strong"
+//	db.rqlite.cached             true for a query answered by the cache
+//	db.rqlite.shared             true for a query sharing the request of
+//	                             a concurrent one, see WithSingleFlight
+//	server.address               the peer of an HTTP attempt
+//	http.request.method          its method
+//	http.response.status_code    its status code, if there was a response
+//	db.rqlite.retry              its pass over the peer list, see WithRetry
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Tracer starts the spans of a connection, set by WithTracer. The
+// otelgorqlite module adapts OpenTelemetry to it.
+type Tracer interface {
+	// Start starts a span as a child of the span of ctx, if any, and
+	// returns a context carrying it.
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// SetAttributes adds attributes to the span.
+	SetAttributes(attrs ...Attribute)
+	// TraceParent returns the W3C traceparent header value of the span,
+	// sent along with its HTTP requests, or "" not to send any.
+	TraceParent() string
+	// End ends the span, err being its outcome.
+	End(err error)
+}
+
+type spanSQL int
+
+const (
+	// SpanSQLRedacted puts the SQL in spans, with its literals
+	// replaced by ?. This is the default.
+	SpanSQLRedacted spanSQL = iota
+	// SpanSQLFull puts the SQL in spans as is.
+	SpanSQLFull
+	// SpanSQLNone leaves the SQL out of spans.
+	SpanSQLNone
+)
+
+// WithTracer sets the Tracer starting the spans of the connection.
+// Defaults to none.
+func WithTracer(tracer Tracer) Option {
+	return func(conn *Connection) error {
+		if tracer == nil {
+			return errors.New("tracer is nil")
+		}
+		conn.tracer = tracer
+		return nil
+	}
+}
+
+// WithSpanSQL sets how the SQL of statements is put in spans. Defaults
+// to SpanSQLRedacted.
+func WithSpanSQL(mode spanSQL) Option {
+	return func(conn *Connection) error {
+		if mode < SpanSQLRedacted || mode > SpanSQLNone {
+			return fmt.Errorf("unknown span SQL mode: %d", mode)
+		}
+		conn.spanSQL = mode
+		return nil
+	}
+}
+
+// noopSpan is the span when there is no tracer
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(attrs ...Attribute) {}
+func (noopSpan) TraceParent() string              { return "" }
+func (noopSpan) End(err error)                    {}
+
+// startSpan starts the span of a query, write, request or queue call
+func (conn *Connection) startSpan(ctx context.Context, op string, statements []ParameterizedStatement) (context.Context, Span) {
+	if conn.tracer == nil {
+		return ctx, noopSpan{}
+	}
+	rs := conn.requestSettings(requestOptionsFromContext(ctx))
+	attrs := []Attribute{
+		{"db.system", "rqlite"},
+		{"db.operation", op},
+		{"db.rqlite.statement_count", len(statements)},
+		{"db.rqlite.consistency_level", consistencyLevelToString[rs.consistencyLevel]},
+	}
+	if conn.spanSQL != SpanSQLNone {
+		queries := make([]string, len(statements))
+		for i, statement := range statements {
+			queries[i] = statement.Query
+			if conn.spanSQL == SpanSQLRedacted {
+				queries[i] = redactSQL(statement.Query)
+			}
+		}
+		attrs = append(attrs, Attribute{"db.statement", strings.Join(queries, ";\n")})
+	}
+	return conn.tracer.Start(ctx, "gorqlite."+op, attrs...)
+}
+
+// startAttemptSpan starts the span of an HTTP attempt to a peer
+func (conn *Connection) startAttemptSpan(ctx context.Context, apiOp apiOperation, method string, p peer, retry int) (context.Context, Span) {
+	if conn.tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return conn.tracer.Start(ctx, "gorqlite.http."+apiOp.String(),
+		Attribute{"server.address", string(p)},
+		Attribute{"http.request.method", method},
+		Attribute{"db.rqlite.retry", retry},
+	)
+}
+
+// redactSQL replaces the string, blob and number literals of the SQL
+// by ?, leaving its parameters as they are
+func redactSQL(sql string) string {
+	var b strings.Builder
+	for _, tok := range sqltok.Tokenize(sql) {
+		switch tok.Kind {
+		case sqltok.String, sqltok.Blob, sqltok.Number:
+			b.WriteByte('?')
+		default:
+			b.WriteString(tok.Text)
+		}
+	}
+	return b.String()
+}
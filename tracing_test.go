@@ -0,0 +1,127 @@
+package gorqlite
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+type recordedSpan struct {
+	name   string
+	id     int
+	parent int
+	attrs  map[string]interface{}
+	err    error
+	ended  bool
+}
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+type spanKey struct{}
+
+func (tr *recordingTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	s := &recordedSpan{name: name, id: len(tr.spans) + 1, attrs: make(map[string]interface{})}
+	if parent, ok := ctx.Value(spanKey{}).(*recordedSpan); ok {
+		s.parent = parent.id
+	}
+	tr.spans = append(tr.spans, s)
+	s.SetAttributes(attrs...)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (s *recordedSpan) SetAttributes(attrs ...Attribute) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *recordedSpan) TraceParent() string {
+	return fmt.Sprintf("00-%032x-%016x-01", 1, s.id)
+}
+
+func (s *recordedSpan) End(err error) {
+	s.err = err
+	s.ended = true
+}
+
+func TestWithTracer(t *testing.T) {
+	var traceParents []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceParents = append(traceParents, r.Header.Get("traceparent"))
+		if r.URL.Path == "/db/query" {
+			w.Write([]byte(`{"results":[{"error":"no such table: foo"}]}`))
+			return
+		}
+		w.Write([]byte(`{"results":[{"rows_affected":1}]}`))
+	}))
+	defer srv.Close()
+
+	tracer := &recordingTracer{}
+	conn, err := OpenWithOptions(srv.URL+"?level=strong", WithClusterDiscovery(false), WithTracer(tracer))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := conn.WriteParameterized([]ParameterizedStatement{
+		{Query: "INSERT INTO foo VALUES ('secret', x'00', 42, ?)", Arguments: []interface{}{1}},
+		{Query: "DELETE FROM foo"},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := conn.QueryOne("SELECT * FROM foo"); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+
+	if len(tracer.spans) != 4 {
+		t.Fatalf("got %d spans, want 4", len(tracer.spans))
+	}
+	write, attempt := tracer.spans[0], tracer.spans[1]
+	if write.name != "gorqlite.write" || write.parent != 0 || !write.ended || write.err != nil {
+		t.Errorf("unexpected write span: %+v", write)
+	}
+	want := map[string]interface{}{
+		"db.system":                   "rqlite",
+		"db.operation":                "write",
+		"db.statement":                "INSERT INTO foo VALUES (?, ?, ?, ?);\nDELETE FROM foo",
+		"db.rqlite.statement_count":   2,
+		"db.rqlite.consistency_level": "strong",
+	}
+	for k, v := range want {
+		if write.attrs[k] != v {
+			t.Errorf("write span %s: got %v, want %v", k, write.attrs[k], v)
+		}
+	}
+	if attempt.name != "gorqlite.http.write" || attempt.parent != write.id || !attempt.ended ||
+		attempt.attrs["http.response.status_code"] != http.StatusOK || attempt.attrs["server.address"] == "" {
+		t.Errorf("unexpected attempt span: %+v", attempt)
+	}
+	if traceParents[0] != attempt.TraceParent() {
+		t.Errorf("got traceparent %q, want %q", traceParents[0], attempt.TraceParent())
+	}
+	if query := tracer.spans[2]; query.name != "gorqlite.query" || query.err == nil {
+		t.Errorf("unexpected query span: %+v", query)
+	}
+
+	full, err := OpenWithOptions(srv.URL, WithClusterDiscovery(false), WithTracer(tracer), WithSpanSQL(SpanSQLFull))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	full.QueueOne("INSERT INTO foo VALUES ('x')")
+	if queue := tracer.spans[4]; queue.name != "gorqlite.queue" || queue.attrs["db.statement"] != "INSERT INTO foo VALUES ('x')" {
+		t.Errorf("unexpected queue span: %+v", queue)
+	}
+
+	if _, err := OpenWithOptions(srv.URL, WithTracer(nil)); err == nil {
+		t.Errorf("expected error for a nil tracer, got nil")
+	}
+	if _, err := OpenWithOptions(srv.URL, WithSpanSQL(spanSQL(7))); err == nil {
+		t.Errorf("expected error for an unknown span SQL mode, got nil")
+	}
+}
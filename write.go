@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"time"
 )
 
 /* *****************************************************************
@@ -172,6 +174,9 @@ func (conn *Connection) WriteParameterizedContext(ctx context.Context, sqlStatem
 
 	trace("%s: Write() for %d statements", conn.ID, len(sqlStatements))
 
+	ctx, span := conn.startSpan(ctx, "write", sqlStatements)
+	defer func() { span.End(err) }()
+
 	response, err := conn.rqliteApiPost(ctx, api_WRITE, sqlStatements)
 	if err != nil {
 		trace("%s: rqliteApiCall() ERROR: %s", conn.ID, err.Error())
@@ -191,9 +196,10 @@ func (conn *Connection) WriteParameterizedContext(ctx context.Context, sqlStatem
 		results = append(results, errResult)
 		return results, err
 	}
+	conn.observeTiming(ctx, api_WRITE, sections)
 
 	// at this point, we have a "results" section and
-	// a "time" section.  we can igore the latter.
+	// a "time" section, only observed.
 
 	resultsArray, ok := sections["results"].([]interface{})
 	if !ok {
@@ -282,17 +288,110 @@ func (conn *Connection) QueueParameterized(sqlStatements []ParameterizedStatemen
 // to the rqlite database as defined in the documentation:
 // https://github.com/rqlite/rqlite/blob/master/DOC/QUEUED_WRITES.md
 func (conn *Connection) QueueParameterizedContext(ctx context.Context, sqlStatements []ParameterizedStatement) (seq int64, err error) {
+	return conn.queue(ctx, sqlStatements, false)
+}
+
+// QueueAndWait is used to perform queued writes, waiting for the queue to be flushed,
+// including these writes, before returning. Errors from the flush are returned.
+//
+// QueueAndWait uses context.Background() internally; to specify the context, use QueueAndWaitContext.
+// To use QueueAndWait with parameterized queries, use QueueParameterizedAndWait.
+func (conn *Connection) QueueAndWait(sqlStatements []string) (seq int64, err error) {
+	return conn.QueueAndWaitContext(context.Background(), sqlStatements)
+}
+
+// QueueAndWaitContext is used to perform queued writes, waiting for the queue to be flushed,
+// including these writes, before returning. Errors from the flush are returned.
+//
+// To use QueueAndWaitContext with parameterized queries, use QueueParameterizedAndWaitContext.
+func (conn *Connection) QueueAndWaitContext(ctx context.Context, sqlStatements []string) (seq int64, err error) {
+	parameterizedStatements := make([]ParameterizedStatement, 0, len(sqlStatements))
+	for _, sqlStatement := range sqlStatements {
+		parameterizedStatements = append(parameterizedStatements, ParameterizedStatement{Query: sqlStatement})
+	}
+
+	return conn.QueueParameterizedAndWaitContext(ctx, parameterizedStatements)
+}
+
+// QueueParameterizedAndWait is used to perform queued writes with parameterized queries,
+// waiting for the queue to be flushed, including these writes, before returning.
+//
+// QueueParameterizedAndWait uses context.Background() internally; to specify the context,
+// use QueueParameterizedAndWaitContext.
+func (conn *Connection) QueueParameterizedAndWait(sqlStatements []ParameterizedStatement) (seq int64, err error) {
+	return conn.QueueParameterizedAndWaitContext(context.Background(), sqlStatements)
+}
+
+// QueueParameterizedAndWaitContext is used to perform queued writes with parameterized queries,
+// waiting for the queue to be flushed, including these writes, before returning.
+//
+// This gives read-your-writes for queued writes: once it returns without error,
+// the writes have been applied.
+func (conn *Connection) QueueParameterizedAndWaitContext(ctx context.Context, sqlStatements []ParameterizedStatement) (seq int64, err error) {
+	return conn.queue(ctx, sqlStatements, true)
+}
+
+// Flush waits for the queue of the node answering to be flushed, and returns the
+// sequence number of the last queued write it holds. Every queued write with a
+// sequence number up to that one has been applied.
+//
+// Flush uses context.Background() internally; to specify the context, use FlushContext.
+func (conn *Connection) Flush() (seq int64, err error) {
+	return conn.FlushContext(context.Background())
+}
+
+// FlushContext waits for the queue of the node answering to be flushed, and returns the
+// sequence number of the last queued write it holds. Every queued write with a
+// sequence number up to that one has been applied.
+//
+// The flush is a queued write of no statements, waiting: rqlite accepts
+// an empty request along with wait, and answers it once its queue is
+// flushed, without adding a write to it.
+func (conn *Connection) FlushContext(ctx context.Context) (seq int64, err error) {
+	return conn.queue(ctx, []ParameterizedStatement{}, true)
+}
+
+// waitForSequencePollInterval is the pause between two flushes in WaitForSequence
+const waitForSequencePollInterval = 100 * time.Millisecond
+
+// WaitForSequence waits until the queued write with the given sequence number,
+// as returned by Queue*, has been applied.
+//
+// Sequence numbers are kept by each node, so this should talk to the node the
+// write was queued on, which is the leader unless the cluster changed since.
+// WaitForSequence keeps flushing until the sequence number is reached, or ctx is
+// done: use a context with a deadline.
+func (conn *Connection) WaitForSequence(ctx context.Context, seq int64) error {
+	for {
+		flushed, err := conn.FlushContext(ctx)
+		if err != nil {
+			return err
+		}
+		if flushed >= seq {
+			trace("%s: sequence number %d reached (%d)", conn.ID, seq, flushed)
+			return nil
+		}
+		trace("%s: waiting for sequence number %d, at %d", conn.ID, seq, flushed)
+		if err := sleepContext(ctx, waitForSequencePollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// queue does the queued writes for the Queue* and Flush* methods,
+// waiting for the queue to be flushed if asked to
+func (conn *Connection) queue(ctx context.Context, sqlStatements []ParameterizedStatement, wait bool) (seq int64, err error) {
 	if conn.hasBeenClosed {
 		return 0, ErrClosed
 	}
 
-	trace("%s: Write() for %d statements", conn.ID, len(sqlStatements))
+	trace("%s: Queue() for %d statements, wait: %v", conn.ID, len(sqlStatements), wait)
 
 	// Set queuing mode just for this call.
-	conn.wantsQueueing = true
-	defer func() {
-		conn.wantsQueueing = false
-	}()
+	ctx = WithRequestOptions(ctx, RequestQueue(true), requestQueueWait(wait))
+
+	ctx, span := conn.startSpan(ctx, "queue", sqlStatements)
+	defer func() { span.End(err) }()
 
 	response, err := conn.rqliteApiPost(ctx, api_WRITE, sqlStatements)
 	if err != nil {
@@ -308,7 +407,31 @@ func (conn *Connection) QueueParameterizedContext(ctx context.Context, sqlStatem
 		return 0, err
 	}
 
-	return int64(sections["sequence_number"].(float64)), nil
+	// when waiting, a failed flush is reported rather than lost
+	if errMsg, ok := sections["error"].(string); ok && errMsg != "" {
+		trace("%s: api ERROR: %s", conn.ID, errMsg)
+		return 0, fmt.Errorf("%s", errMsg)
+	}
+	if resultsArray, ok := sections["results"].([]interface{}); ok {
+		var errs []error
+		for _, r := range resultsArray {
+			if wr := conn.parseWriteResult(r.(map[string]interface{})); wr.Err != nil {
+				errs = append(errs, wr.Err)
+			}
+		}
+		if err := joinErrors(errs...); err != nil {
+			return 0, err
+		}
+	}
+
+	seqNum, ok := sections["sequence_number"].(float64)
+	if !ok {
+		err = errors.New("sequence_number key is missing from response")
+		trace("%s: sections[\"sequence_number\"] ERROR: %s", conn.ID, err)
+		return 0, err
+	}
+
+	return int64(seqNum), nil
 }
 
 // WriteResult holds the result of a single statement sent to Write().
@@ -147,6 +147,55 @@ func TestQueueOneContext(t *testing.T) {
 	}
 }
 
+func TestFlush(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	wr, err := globalConnection.WriteOneContext(ctx, "CREATE TABLE "+testTableName()+" (id INTEGER, name TEXT)")
+	if err != nil {
+		t.Fatalf("creating table: %s - %s", err.Error(), wr.Err.Error())
+	}
+
+	t.Cleanup(func() {
+		wr, err := globalConnection.WriteOne("DROP TABLE " + testTableName())
+		if err != nil {
+			t.Errorf("dropping table: %s - %s", err.Error(), wr.Err.Error())
+		}
+	})
+
+	var seq int64
+	for i := 0; i < 3; i++ {
+		seq, err = globalConnection.QueueOneContext(ctx, fmt.Sprintf("INSERT INTO "+testTableName()+" (id, name) VALUES ( %d, 'queued' )", i))
+		if err != nil {
+			t.Fatalf("failed during insert: %v", err)
+		}
+	}
+
+	// the flush sends no statements, which rqlite must accept when waiting
+	flushed, err := globalConnection.FlushContext(ctx)
+	if err != nil {
+		t.Fatalf("failed during flush: %v", err)
+	}
+	if flushed < seq {
+		t.Errorf("flushed up to sequence number %d, want at least %d", flushed, seq)
+	}
+
+	qr, err := globalConnection.QueryOneContext(ctx, "SELECT COUNT(*) FROM "+testTableName())
+	if err != nil {
+		t.Fatalf("failed during count: %v", err)
+	}
+	var count int64
+	if !qr.Next() {
+		t.Fatalf("expected a row")
+	}
+	if err := qr.Scan(&count); err != nil {
+		t.Fatalf("failed during scan: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("got %d rows after the flush, want 3", count)
+	}
+}
+
 func TestWriteOneParameterized(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
 	defer cancel()